@@ -3,57 +3,508 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/devisettymahidhar315/zin1/config"
+	"github.com/devisettymahidhar315/zin1/metrics"
 	"github.com/devisettymahidhar315/zin1/multi_cache"
 	"github.com/gin-gonic/gin"
 )
 
-const length = 2
+// maxBatchSize is the maximum number of keys accepted by the batch endpoints
+const maxBatchSize = 1000
 
-var cache = multi_cache.NewMultiCache()
+// Default settings of a Handler
+const (
+	DefaultCapacity     = 2       // Maximum number of entries of the cache
+	DefaultMaxValueSize = 1 << 20 // Largest value accepted in a request body, in bytes
+
+	DefaultProbeTimeout = 1 * time.Second // How long the readiness probe waits for Redis
+)
+
+// Options configures a Handler. Zero values select the defaults.
+type Options struct {
+	Capacity     int   // Maximum number of entries of the cache
+	MaxValueSize int64 // Largest value accepted in a request body, in bytes; larger values are rejected with 413
+
+	// LegacyPrint makes the print endpoints return the old "key:value, key:value" string instead of JSON entries.
+	// It is only meant for clients that still parse that format, which breaks on keys or values containing ":" or ", ".
+	LegacyPrint bool
+
+	DefaultTTL         int     // TTL in seconds of values written without one, 0 for no expiration
+	MaxWritesPerSecond float64 // Requests other than GET and HEAD allowed per second, with one second of burst; 0 for no limit
+
+	ProbeTimeout time.Duration // How long the readiness probe waits for Redis
+
+	// Config is the configuration the Handler was built from, printed by GetConfig. It may be nil.
+	Config *config.Config
+}
+
+// Handler serves the HTTP endpoints on top of a cache. Every endpoint is a method, so several
+// handlers, each with its own cache, can be mounted in one process.
+type Handler struct {
+	cache   *multi_cache.MultiCache
+	opts    atomic.Pointer[Options] // Replaced as a whole by SetOptions while requests are served
+	limiter multi_cache.RateLimiter // Limits the write rate to MaxWritesPerSecond
+
+	requests  metrics.CounterVec    // Requests by method, route and status
+	durations *metrics.HistogramVec // Duration of requests by method and route
+}
+
+// NewHandler returns a Handler serving cache as configured by opts.
+func NewHandler(cache *multi_cache.MultiCache, opts Options) *Handler {
+	h := &Handler{cache: cache, durations: metrics.NewHistogramVec(metrics.LatencyBuckets)}
+	h.SetOptions(opts)
+	return h
+}
+
+// SetOptions replaces the options of the Handler; requests already being served keep the previous ones.
+// A smaller capacity is only enforced on later writes, so resize the cache as well to evict entries now.
+func (h *Handler) SetOptions(opts Options) {
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultCapacity
+	}
+	if opts.MaxValueSize <= 0 {
+		opts.MaxValueSize = DefaultMaxValueSize
+	}
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = DefaultProbeTimeout
+	}
+	h.limiter.SetRate(opts.MaxWritesPerSecond)
+	h.opts.Store(&opts)
+}
+
+// options returns the current options of the Handler
+func (h *Handler) options() *Options {
+	return h.opts.Load()
+}
+
+// defaultTTL returns the TTL in seconds of values written without one, -1 for no expiration
+func (h *Handler) defaultTTL() int {
+	if t := h.options().DefaultTTL; t > 0 {
+		return t
+	}
+	return -1
+}
+
+// LimitWrites is the middleware rejecting requests other than GET and HEAD with 429 beyond MaxWritesPerSecond
+func (h *Handler) LimitWrites(ctx *gin.Context) {
+	if ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead && !h.limiter.Allow() {
+		abort(ctx, http.StatusTooManyRequests, "Write rate limit exceeded")
+		ctx.Abort()
+		return
+	}
+	ctx.Next()
+}
 
 // Endpoint to retrieve a value by key
-func GetCacheValue(ctx *gin.Context) {
+// The version of the value is returned as an ETag; a matching If-None-Match header returns 304
+func (h *Handler) GetCacheValue(ctx *gin.Context) {
 	k := ctx.Param("key")
-	ctx.JSON(http.StatusOK, cache.Get(k))
+	value, version := h.cache.GetWithVersion(ctx.Request.Context(), k)
+	if version > 0 {
+		etag := formatETag(version)
+		ctx.Header("ETag", etag)
+		if etagMatches(ctx.GetHeader("If-None-Match"), etag) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, value)
 
 }
 
 // Endpoint to delete a value by key
-func DeleteCacheValue(ctx *gin.Context) {
+// Under /v1 it answers 204, or 404 if the key does not exist
+func (h *Handler) DeleteCacheValue(ctx *gin.Context) {
 	//storing the key value
 	k := ctx.Param("key")
+	if isV1(ctx) {
+		if h.cache.MDel(ctx.Request.Context(), []string{k}) == 0 {
+			abort(ctx, http.StatusNotFound, "Key not found")
+			return
+		}
+		noContent(ctx)
+		return
+	}
 	//calling the delete method
-	cache.Del(k)
+	h.cache.Del(ctx.Request.Context(), k)
 }
 
 // Endpoint to set a key-value pair
-func SetCacheValue(ctx *gin.Context) {
+func (h *Handler) SetCacheValue(ctx *gin.Context) {
 	//storing the key and value pair
 	k := ctx.Param("key")
 	v := ctx.Param("value")
 	tstr := ctx.Param("time")
 	// Convert time string to integer
 	t, err := strconv.Atoi(tstr)
+	if err != nil || (t != -1 && t <= 0) {
+		abort(ctx, 400, "Invalid time parameter")
+		return
+	}
+	// Tags to attach to the key are given as a comma-separated list
+	tags := parseTags(ctx.Query("tags"))
+	// Conditional writes are requested through the If-None-Match and If-Match headers
+	var version uint64
+	stored := true
+	if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if ifNoneMatch != "*" {
+			abort(ctx, 400, "If-None-Match only supports *")
+			return
+		}
+		// Set only if the key does not exist
+		version, stored, err = h.cache.SetNX(ctx.Request.Context(), k, v, h.options().Capacity, t)
+	} else if ifMatch := ctx.GetHeader("If-Match"); ifMatch == "*" {
+		// Set only if the key exists
+		version, stored, err = h.cache.SetXX(ctx.Request.Context(), k, v, h.options().Capacity, t)
+	} else if ifMatch != "" {
+		// Set only if the key still has the version of the given ETag
+		expected, ok := parseETag(ifMatch)
+		if ok {
+			version, stored, err = h.cache.CompareVersionAndSwap(ctx.Request.Context(), k, expected, v, h.options().Capacity, t)
+		} else {
+			stored = false // No version can match a malformed ETag
+		}
+	} else {
+		//calling the set methods and sending the key,value and length
+		version, err = h.cache.Set(ctx.Request.Context(), k, v, h.options().Capacity, t, tags...)
+		tags = nil // Already attached by Set
+	}
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "Invalid time parameter"})
+		abortWrite(ctx, err)
 		return
 	}
-	//calling the set methods and sending the key,value and length
-	cache.Set(k, v, length, t)
+	if !stored {
+		abort(ctx, http.StatusPreconditionFailed, "Precondition failed")
+		return
+	}
+	if len(tags) > 0 {
+		h.cache.Tag(ctx.Request.Context(), k, tags...)
+	}
+	ctx.Header("ETag", formatETag(version))
+}
+
+// parseTags splits a comma-separated tags query parameter, dropping empty tags
+func parseTags(param string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(param, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Endpoint to list the keys carrying a tag
+func (h *Handler) GetTaggedKeys(ctx *gin.Context) {
+	tag := ctx.Param("tag")
+	ctx.JSON(http.StatusOK, gin.H{"tag": tag, "keys": h.cache.KeysByTag(ctx.Request.Context(), tag)})
+}
+
+// Endpoint to delete every key carrying a tag
+func (h *Handler) InvalidateTag(ctx *gin.Context) {
+	tag := ctx.Param("tag")
+	ctx.JSON(http.StatusOK, gin.H{"tag": tag, "deleted": h.cache.InvalidateTag(ctx.Request.Context(), tag)})
+}
+
+// formatETag formats a version as a strong ETag
+func formatETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseETag extracts the version from an ETag, accepting weak ETags too
+func parseETag(etag string) (uint64, bool) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseUint(etag[1:len(etag)-1], 10, 64)
+	return version, err == nil
+}
+
+// etagMatches reports whether an If-None-Match header matches the given ETag
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	version, _ := parseETag(etag)
+	for _, candidate := range strings.Split(header, ",") {
+		if v, ok := parseETag(candidate); ok && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Endpoint to retrieve several values at once
+// The body is a JSON array of keys
+func (h *Handler) BatchGetCacheValues(ctx *gin.Context) {
+	var keys []string
+	if !bindBatch(ctx, &keys) {
+		return
+	}
+	values := h.cache.MGet(ctx.Request.Context(), keys)
+	found := gin.H{}
+	missing := []string{}
+	for i, key := range keys {
+		if values[i] == "" {
+			missing = append(missing, key)
+		} else {
+			found[key] = values[i]
+		}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"values": found, "missing": missing})
+}
+
+// Endpoint to store several key-value pairs at once
+// The body is a JSON array of {"key", "value"} objects and the TTL is taken from the ttl query parameter
+func (h *Handler) BatchSetCacheValues(ctx *gin.Context) {
+	var items []struct {
+		Key   string `json:"key" binding:"required"`
+		Value string `json:"value"`
+	}
+	if !bindBatch(ctx, &items) {
+		return
+	}
+	t, err := strconv.Atoi(ctx.DefaultQuery("ttl", strconv.Itoa(h.defaultTTL())))
+	if err != nil {
+		abort(ctx, 400, "Invalid ttl parameter")
+		return
+	}
+	batch := make([]multi_cache.Item, len(items))
+	for i, item := range items {
+		batch[i] = multi_cache.Item{Key: item.Key, Value: item.Value}
+	}
+	versions, err := h.cache.MSet(ctx.Request.Context(), batch, h.options().Capacity, t)
+	if err != nil {
+		abortWrite(ctx, err)
+		return
+	}
+	result := gin.H{}
+	for i, item := range items {
+		result[item.Key] = versions[i]
+	}
+	ctx.JSON(http.StatusOK, gin.H{"versions": result})
+}
+
+// Endpoint to delete several keys at once
+// The body is a JSON array of keys
+func (h *Handler) BatchDeleteCacheValues(ctx *gin.Context) {
+	var keys []string
+	if !bindBatch(ctx, &keys) {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": h.cache.MDel(ctx.Request.Context(), keys)})
+}
+
+// bindBatch decodes a JSON array body into v and enforces maxBatchSize
+// It writes a 400 response and returns false if the body is invalid
+func bindBatch[T any](ctx *gin.Context, v *[]T) bool {
+	if err := ctx.ShouldBindJSON(v); err != nil {
+		abort(ctx, 400, "Invalid request body: "+err.Error())
+		return false
+	}
+	if len(*v) > maxBatchSize {
+		abort(ctx, 400, "Too many keys, the limit is "+strconv.Itoa(maxBatchSize))
+		return false
+	}
+	return true
+}
+
+// defaultKeysLimit is the page size of the key listing endpoint when no limit is given
+const defaultKeysLimit = 100
+
+// Endpoint to list keys matching a glob pattern, one page at a time
+// The cursor of the next page is returned as a string and is "0" once every key has been listed
+func (h *Handler) ListKeys(ctx *gin.Context) {
+	cursor, err := strconv.ParseUint(ctx.DefaultQuery("cursor", "0"), 10, 64)
+	if err != nil {
+		abort(ctx, 400, "Invalid cursor parameter")
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultKeysLimit)))
+	if err != nil || limit <= 0 || limit > maxBatchSize {
+		abort(ctx, 400, "Invalid limit parameter, it must be between 1 and "+strconv.Itoa(maxBatchSize))
+		return
+	}
+	keys, next := h.cache.Keys(ctx.Request.Context(), ctx.DefaultQuery("match", "*"), cursor, limit)
+	ctx.JSON(http.StatusOK, gin.H{"keys": keys, "cursor": strconv.FormatUint(next, 10)})
+}
+
+// Endpoint to delete every key matching a glob pattern
+// The pattern is required so a missing parameter cannot wipe the cache; use DELETE /all for that
+func (h *Handler) DeleteKeysByPattern(ctx *gin.Context) {
+	pattern := ctx.Query("match")
+	if pattern == "" {
+		abort(ctx, 400, "Missing match parameter")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": h.cache.DeletePattern(ctx.Request.Context(), pattern)})
+}
+
+// Endpoint to retrieve the metadata of a key without changing its recency
+func (h *Handler) InspectCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	info, found := h.cache.Inspect(ctx.Request.Context(), k)
+	if !found {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	meta := gin.H{
+		"key":     k,
+		"ttl":     ttlSeconds(info.TTL),
+		"size":    info.Size,
+		"version": info.Version,
+		"tiers":   info.Tiers,
+	}
+	// Access statistics are only tracked by the in-memory tier
+	if !info.CreatedAt.IsZero() {
+		meta["created_at"] = info.CreatedAt
+		meta["last_access"] = info.LastAccess
+		meta["access_count"] = info.AccessCount
+	}
+	ctx.JSON(http.StatusOK, meta)
+}
+
+// Endpoint to atomically increment the integer value of a key
+func (h *Handler) IncrCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	// The increment defaults to 1 and may be negative
+	by, err := strconv.ParseInt(ctx.DefaultQuery("by", "1"), 10, 64)
+	if err != nil {
+		abort(ctx, 400, "Invalid by parameter")
+		return
+	}
+	value, err := h.cache.IncrBy(ctx.Request.Context(), k, by, h.options().Capacity)
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "value": value})
+}
+
+// Endpoint to change the TTL of a key without rewriting its value
+func (h *Handler) ExpireCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	// Convert ttl string to integer seconds
+	t, err := strconv.Atoi(ctx.Query("ttl"))
+	if err != nil {
+		abort(ctx, 400, "Invalid ttl parameter")
+		return
+	}
+	if !h.cache.Expire(ctx.Request.Context(), k, time.Duration(t)*time.Second) {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "ttl": ttlSeconds(h.cache.TTL(ctx.Request.Context(), k))})
+}
+
+// Endpoint to remove the expiration of a key
+func (h *Handler) PersistCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	if !h.cache.Persist(ctx.Request.Context(), k) {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "ttl": -1})
+}
+
+// Endpoint to mark a key as recently used without reading it
+func (h *Handler) TouchCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	if !h.cache.Touch(ctx.Request.Context(), k) {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k})
+}
+
+// Endpoint to retrieve the remaining TTL of a key
+func (h *Handler) GetCacheTTL(ctx *gin.Context) {
+	k := ctx.Param("key")
+	ttl := h.cache.TTL(ctx.Request.Context(), k)
+	if ttl == -2 {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "ttl": ttlSeconds(ttl)})
+}
+
+// ttlSeconds converts a TTL to whole seconds, keeping -1 for keys that never expire
+func ttlSeconds(ttl time.Duration) int64 {
+	if ttl < 0 {
+		return -1
+	}
+	return int64(ttl.Round(time.Second) / time.Second)
+}
+
+// printedEntry is the JSON form of a cache entry returned by the print endpoints
+type printedEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Type  string `json:"type"`
+	TTL   int64  `json:"ttl"`
+	Rank  int    `json:"rank"`
 }
 
 // Endpoint to print the in-memory cache contents
-func PrintInMemoryCache(ctx *gin.Context) {
-	ctx.JSON(http.StatusOK, cache.Print_in_mem())
+func (h *Handler) PrintInMemoryCache(ctx *gin.Context) {
+	if h.options().LegacyPrint {
+		ctx.JSON(http.StatusOK, h.cache.Print_in_mem())
+		return
+	}
+	printEntries(ctx, h.cache.InMemoryEntries)
 }
 
 // Endpoint to print the redis cache contents
-func PrintRedisCache(ctx *gin.Context) {
-	ctx.JSON(http.StatusOK, cache.Print_redis())
+func (h *Handler) PrintRedisCache(ctx *gin.Context) {
+	if h.options().LegacyPrint {
+		ctx.JSON(http.StatusOK, h.cache.Print_redis(ctx.Request.Context()))
+		return
+	}
+	printEntries(ctx, func(offset int, fn func(multi_cache.Entry) bool) {
+		h.cache.RedisEntries(ctx.Request.Context(), offset, fn)
+	})
+}
+
+// printEntries writes one page of entries, most recently used first, as a JSON array
+// The page starts at the rank given by the offset query parameter, which the tier seeks to directly,
+// and holds at most limit entries; the offset of the next page is returned in the X-Next-Offset header
+// when more entries remain
+func printEntries(ctx *gin.Context, entries func(int, func(multi_cache.Entry) bool)) {
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		abort(ctx, 400, "Invalid offset parameter")
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultKeysLimit)))
+	if err != nil || limit <= 0 || limit > maxBatchSize {
+		abort(ctx, 400, "Invalid limit parameter, it must be between 1 and "+strconv.Itoa(maxBatchSize))
+		return
+	}
+	page := []printedEntry{}
+	more := false
+	next := offset
+	entries(offset, func(e multi_cache.Entry) bool {
+		if len(page) == limit {
+			more = true // One entry past the page tells there is a next page
+			return false
+		}
+		page = append(page, printedEntry{Key: e.Key, Value: e.Value, Type: e.Type, TTL: ttlSeconds(e.TTL), Rank: e.Rank})
+		next = e.Rank + 1
+		return true
+	})
+	if more {
+		ctx.Header("X-Next-Offset", strconv.Itoa(next))
+	}
+	ctx.JSON(http.StatusOK, page)
 }
 
 // Endpoint to delete entire data
-func DeleteAll(ctx *gin.Context) {
-	cache.Del_ALL()
+func (h *Handler) DeleteAll(ctx *gin.Context) {
+	h.cache.Del_ALL(ctx.Request.Context())
+	noContent(ctx)
 }
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint to print the effective configuration, with secrets such as the Redis password redacted
+// It answers 404 when the server was not built from a configuration
+func (h *Handler) GetConfig(ctx *gin.Context) {
+	cfg := h.options().Config
+	if cfg == nil {
+		abort(ctx, http.StatusNotFound, "The server was not built from a configuration")
+		return
+	}
+	ctx.JSON(http.StatusOK, cfg.Redacted())
+}
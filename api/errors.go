@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/devisettymahidhar315/zin1/multi_cache"
+	"github.com/gin-gonic/gin"
+)
+
+// v1Key marks requests served by the /v1 router group, whose handlers answer with the /v1 conventions
+const v1Key = "zin1.v1"
+
+// V1 is the middleware of the /v1 router group
+// Under /v1, errors are wrapped in an envelope, deletes and writes without a body answer 204,
+// creations answer 201 and missing keys answer 404
+func V1(ctx *gin.Context) {
+	ctx.Set(v1Key, true)
+	ctx.Next()
+}
+
+// isV1 reports whether the request is served by the /v1 router group
+func isV1(ctx *gin.Context) bool {
+	return ctx.GetBool(v1Key)
+}
+
+// NotFound answers requests that match no route, with an error envelope for /v1 paths
+func NotFound(ctx *gin.Context) {
+	if strings.HasPrefix(ctx.Request.URL.Path, "/v1/") {
+		ctx.Set(v1Key, true)
+		abort(ctx, http.StatusNotFound, "No route for "+ctx.Request.Method+" "+ctx.Request.URL.Path)
+		return
+	}
+	ctx.Data(http.StatusNotFound, "text/plain", []byte("404 page not found")) // gin's default response
+}
+
+// abort writes an error response with the given status
+// Under /v1 the body is {"error": {"status": 404, "code": "not_found", "message": "Key not found"}},
+// otherwise it is {"error": "Key not found"} as it always was
+func abort(ctx *gin.Context, status int, message string) {
+	if !isV1(ctx) {
+		ctx.JSON(status, gin.H{"error": message})
+		return
+	}
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	ctx.JSON(status, gin.H{"error": gin.H{"status": status, "code": code, "message": message}})
+}
+
+// abortWrite writes the error response of a write that failed with err: 429 when it exceeds the write rate of
+// a namespace, 507 when it exceeds its entries or bytes quota and 400 otherwise
+func abortWrite(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, multi_cache.ErrRateLimited):
+		abort(ctx, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, multi_cache.ErrEntriesQuota), errors.Is(err, multi_cache.ErrBytesQuota):
+		abort(ctx, http.StatusInsufficientStorage, err.Error())
+	default:
+		abort(ctx, 400, err.Error())
+	}
+}
+
+// noContent ends a response without a body: 204 under /v1, an empty 200 otherwise
+func noContent(ctx *gin.Context) {
+	if isV1(ctx) {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// createdStatus is the status of a response that created a resource: 201 under /v1, 200 otherwise
+func createdStatus(ctx *gin.Context) int {
+	if isV1(ctx) {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
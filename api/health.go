@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/devisettymahidhar315/zin1/multi_cache"
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint for the liveness probe, answering 200 as long as the process serves requests
+// It never touches the cache, so an outage of Redis does not get the process restarted
+func (h *Handler) Healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": multi_cache.StatusUp})
+}
+
+// Endpoint for the readiness probe, pinging Redis for at most ProbeTimeout and checking that the
+// in-memory cleanup loop is ticking
+// It answers 200 unless the cache is down, since a degraded cache still serves requests from memory,
+// and 503 otherwise, with the status of each tier and the state of the circuit breaker in front of Redis
+func (h *Handler) Readyz(ctx *gin.Context) {
+	probeCtx, cancel := context.WithTimeout(ctx.Request.Context(), h.options().ProbeTimeout)
+	defer cancel()
+	health := h.cache.Health(probeCtx)
+
+	tiers := gin.H{}
+	for name, tier := range health.Tiers {
+		t := gin.H{"status": tier.Status}
+		if tier.Error != "" {
+			t["error"] = tier.Error
+		}
+		if name == multi_cache.TierRedis {
+			t["latency_ms"] = float64(tier.Latency.Microseconds()) / 1000
+			t["breaker"] = tier.Breaker
+		} else {
+			t["last_cleanup"] = tier.LastCleanup
+			t["cleanup_interval"] = tier.CleanupInterval.String()
+		}
+		tiers[name] = t
+	}
+	status := http.StatusOK
+	if health.Status == multi_cache.StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, gin.H{"status": health.Status, "tiers": tiers})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/devisettymahidhar315/zin1/jsondoc"
+	"github.com/devisettymahidhar315/zin1/multi_cache"
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint to store a JSON document
+// The document is the request body and is rejected with 400 if it is not valid JSON, or 413 if it is too large
+// The optional ttl query parameter is in seconds and defaults to the default TTL of the Handler
+func (h *Handler) SetJSONCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	t, err := strconv.Atoi(ctx.DefaultQuery("ttl", strconv.Itoa(h.defaultTTL())))
+	if err != nil || (t != -1 && t <= 0) {
+		abort(ctx, 400, "Invalid ttl parameter")
+		return
+	}
+	body, ok := h.readValue(ctx)
+	if !ok {
+		return
+	}
+	version, err := h.cache.SetJSON(ctx.Request.Context(), k, string(body), h.options().Capacity, t, parseTags(ctx.Query("tags"))...)
+	if err != nil {
+		abortWrite(ctx, err)
+		return
+	}
+	ctx.Header("ETag", formatETag(version))
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "version": version})
+}
+
+// Endpoint to retrieve a JSON document or the part of it selected by the path query parameter
+// The path is a JSONPath such as $.user.name or $.items[0] and defaults to the whole document
+func (h *Handler) GetJSONCacheValue(ctx *gin.Context) {
+	value, version, err := h.cache.GetJSON(ctx.Request.Context(), ctx.Param("key"), ctx.DefaultQuery("path", "$"))
+	switch {
+	case errors.Is(err, multi_cache.ErrNotFound):
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	case errors.Is(err, jsondoc.ErrPathNotFound):
+		abort(ctx, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, jsondoc.ErrInvalidJSON):
+		abort(ctx, http.StatusUnprocessableEntity, err.Error())
+		return
+	case err != nil:
+		abort(ctx, 400, err.Error())
+		return
+	}
+	if version > 0 {
+		etag := formatETag(version)
+		ctx.Header("ETag", etag)
+		if etagMatches(ctx.GetHeader("If-None-Match"), etag) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+	}
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", []byte(value))
+}
+
+// Endpoint to atomically update a JSON document
+// The Content-Type header selects the format of the body: application/merge-patch+json for a
+// JSON Merge Patch (RFC 7386) or application/json-patch+json for a JSON Patch (RFC 6902)
+// The patched document is returned with its new version as an ETag
+// Patches are limited to the maximum value size like the values of PUT
+func (h *Handler) PatchJSONCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	body, ok := h.readValue(ctx)
+	if !ok {
+		return
+	}
+	var doc string
+	var err error
+	var version uint64
+	contentType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	switch contentType {
+	case "application/merge-patch+json":
+		doc, version, err = h.cache.MergePatchJSON(ctx.Request.Context(), k, string(body), h.options().Capacity)
+	case "application/json-patch+json":
+		doc, version, err = h.cache.PatchJSON(ctx.Request.Context(), k, string(body), h.options().Capacity)
+	default:
+		abort(ctx, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json or application/json-patch+json")
+		return
+	}
+	switch {
+	case errors.Is(err, multi_cache.ErrNotFound):
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	case errors.Is(err, jsondoc.ErrInvalidJSON):
+		abort(ctx, http.StatusUnprocessableEntity, "The stored value is not valid JSON")
+		return
+	case errors.Is(err, jsondoc.ErrPathNotFound), errors.Is(err, jsondoc.ErrTestFailed), errors.Is(err, multi_cache.ErrConflict):
+		// The patch does not apply to the current document
+		abort(ctx, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.Header("ETag", formatETag(version))
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", []byte(doc))
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/metrics"
+	"github.com/devisettymahidhar315/zin1/multi_cache"
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels the metrics of requests that matched no route
+const unmatchedRoute = "unmatched"
+
+// CountRequests is the middleware counting requests by method, route and status and timing them by method and route
+func (h *Handler) CountRequests(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+	route := ctx.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+	method := ctx.Request.Method
+	h.requests.With(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+	h.durations.With(method, route).Observe(time.Since(start).Seconds())
+}
+
+// Endpoint to expose the metrics of the cache, its tiers and the HTTP endpoints in the Prometheus text format
+func (h *Handler) Metrics(ctx *gin.Context) {
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+	stats := h.cache.Stats(ctx.Request.Context())
+
+	w.Counter("zin1_cache_reads_total", "Reads of the cache by result.", stats.Hits, "result", "hit")
+	w.Counter("zin1_cache_reads_total", "", stats.Misses, "result", "miss")
+	w.Counter("zin1_cache_divergences_total", "Reads where the in-memory and Redis tiers held different values.", stats.Divergences)
+
+	inMemory, redis, disk := multi_cache.TierInMemory, multi_cache.TierRedis, multi_cache.TierDisk
+	w.Counter("zin1_tier_hits_total", "Reads of a tier that found the key.", stats.InMemory.Hits, "tier", inMemory)
+	w.Counter("zin1_tier_hits_total", "", stats.Redis.Hits, "tier", redis)
+	if stats.Disk != nil {
+		w.Counter("zin1_tier_hits_total", "", stats.Disk.Hits, "tier", disk)
+	}
+	w.Counter("zin1_tier_misses_total", "Reads of a tier that did not find the key.", stats.InMemory.Misses, "tier", inMemory)
+	w.Counter("zin1_tier_misses_total", "", stats.Redis.Misses, "tier", redis)
+	if stats.Disk != nil {
+		w.Counter("zin1_tier_misses_total", "", stats.Disk.Misses, "tier", disk)
+	}
+	w.Counter("zin1_tier_sets_total", "Values stored in a tier.", stats.InMemory.Sets, "tier", inMemory)
+	w.Counter("zin1_tier_sets_total", "", stats.Redis.Sets, "tier", redis)
+	if stats.Disk != nil {
+		w.Counter("zin1_tier_sets_total", "", stats.Disk.Sets, "tier", disk)
+	}
+	w.Counter("zin1_tier_deletes_total", "Keys deleted from a tier on request.", stats.InMemory.Deletes, "tier", inMemory)
+	w.Counter("zin1_tier_deletes_total", "", stats.Redis.Deletes, "tier", redis)
+	if stats.Disk != nil {
+		w.Counter("zin1_tier_deletes_total", "", stats.Disk.Deletes, "tier", disk)
+	}
+	w.Counter("zin1_tier_expirations_total", "Keys removed from a tier because their TTL ran out; Redis only counts keys found missing while cleaning up its list.", stats.InMemory.Expirations, "tier", inMemory)
+	w.Counter("zin1_tier_expirations_total", "", stats.Redis.Expirations, "tier", redis)
+	if stats.Disk != nil {
+		w.Counter("zin1_tier_expirations_total", "", stats.Disk.Expirations, "tier", disk)
+	}
+	for _, reason := range []string{in_memory.EvictCapacity, in_memory.EvictResize} {
+		w.Counter("zin1_tier_evictions_total", "Keys evicted from a tier to stay within its capacity, by reason.", stats.InMemory.Evictions[reason], "tier", inMemory, "reason", reason)
+		w.Counter("zin1_tier_evictions_total", "", stats.Redis.Evictions[reason], "tier", redis, "reason", reason)
+		if stats.Disk != nil {
+			w.Counter("zin1_tier_evictions_total", "", stats.Disk.Evictions[reason], "tier", disk, "reason", reason)
+		}
+	}
+	w.Gauge("zin1_tier_entries", "Keys currently held by a tier.", float64(stats.InMemory.Entries), "tier", inMemory)
+	w.Gauge("zin1_tier_entries", "", float64(stats.Redis.Entries), "tier", redis)
+	if stats.Disk != nil {
+		w.Gauge("zin1_tier_entries", "", float64(stats.Disk.Entries), "tier", disk)
+	}
+	w.Gauge("zin1_tier_bytes", "Size of the keys and values held by a tier, or of the data files of the disk tier.", float64(stats.InMemory.Bytes), "tier", inMemory)
+	w.Gauge("zin1_tier_bytes", "", float64(stats.Redis.Bytes), "tier", redis)
+	if stats.Disk != nil {
+		w.Gauge("zin1_tier_bytes", "", float64(stats.Disk.Bytes), "tier", disk)
+	}
+	w.Gauge("zin1_redis_used_memory_bytes", "Memory used by the Redis server, as reported by INFO memory.", float64(stats.Redis.Memory))
+
+	for _, state := range []string{multi_cache.BreakerClosed, multi_cache.BreakerOpen, multi_cache.BreakerHalfOpen} {
+		current := 0.0
+		if stats.Breaker.State == state {
+			current = 1
+		}
+		w.Gauge("zin1_redis_breaker_state", "Whether the circuit breaker in front of Redis is in a state.", current, "state", state)
+	}
+	w.Counter("zin1_redis_breaker_opens_total", "Times the circuit breaker in front of Redis opened.", stats.Breaker.Opens)
+	w.Counter("zin1_degraded_operations_total", "Operations served by the in-memory tier alone because Redis was unavailable.", stats.Breaker.Degraded)
+	w.Counter("zin1_replayed_keys_total", "Keys replayed to Redis after it was unavailable.", stats.Breaker.Replayed)
+
+	h.cache.RedisLatencies(func(command string, latency metrics.HistogramSnapshot) {
+		w.Histogram("zin1_redis_command_duration_seconds", "Latency of the commands sent to Redis.", latency, "command", command)
+	})
+	h.cache.RedisRetries(func(operation string, n uint64) {
+		w.Counter("zin1_redis_retries_total", "Retries of the operations Redis failed to answer.", n, "operation", operation)
+	})
+	h.requests.Each(func(values []string, n uint64) {
+		w.Counter("zin1_http_requests_total", "HTTP requests by method, route and status.", n, "method", values[0], "route", values[1], "status", values[2])
+	})
+	h.durations.Each(func(values []string, latency metrics.HistogramSnapshot) {
+		w.Histogram("zin1_http_request_duration_seconds", "Duration of HTTP requests by method and route.", latency, "method", values[0], "route", values[1])
+	})
+	ctx.Data(http.StatusOK, metrics.ContentType, buf.Bytes())
+}
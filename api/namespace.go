@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/devisettymahidhar315/zin1/multi_cache"
+	"github.com/gin-gonic/gin"
+)
+
+// quotaJSON is the JSON form of a namespace quota, where zero means unlimited
+type quotaJSON struct {
+	MaxEntries         int     `json:"max_entries"`
+	MaxBytes           int64   `json:"max_bytes"`
+	MaxWritesPerSecond float64 `json:"max_writes_per_second"`
+}
+
+// Endpoint to create a namespace
+// The body is a JSON object with the capacity, an optional default TTL in seconds and an optional quota
+func (h *Handler) CreateNamespace(ctx *gin.Context) {
+	var body struct {
+		Capacity   int       `json:"capacity" binding:"required"`
+		DefaultTTL int       `json:"default_ttl"`
+		Quota      quotaJSON `json:"quota"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		abort(ctx, 400, "Invalid request body: "+err.Error())
+		return
+	}
+	ns, err := h.cache.CreateNamespace(ctx.Request.Context(), ctx.Param("namespace"), multi_cache.NamespaceOptions{
+		Capacity:   body.Capacity,
+		DefaultTTL: body.DefaultTTL,
+		Quota:      multi_cache.Quota(body.Quota),
+	})
+	if errors.Is(err, multi_cache.ErrNamespaceExists) {
+		abort(ctx, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.JSON(createdStatus(ctx), namespaceJSON(ns.Info(ctx.Request.Context())))
+}
+
+// Endpoint to list every namespace with its usage
+func (h *Handler) ListNamespaces(ctx *gin.Context) {
+	namespaces := []gin.H{}
+	for _, info := range h.cache.Namespaces(ctx.Request.Context()) {
+		namespaces = append(namespaces, namespaceJSON(info))
+	}
+	ctx.JSON(http.StatusOK, namespaces)
+}
+
+// Endpoint to retrieve the configuration and usage of a namespace
+func (h *Handler) GetNamespace(ctx *gin.Context) {
+	if ns, ok := h.namespace(ctx); ok {
+		ctx.JSON(http.StatusOK, namespaceJSON(ns.Info(ctx.Request.Context())))
+	}
+}
+
+// Endpoint to replace the quota of a namespace
+// The body is a JSON object with the limits, where zero or a missing limit means unlimited
+func (h *Handler) SetNamespaceQuota(ctx *gin.Context) {
+	ns, ok := h.namespace(ctx)
+	if !ok {
+		return
+	}
+	var body quotaJSON
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		abort(ctx, 400, "Invalid request body: "+err.Error())
+		return
+	}
+	if err := ns.SetQuota(multi_cache.Quota(body)); err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, namespaceJSON(ns.Info(ctx.Request.Context())))
+}
+
+// Endpoint to retrieve the usage of every namespace against its quota
+func (h *Handler) GetUsage(ctx *gin.Context) {
+	h.ListNamespaces(ctx)
+}
+
+// Endpoint to drop a namespace and all of its entries
+func (h *Handler) DropNamespace(ctx *gin.Context) {
+	name := ctx.Param("namespace")
+	if !h.cache.DropNamespace(ctx.Request.Context(), name) {
+		abort(ctx, http.StatusNotFound, "Namespace not found")
+		return
+	}
+	if isV1(ctx) {
+		noContent(ctx)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"name": name})
+}
+
+// Endpoint to retrieve a value by key within a namespace
+// Under /v1 a missing key answers 404
+func (h *Handler) GetNamespaceValue(ctx *gin.Context) {
+	ns, ok := h.namespace(ctx)
+	if !ok {
+		return
+	}
+	value, version := ns.GetWithVersion(ctx.Request.Context(), ctx.Param("key"))
+	if value == "" && isV1(ctx) {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	if version > 0 {
+		etag := formatETag(version)
+		ctx.Header("ETag", etag)
+		if etagMatches(ctx.GetHeader("If-None-Match"), etag) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, value)
+}
+
+// Endpoint to set a key-value pair within a namespace
+// The body is a JSON object with the value and an optional TTL in seconds,
+// which defaults to the TTL of the namespace
+// Writes beyond the quota of the namespace fail with 429 for the write rate and 507 for entries or bytes
+func (h *Handler) SetNamespaceValue(ctx *gin.Context) {
+	ns, ok := h.namespace(ctx)
+	if !ok {
+		return
+	}
+	var body struct {
+		Value string `json:"value"`
+		TTL   *int   `json:"ttl"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		abort(ctx, 400, "Invalid request body: "+err.Error())
+		return
+	}
+	t := 0 // The default TTL of the namespace
+	if body.TTL != nil {
+		if t = *body.TTL; t != -1 && t <= 0 {
+			abort(ctx, 400, "Invalid ttl parameter")
+			return
+		}
+	}
+	version, err := ns.Put(ctx.Request.Context(), ctx.Param("key"), body.Value, t)
+	if err != nil {
+		abortWrite(ctx, err)
+		return
+	}
+	ctx.Header("ETag", formatETag(version))
+	noContent(ctx)
+}
+
+// Endpoint to delete a value by key within a namespace
+// Under /v1 it answers 204, or 404 if the key does not exist
+func (h *Handler) DeleteNamespaceValue(ctx *gin.Context) {
+	ns, ok := h.namespace(ctx)
+	if !ok {
+		return
+	}
+	if isV1(ctx) {
+		if ns.MDel(ctx.Request.Context(), []string{ctx.Param("key")}) == 0 {
+			abort(ctx, http.StatusNotFound, "Key not found")
+			return
+		}
+		noContent(ctx)
+		return
+	}
+	ns.Del(ctx.Request.Context(), ctx.Param("key"))
+}
+
+// namespace looks up the namespace named in the path
+// It writes a 404 response and returns false if the namespace does not exist
+func (h *Handler) namespace(ctx *gin.Context) (*multi_cache.Namespace, bool) {
+	ns, found := h.cache.Namespace(ctx.Param("namespace"))
+	if !found {
+		abort(ctx, http.StatusNotFound, "Namespace not found")
+	}
+	return ns, found
+}
+
+// namespaceJSON formats the configuration and usage of a namespace
+func namespaceJSON(info multi_cache.NamespaceInfo) gin.H {
+	return gin.H{
+		"name":        info.Name,
+		"capacity":    info.Capacity,
+		"default_ttl": info.DefaultTTL,
+		"quota":       quotaJSON(info.Quota),
+		"entries":     info.Entries,
+		"bytes":       info.Bytes,
+		"evictions":   info.Evictions,
+		"rejected":    info.Rejected,
+
+		"inmemory_evictions": info.InMemoryEvictions,
+	}
+}
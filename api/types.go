@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint to set fields of a hash
+// The body is a JSON object mapping fields to values
+func (h *Handler) HSetCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	var fields map[string]string
+	if err := ctx.ShouldBindJSON(&fields); err != nil {
+		abort(ctx, 400, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(fields) == 0 || len(fields) > maxBatchSize {
+		abort(ctx, 400, "The body must hold between 1 and "+strconv.Itoa(maxBatchSize)+" fields")
+		return
+	}
+	added, err := h.cache.HSet(ctx.Request.Context(), k, fields, h.options().Capacity)
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "added": added})
+}
+
+// Endpoint to retrieve every field of a hash
+func (h *Handler) HGetAllCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	fields, err := h.cache.HGetAll(ctx.Request.Context(), k)
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	if len(fields) == 0 {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, fields)
+}
+
+// Endpoint to retrieve one field of a hash
+func (h *Handler) HGetCacheValue(ctx *gin.Context) {
+	value, found, err := h.cache.HGet(ctx.Request.Context(), ctx.Param("key"), ctx.Param("field"))
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	if !found {
+		abort(ctx, http.StatusNotFound, "Field not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, value)
+}
+
+// Endpoint to delete one field of a hash
+func (h *Handler) HDelCacheValue(ctx *gin.Context) {
+	removed, err := h.cache.HDel(ctx.Request.Context(), ctx.Param("key"), ctx.Param("field"))
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"removed": removed})
+}
+
+// Endpoint to insert values at the head of a list
+// The body is a JSON array of values, pushed one after the other so the last one ends up at the head
+func (h *Handler) LPushCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	var values []string
+	if !bindBatch(ctx, &values) {
+		return
+	}
+	if len(values) == 0 {
+		abort(ctx, 400, "The body must hold at least one value")
+		return
+	}
+	n, err := h.cache.LPush(ctx.Request.Context(), k, values, h.options().Capacity)
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "length": n})
+}
+
+// Endpoint to retrieve a range of a list
+// The start and stop query parameters are inclusive and default to the whole list; negative values count from the tail
+func (h *Handler) LRangeCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	start, err := strconv.Atoi(ctx.DefaultQuery("start", "0"))
+	if err != nil {
+		abort(ctx, 400, "Invalid start parameter")
+		return
+	}
+	stop, err := strconv.Atoi(ctx.DefaultQuery("stop", "-1"))
+	if err != nil {
+		abort(ctx, 400, "Invalid stop parameter")
+		return
+	}
+	items, err := h.cache.LRange(ctx.Request.Context(), k, start, stop)
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	if len(items) == 0 && h.cache.Type(ctx.Request.Context(), k) == "none" {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, items)
+}
+
+// Endpoint to add members to a set
+// The body is a JSON array of members
+func (h *Handler) SAddCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	var members []string
+	if !bindBatch(ctx, &members) {
+		return
+	}
+	if len(members) == 0 {
+		abort(ctx, 400, "The body must hold at least one member")
+		return
+	}
+	added, err := h.cache.SAdd(ctx.Request.Context(), k, members, h.options().Capacity)
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "added": added})
+}
+
+// Endpoint to retrieve the members of a set in sorted order
+func (h *Handler) SMembersCacheValue(ctx *gin.Context) {
+	members, err := h.cache.SMembers(ctx.Request.Context(), ctx.Param("key"))
+	if err != nil {
+		abort(ctx, 400, err.Error())
+		return
+	}
+	if len(members) == 0 {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, members)
+}
+
+// Endpoint to retrieve the type of the value stored at a key
+func (h *Handler) GetCacheType(ctx *gin.Context) {
+	k := ctx.Param("key")
+	kind := h.cache.Type(ctx.Request.Context(), k)
+	if kind == "none" {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"key": k, "type": kind})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/devisettymahidhar315/zin1/jsondoc"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultContentType is returned for values stored without a content type, such as those of POST /:key/:value/:time
+const defaultContentType = "text/plain; charset=utf-8"
+
+// Endpoint to store the raw request body as the value of a key
+// The Content-Type header is stored with the value and returned by GET /keys/:key;
+// an application/json value is rejected with 400 unless it is valid JSON
+// Under /v1 a new key answers 201 and a replaced one 200
+// The TTL in seconds is taken from the ttl query parameter or the X-TTL header and defaults to the default TTL of the Handler
+func (h *Handler) PutCacheValue(ctx *gin.Context) {
+	k := ctx.Param("key")
+	ttl := ctx.Query("ttl")
+	if ttl == "" {
+		ttl = ctx.GetHeader("X-TTL")
+	}
+	t := h.defaultTTL()
+	if ttl != "" {
+		var err error
+		if t, err = strconv.Atoi(ttl); err != nil || (t != -1 && t <= 0) {
+			abort(ctx, 400, "Invalid ttl, use -1 for no expiration or a number of seconds greater than 0")
+			return
+		}
+	}
+	body, ok := h.readValue(ctx)
+	if !ok {
+		return
+	}
+	value := string(body)
+	contentType := ctx.GetHeader("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	} else if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" {
+		var err error
+		if value, err = jsondoc.Compact(value); err != nil {
+			abort(ctx, 400, err.Error())
+			return
+		}
+	}
+	version, existed, err := h.cache.SetWithContentType(ctx.Request.Context(), k, value, contentType, h.options().Capacity, t, parseTags(ctx.Query("tags"))...)
+	if err != nil {
+		abortWrite(ctx, err)
+		return
+	}
+	status := http.StatusOK
+	if !existed {
+		status = createdStatus(ctx)
+	}
+	ctx.Header("ETag", formatETag(version))
+	ctx.JSON(status, gin.H{"key": k, "version": version})
+}
+
+// Endpoint to retrieve the raw value of a key with the content type it was stored with
+// With a path query parameter the value is read as a JSON document instead, see GetJSONCacheValue
+func (h *Handler) GetRawCacheValue(ctx *gin.Context) {
+	if _, ok := ctx.GetQuery("path"); ok {
+		h.GetJSONCacheValue(ctx)
+		return
+	}
+	value, version, contentType := h.cache.GetWithContentType(ctx.Request.Context(), ctx.Param("key"))
+	if value == "" {
+		abort(ctx, http.StatusNotFound, "Key not found")
+		return
+	}
+	if version > 0 {
+		etag := formatETag(version)
+		ctx.Header("ETag", etag)
+		if etagMatches(ctx.GetHeader("If-None-Match"), etag) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+	}
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	ctx.Data(http.StatusOK, contentType, []byte(value))
+}
+
+// readValue reads a value from the request body, answering 413 if it is larger than the maximum value size
+// and 400 if it is empty, since an empty value cannot be told apart from a missing key
+func (h *Handler) readValue(ctx *gin.Context) ([]byte, bool) {
+	maxValueSize := h.options().MaxValueSize
+	if ctx.Request.ContentLength > maxValueSize {
+		abort(ctx, http.StatusRequestEntityTooLarge, "Values are limited to "+strconv.FormatInt(maxValueSize, 10)+" bytes")
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxValueSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abort(ctx, http.StatusRequestEntityTooLarge, "Values are limited to "+strconv.FormatInt(maxValueSize, 10)+" bytes")
+		return nil, false
+	} else if err != nil {
+		abort(ctx, 400, "Invalid request body: "+err.Error())
+		return nil, false
+	}
+	if len(body) == 0 {
+		abort(ctx, 400, "The value must not be empty")
+		return nil, false
+	}
+	return body, true
+}
@@ -0,0 +1,325 @@
+// Package config loads the settings of a server from a YAML or TOML file and ZIN1_* environment variables.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable read by Load.
+const EnvPrefix = "ZIN1_"
+
+// Redacted replaces secrets in the output of Config.Redacted.
+const Redacted = "REDACTED"
+
+// Config holds the settings of a server.
+type Config struct {
+	Addr               string   `yaml:"addr" toml:"addr" json:"addr"`                                                    // Address the server listens on, as host:port
+	ShutdownTimeout    Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" json:"shutdown_timeout"`                // How long to wait for requests in flight when stopping
+	SnapshotPath       string   `yaml:"snapshot_path" toml:"snapshot_path" json:"snapshot_path"`                         // File the in-memory tier is saved to when stopping and loaded from when starting, none if empty
+	Capacity           int      `yaml:"capacity" toml:"capacity" json:"capacity"`                                        // Maximum number of entries of the cache
+	MaxValueSize       int64    `yaml:"max_value_size" toml:"max_value_size" json:"max_value_size"`                      // Largest value accepted in a request body, in bytes
+	DefaultTTL         Duration `yaml:"default_ttl" toml:"default_ttl" json:"default_ttl"`                               // TTL of values written without one, 0 for no expiration
+	CleanupInterval    Duration `yaml:"cleanup_interval" toml:"cleanup_interval" json:"cleanup_interval"`                // How often expired entries are removed from memory
+	MaxWritesPerSecond float64  `yaml:"max_writes_per_second" toml:"max_writes_per_second" json:"max_writes_per_second"` // Write requests allowed per second, 0 for no limit
+	ProbeTimeout       Duration `yaml:"probe_timeout" toml:"probe_timeout" json:"probe_timeout"`                         // How long the readiness probe waits for Redis
+	LogLevel           string   `yaml:"log_level" toml:"log_level" json:"log_level"`                                     // One of debug, info, warn or error
+	LegacyRoutes       bool     `yaml:"legacy_routes" toml:"legacy_routes" json:"legacy_routes"`                         // Whether the unversioned routes are served next to /v1
+	LegacyPrint        bool     `yaml:"legacy_print" toml:"legacy_print" json:"legacy_print"`                            // Whether the print endpoints return the old string format
+	Redis              Redis    `yaml:"redis" toml:"redis" json:"redis"`
+}
+
+// Redis holds the settings of the connection to Redis.
+type Redis struct {
+	Addr     string `yaml:"addr" toml:"addr" json:"addr"`                // Address of the Redis server as host:port
+	Password string `yaml:"password" toml:"password" json:"password"`    // Password of the Redis server, none if empty
+	DB       int    `yaml:"db" toml:"db" json:"db"`                      // Database of the cache
+	PoolSize int    `yaml:"pool_size" toml:"pool_size" json:"pool_size"` // Connection pool size
+
+	BreakerFailures int      `yaml:"breaker_failures" toml:"breaker_failures" json:"breaker_failures"` // Operations failing in a row that open the circuit breaker
+	BreakerCooldown Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown" json:"breaker_cooldown"` // How long the circuit breaker stays open before probing Redis
+
+	ReadTimeout  Duration `yaml:"read_timeout" toml:"read_timeout" json:"read_timeout"`    // How long a read of Redis may take, retries included
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout" json:"write_timeout"` // How long a write to Redis may take
+	MaxRetries   int      `yaml:"max_retries" toml:"max_retries" json:"max_retries"`       // Retries of an idempotent command Redis failed to answer, 0 for none
+	RetryBackoff Duration `yaml:"retry_backoff" toml:"retry_backoff" json:"retry_backoff"` // Backoff before the first retry, doubled before each next one
+}
+
+// Duration is a time.Duration written as a string such as "1s" or "500ms" in files and environment variables.
+type Duration time.Duration
+
+// UnmarshalText parses a duration such as "1s".
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use a number with a unit such as 1s or 500ms", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string such as "1s".
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the settings used when neither a file nor the environment sets them.
+func Default() *Config {
+	return &Config{
+		Addr:            ":8080",
+		ShutdownTimeout: Duration(10 * time.Second),
+		Capacity:        2,
+		MaxValueSize:    1 << 20,
+		CleanupInterval: Duration(1 * time.Second),
+		ProbeTimeout:    Duration(1 * time.Second),
+		LogLevel:        "info",
+		LegacyRoutes:    true,
+		Redis: Redis{
+			Addr:            "localhost:6379",
+			PoolSize:        10,
+			BreakerFailures: 5,
+			BreakerCooldown: Duration(5 * time.Second),
+			ReadTimeout:     Duration(1 * time.Second),
+			WriteTimeout:    Duration(5 * time.Second),
+			MaxRetries:      2,
+			RetryBackoff:    Duration(10 * time.Millisecond),
+		},
+	}
+}
+
+// Load returns the default settings overridden by the file at path, if path is not empty, then by
+// the environment, and checks the result with Validate.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.LoadEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile overrides the settings with those of a YAML (.yaml, .yml) or TOML (.toml) file.
+// Settings missing from the file are left unchanged and unknown settings are an error.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) { // An empty file sets nothing
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(c); err != nil {
+			var strict *toml.StrictMissingError
+			if errors.As(err, &strict) {
+				return fmt.Errorf("config: %s: %s", path, strict.String())
+			}
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config: %s: unknown format, use a .yaml, .yml or .toml file", path)
+	}
+	return nil
+}
+
+// LoadEnv overrides the settings with the ZIN1_* variables returned by getenv, such as
+// ZIN1_CAPACITY or ZIN1_REDIS_ADDR. Empty variables are ignored.
+func (c *Config) LoadEnv(getenv func(string) string) error {
+	errs := []error{}
+	lookup := func(name string, set func(string) error) {
+		if value := getenv(EnvPrefix + name); value != "" {
+			if err := set(value); err != nil {
+				errs = append(errs, fmt.Errorf("config: %s%s: %w", EnvPrefix, name, err))
+			}
+		}
+	}
+	lookup("ADDR", func(v string) error { c.Addr = v; return nil })
+	lookup("SHUTDOWN_TIMEOUT", func(v string) error { return c.ShutdownTimeout.UnmarshalText([]byte(v)) })
+	lookup("SNAPSHOT_PATH", func(v string) error { c.SnapshotPath = v; return nil })
+	lookup("CAPACITY", intSetter(&c.Capacity))
+	lookup("MAX_VALUE_SIZE", int64Setter(&c.MaxValueSize))
+	lookup("DEFAULT_TTL", func(v string) error { return c.DefaultTTL.UnmarshalText([]byte(v)) })
+	lookup("CLEANUP_INTERVAL", func(v string) error { return c.CleanupInterval.UnmarshalText([]byte(v)) })
+	lookup("MAX_WRITES_PER_SECOND", func(v string) (err error) {
+		c.MaxWritesPerSecond, err = strconv.ParseFloat(v, 64)
+		return unwrapNum(err)
+	})
+	lookup("PROBE_TIMEOUT", func(v string) error { return c.ProbeTimeout.UnmarshalText([]byte(v)) })
+	lookup("LOG_LEVEL", func(v string) error { c.LogLevel = v; return nil })
+	lookup("LEGACY_ROUTES", boolSetter(&c.LegacyRoutes))
+	lookup("LEGACY_PRINT", boolSetter(&c.LegacyPrint))
+	lookup("REDIS_ADDR", func(v string) error { c.Redis.Addr = v; return nil })
+	lookup("REDIS_PASSWORD", func(v string) error { c.Redis.Password = v; return nil })
+	lookup("REDIS_DB", intSetter(&c.Redis.DB))
+	lookup("REDIS_POOL_SIZE", intSetter(&c.Redis.PoolSize))
+	lookup("REDIS_BREAKER_FAILURES", intSetter(&c.Redis.BreakerFailures))
+	lookup("REDIS_BREAKER_COOLDOWN", func(v string) error { return c.Redis.BreakerCooldown.UnmarshalText([]byte(v)) })
+	lookup("REDIS_READ_TIMEOUT", func(v string) error { return c.Redis.ReadTimeout.UnmarshalText([]byte(v)) })
+	lookup("REDIS_WRITE_TIMEOUT", func(v string) error { return c.Redis.WriteTimeout.UnmarshalText([]byte(v)) })
+	lookup("REDIS_MAX_RETRIES", intSetter(&c.Redis.MaxRetries))
+	lookup("REDIS_RETRY_BACKOFF", func(v string) error { return c.Redis.RetryBackoff.UnmarshalText([]byte(v)) })
+	return errors.Join(errs...)
+}
+
+// intSetter returns a function parsing an integer into p
+func intSetter(p *int) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.Atoi(v)
+		return unwrapNum(err)
+	}
+}
+
+// int64Setter returns a function parsing a 64-bit integer into p
+func int64Setter(p *int64) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.ParseInt(v, 10, 64)
+		return unwrapNum(err)
+	}
+}
+
+// boolSetter returns a function parsing a boolean such as true or 0 into p
+func boolSetter(p *bool) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.ParseBool(v)
+		return unwrapNum(err)
+	}
+}
+
+// unwrapNum drops the function name from strconv errors, leaving `invalid syntax for "abc"`
+func unwrapNum(err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return fmt.Errorf("%w for %q", numErr.Err, numErr.Num)
+	}
+	return err
+}
+
+// Validate checks that every setting is usable and reports all the invalid ones at once.
+func (c *Config) Validate() error {
+	errs := []error{}
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("config: "+format, args...))
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		invalid("addr must be host:port or :port, got %q", c.Addr)
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("shutdown_timeout must be greater than 0, got %s", time.Duration(c.ShutdownTimeout))
+	}
+	if c.Capacity <= 0 {
+		invalid("capacity must be greater than 0, got %d", c.Capacity)
+	}
+	if c.MaxValueSize <= 0 {
+		invalid("max_value_size must be greater than 0, got %d", c.MaxValueSize)
+	}
+	if c.DefaultTTL != 0 && c.DefaultTTL < Duration(time.Second) {
+		invalid("default_ttl must be 0 for no expiration or at least 1s, got %s", time.Duration(c.DefaultTTL))
+	}
+	if c.CleanupInterval <= 0 {
+		invalid("cleanup_interval must be greater than 0, got %s", time.Duration(c.CleanupInterval))
+	}
+	if c.MaxWritesPerSecond < 0 {
+		invalid("max_writes_per_second must not be negative, got %g", c.MaxWritesPerSecond)
+	}
+	if c.ProbeTimeout <= 0 {
+		invalid("probe_timeout must be greater than 0, got %s", time.Duration(c.ProbeTimeout))
+	}
+	if _, err := c.Level(); err != nil {
+		invalid("log_level must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+	if _, port, err := net.SplitHostPort(c.Redis.Addr); err != nil {
+		invalid("redis.addr must be host:port, got %q", c.Redis.Addr)
+	} else if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		invalid("redis.addr must have a port between 1 and 65535, got %q", c.Redis.Addr)
+	}
+	if c.Redis.DB < 0 {
+		invalid("redis.db must not be negative, got %d", c.Redis.DB)
+	}
+	if c.Redis.PoolSize <= 0 {
+		invalid("redis.pool_size must be greater than 0, got %d", c.Redis.PoolSize)
+	}
+	if c.Redis.BreakerFailures <= 0 {
+		invalid("redis.breaker_failures must be greater than 0, got %d", c.Redis.BreakerFailures)
+	}
+	if c.Redis.BreakerCooldown <= 0 {
+		invalid("redis.breaker_cooldown must be greater than 0, got %s", time.Duration(c.Redis.BreakerCooldown))
+	}
+	if c.Redis.ReadTimeout <= 0 {
+		invalid("redis.read_timeout must be greater than 0, got %s", time.Duration(c.Redis.ReadTimeout))
+	}
+	if c.Redis.WriteTimeout <= 0 {
+		invalid("redis.write_timeout must be greater than 0, got %s", time.Duration(c.Redis.WriteTimeout))
+	}
+	if c.Redis.MaxRetries < 0 {
+		invalid("redis.max_retries must not be negative, got %d", c.Redis.MaxRetries)
+	}
+	if c.Redis.RetryBackoff <= 0 {
+		invalid("redis.retry_backoff must be greater than 0, got %s", time.Duration(c.Redis.RetryBackoff))
+	}
+	return errors.Join(errs...)
+}
+
+// Level returns the log level named by LogLevel.
+func (c *Config) Level() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+// CheckReload returns an error naming every setting that differs in next but can only change with a restart,
+// such as the Redis address; the other settings can be applied to a running server.
+func (c *Config) CheckReload(next *Config) error {
+	errs := []error{}
+	restart := func(name string, changed bool) {
+		if changed {
+			errs = append(errs, fmt.Errorf("config: %s cannot change without a restart", name))
+		}
+	}
+	restart("addr", c.Addr != next.Addr)
+	restart("redis.addr", c.Redis.Addr != next.Redis.Addr)
+	restart("redis.password", c.Redis.Password != next.Redis.Password)
+	restart("redis.db", c.Redis.DB != next.Redis.DB)
+	restart("redis.pool_size", c.Redis.PoolSize != next.Redis.PoolSize)
+	restart("redis.breaker_failures", c.Redis.BreakerFailures != next.Redis.BreakerFailures)
+	restart("redis.breaker_cooldown", c.Redis.BreakerCooldown != next.Redis.BreakerCooldown)
+	restart("redis.read_timeout", c.Redis.ReadTimeout != next.Redis.ReadTimeout)
+	restart("redis.write_timeout", c.Redis.WriteTimeout != next.Redis.WriteTimeout)
+	restart("redis.max_retries", c.Redis.MaxRetries != next.Redis.MaxRetries)
+	restart("redis.retry_backoff", c.Redis.RetryBackoff != next.Redis.RetryBackoff)
+	restart("legacy_routes", c.LegacyRoutes != next.LegacyRoutes)
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the settings with secrets replaced by Redacted, safe to print.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if redacted.Redis.Password != "" {
+		redacted.Redis.Password = Redacted
+	}
+	return &redacted
+}
@@ -0,0 +1,684 @@
+package disk
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/glob"
+)
+
+const (
+	dataDir   = "data"       // Sub directory holding one file per entry
+	indexFile = "index.json" // Recency order of the entries, most recently used first
+	tmpSuffix = ".tmp"       // Suffix of files that are still being written
+)
+
+// entry describes a value stored on disk.
+type entry struct {
+	Key      string    `json:"key"`                 // Key of the cache entry
+	File     string    `json:"file"`                // Name of the data file under dir/data
+	Size     int64     `json:"size"`                // Size of the data file in bytes
+	ExpireAt time.Time `json:"expire_at,omitempty"` // Expiration time (zero time if no expiration)
+	Version  uint64    `json:"version,omitempty"`   // Version of the value, 0 if it was stored without one
+}
+
+// header is the first line of every data file, so entries can be recovered without the index.
+type header struct {
+	Key      string    `json:"key"`
+	ExpireAt time.Time `json:"expire_at,omitempty"`
+	Version  uint64    `json:"version,omitempty"`
+}
+
+// LRUCache is a disk-backed LRU cache with a bounded disk budget.
+// Values are stored one file per key and the recency order is kept in an index file
+// that is flushed in the background and rebuilt from the data files after a crash.
+// Its methods take no context: each reads or atomically replaces one local file, which the os package
+// cannot interrupt, so a context could only be checked before starting and would bound nothing.
+type LRUCache struct {
+	dir      string // Root directory of the cache
+	maxBytes int64  // Maximum number of bytes the data files may use
+
+	cache map[string]*list.Element // Map for fast access to cache elements
+	list  *list.List               // Doubly linked list to track access order
+	bytes int64                    // Bytes currently used by the data files
+	dirty bool                     // Whether the index needs to be flushed
+
+	stats     Stats  // Counts of operations, see Stats
+	evictions uint64 // Entries evicted to stay within the length or the byte budget
+	resized   uint64 // Entries among evictions that Resize evicted
+
+	cleanupTime time.Duration // Time interval for cleanup and index flushes
+	stop        chan struct{} // Closed to stop the background goroutine
+	closeOnce   sync.Once     // Makes Close safe to call more than once
+	mu          sync.Mutex    // Mutex for concurrent access to cache data structures
+}
+
+// NewLRUCache opens or creates a disk cache in dir that uses at most maxBytes of disk.
+// Entries left by a previous run are recovered, even if the process crashed before flushing the index.
+func NewLRUCache(dir string, maxBytes int64, cleanupTime time.Duration) (*LRUCache, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("invalid disk budget %d: must be greater than 0", maxBytes)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, dataDir), 0o755); err != nil {
+		return nil, err
+	}
+	c := &LRUCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		cache:    make(map[string]*list.Element),
+		list:     list.New(),
+
+		cleanupTime: cleanupTime,
+		stop:        make(chan struct{}),
+	}
+	if err := c.recover(); err != nil {
+		return nil, err
+	}
+	go c.startCleanupRoutine() // Start a goroutine for cleanup and index flushes
+	return c, nil
+}
+
+// Close flushes the index and stops the background goroutine. It may be called more than once.
+func (c *LRUCache) Close() error {
+	c.closeOnce.Do(func() { close(c.stop) })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushIndex()
+}
+
+// startCleanupRoutine periodically removes expired entries and flushes the index.
+func (c *LRUCache) startCleanupRoutine() {
+	ticker := time.NewTicker(c.cleanupTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			c.cleanup()
+			if err := c.flushIndex(); err != nil {
+				log.Printf("Error flushing disk cache index: %v", err)
+			}
+			c.mu.Unlock()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// cleanup removes expired items from the cache. The caller must hold c.mu.
+func (c *LRUCache) cleanup() {
+	now := time.Now()
+	for elem := c.list.Front(); elem != nil; {
+		next := elem.Next()
+		if e := elem.Value.(*entry); expired(e, now) {
+			c.expire(elem)
+		}
+		elem = next
+	}
+}
+
+// Get retrieves the value associated with the given key and marks it as recently used.
+func (c *LRUCache) Get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, found := c.get(key)
+	if found {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	return value
+}
+
+// get retrieves the value of key like Get and reports whether it was found. The caller must hold c.mu.
+func (c *LRUCache) get(key string) (string, bool) {
+	elem, found := c.cache[key]
+	if !found {
+		return "", false // Key not found
+	}
+	e := elem.Value.(*entry)
+	if expired(e, time.Now()) {
+		c.expire(elem)
+		return "", false
+	}
+	value, err := c.readValue(e)
+	if err != nil {
+		// The data file is unusable, forget the entry
+		log.Printf("Error reading key %s from disk: %v", key, err)
+		c.remove(elem)
+		return "", false
+	}
+	c.list.MoveToFront(elem)
+	c.dirty = true
+	return value, true
+}
+
+// Reasons for evicting entries, as reported by Stats.
+const (
+	EvictCapacity = "capacity" // A new entry did not fit within the length or the byte budget
+	EvictResize   = "resize"   // Resize shrank the cache
+)
+
+// Stats counts what happened in a cache since it was opened and holds its current size.
+type Stats struct {
+	Hits        uint64            // Reads by Get that found the key
+	Misses      uint64            // Reads by Get that did not find the key
+	Sets        uint64            // Values stored
+	Deletes     uint64            // Entries deleted on request, not counting expirations and evictions
+	Expirations uint64            // Entries removed because their TTL ran out
+	Evictions   map[string]uint64 // Entries evicted to stay within the length or the budget, by reason such as EvictCapacity
+	Entries     int               // Entries currently held, including expired entries not yet cleaned up
+	Bytes       int64             // Bytes currently used by the data files
+}
+
+// Stats returns the counts of operations of the cache and its current size.
+func (c *LRUCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Evictions = map[string]uint64{
+		EvictCapacity: c.evictions - c.resized,
+		EvictResize:   c.resized,
+	}
+	stats.Entries = c.list.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Peek retrieves the value associated with the given key without changing its recency.
+func (c *LRUCache) Peek(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.cache[key]
+	if !found {
+		return "" // Key not found
+	}
+	e := elem.Value.(*entry)
+	if expired(e, time.Now()) {
+		c.expire(elem)
+		return ""
+	}
+	value, err := c.readValue(e)
+	if err != nil {
+		log.Printf("Error reading key %s from disk: %v", key, err)
+		return ""
+	}
+	return value
+}
+
+// Has reports whether the cache holds a live entry for the given key, without reading its data file
+// or changing its recency.
+func (c *LRUCache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.cache[key]
+	if !found {
+		return false
+	}
+	if expired(elem.Value.(*entry), time.Now()) {
+		c.expire(elem)
+		return false
+	}
+	return true
+}
+
+// Expire sets the time to live of an existing key by rewriting its data file header.
+// A non-positive duration deletes the key. It reports whether the key was found.
+func (c *LRUCache) Expire(key string, d time.Duration) bool {
+	if d <= 0 {
+		return c.setExpireAt(key, time.Time{}, true)
+	}
+	return c.setExpireAt(key, time.Now().Add(d), false)
+}
+
+// Persist removes the expiration of an existing key. It reports whether the key was found.
+func (c *LRUCache) Persist(key string) bool {
+	return c.setExpireAt(key, time.Time{}, false)
+}
+
+// setExpireAt updates the expiration time of a live entry, or deletes it when remove is set.
+func (c *LRUCache) setExpireAt(key string, expireAt time.Time, remove bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.cache[key]
+	if !found {
+		return false
+	}
+	e := elem.Value.(*entry)
+	if expired(e, time.Now()) {
+		c.expire(elem)
+		return false
+	}
+	if remove {
+		c.remove(elem)
+		c.stats.Deletes++
+		return true
+	}
+	value, err := c.readValue(e)
+	if err != nil {
+		log.Printf("Error reading key %s from disk: %v", key, err)
+		c.remove(elem)
+		return false
+	}
+	updated := &entry{Key: key, File: e.File, ExpireAt: expireAt, Version: e.Version}
+	size, err := c.writeValue(updated, value)
+	if err != nil {
+		log.Printf("Error writing key %s to disk: %v", key, err)
+		return false
+	}
+	updated.Size = size
+	c.bytes += size - e.Size
+	elem.Value = updated
+	c.dirty = true
+	c.evict(c.list.Len()) // A longer header may take the files over the budget
+	return true
+}
+
+// Touch marks an existing key as recently used without reading it. It reports whether the key was found.
+func (c *LRUCache) Touch(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.cache[key]
+	if !found {
+		return false
+	}
+	if expired(elem.Value.(*entry), time.Now()) {
+		c.expire(elem)
+		return false
+	}
+	c.list.MoveToFront(elem)
+	c.dirty = true
+	return true
+}
+
+// TTL returns the remaining time to live of the given key, -1 if it never expires and -2 if it does not exist.
+func (c *LRUCache) TTL(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.cache[key]
+	if !found {
+		return -2
+	}
+	e := elem.Value.(*entry)
+	now := time.Now()
+	if expired(e, now) {
+		c.expire(elem)
+		return -2
+	}
+	if e.ExpireAt.IsZero() {
+		return -1
+	}
+	return e.ExpireAt.Sub(now)
+}
+
+// PutKeepTTL stores a key-value pair like Put but keeps the current expiration of an existing key.
+// New keys are stored without expiration.
+func (c *LRUCache) PutKeepTTL(key, value string, length int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireAt := time.Time{}
+	if elem, found := c.cache[key]; found {
+		expireAt = elem.Value.(*entry).ExpireAt
+	}
+	c.put(key, value, length, expireAt, 0)
+}
+
+// Put stores a key-value pair with an optional TTL in seconds.
+// Least recently used entries are evicted while the cache holds more than length entries
+// or the data files exceed the disk budget.
+func (c *LRUCache) Put(key, value string, length, ttl int) {
+	c.PutWithVersion(key, value, length, ttl, 0)
+}
+
+// PutWithVersion stores a key-value pair like Put with the version another tier assigned to the value.
+// A write older than the version already stored is ignored, so mirrored writes cannot go back in time;
+// a version of 0 always writes.
+func (c *LRUCache) PutWithVersion(key, value string, length, ttl int, version uint64) {
+	expireAt := time.Time{}
+	if ttl > 0 {
+		expireAt = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.cache[key]; found && version > 0 && elem.Value.(*entry).Version > version {
+		return // A newer value was already stored
+	}
+	c.put(key, value, length, expireAt, version)
+}
+
+// put stores a key-value pair with an absolute expiration time and a version. The caller must hold c.mu.
+func (c *LRUCache) put(key, value string, length int, expireAt time.Time, version uint64) {
+	e := &entry{Key: key, File: fileName(key), ExpireAt: expireAt, Version: version}
+	size, err := c.writeValue(e, value)
+	if err != nil {
+		log.Printf("Error writing key %s to disk: %v", key, err)
+		return
+	}
+	e.Size = size
+	if size > c.maxBytes {
+		log.Printf("Value of key %s is larger than the disk budget (%d > %d bytes)", key, size, c.maxBytes)
+		if elem, found := c.cache[key]; found {
+			c.remove(elem)
+		} else {
+			os.Remove(c.path(e.File))
+		}
+		return
+	}
+
+	if elem, found := c.cache[key]; found {
+		// The data file was replaced in place, only the accounting changes
+		c.bytes += size - elem.Value.(*entry).Size
+		elem.Value = e
+		c.list.MoveToFront(elem)
+	} else {
+		c.cache[key] = c.list.PushFront(e)
+		c.bytes += size
+	}
+	c.stats.Sets++
+	c.evict(length)
+	c.dirty = true
+}
+
+// evict removes least recently used entries until both limits are respected, down to the last entry
+// if the byte budget requires it, and returns how many were evicted. The caller must hold c.mu.
+func (c *LRUCache) evict(length int) int {
+	evicted := 0
+	for c.list.Len() > 0 && (c.list.Len() > length || c.bytes > c.maxBytes) {
+		c.remove(c.list.Back())
+		evicted++
+	}
+	c.evictions += uint64(evicted)
+	return evicted
+}
+
+// Resize evicts the least recently used entries until at most length remain and returns how many were evicted.
+// Later writes keep the cache within the length they are given.
+func (c *LRUCache) Resize(length int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	evicted := c.evict(max(length, 0))
+	c.resized += uint64(evicted)
+	return evicted
+}
+
+// Print returns a string representation of the cache contents in order from most to least recently used.
+func (c *LRUCache) Print() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	orderedItems := []string{}
+	now := time.Now()
+	for elem := c.list.Front(); elem != nil; {
+		next := elem.Next()
+		e := elem.Value.(*entry)
+		if expired(e, now) {
+			c.expire(elem)
+		} else if value, err := c.readValue(e); err == nil {
+			orderedItems = append(orderedItems, fmt.Sprintf("%s:%s", e.Key, value))
+		}
+		elem = next
+	}
+	return strings.Join(orderedItems, ", ")
+}
+
+// Del deletes a key-value pair from the cache.
+func (c *LRUCache) Del(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.cache[key]; found {
+		c.remove(elem)
+		c.stats.Deletes++
+	}
+}
+
+// DeletePattern deletes every key matching the Redis-style glob pattern and returns how many were deleted.
+func (c *LRUCache) DeletePattern(pattern string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	for elem := c.list.Front(); elem != nil; {
+		next := elem.Next()
+		if glob.Match(pattern, elem.Value.(*entry).Key) {
+			c.remove(elem)
+			deleted++
+		}
+		elem = next
+	}
+	c.stats.Deletes += uint64(deleted)
+	return deleted
+}
+
+// DEL_ALL deletes the entire cache.
+func (c *LRUCache) DEL_ALL() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for elem := c.list.Front(); elem != nil; {
+		next := elem.Next()
+		c.remove(elem)
+		elem = next
+	}
+	if err := c.flushIndex(); err != nil {
+		log.Printf("Error flushing disk cache index: %v", err)
+	}
+}
+
+// expire removes an entry whose TTL ran out. The caller must hold c.mu.
+func (c *LRUCache) expire(elem *list.Element) {
+	c.remove(elem)
+	c.stats.Expirations++
+}
+
+// remove deletes an entry and its data file. The caller must hold c.mu.
+func (c *LRUCache) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.list.Remove(elem)
+	delete(c.cache, e.Key)
+	c.bytes -= e.Size
+	c.dirty = true
+	if err := os.Remove(c.path(e.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing data file of key %s: %v", e.Key, err)
+	}
+}
+
+// writeValue atomically writes the data file for e and returns its size.
+func (c *LRUCache) writeValue(e *entry, value string) (int64, error) {
+	hdr, err := json.Marshal(header{Key: e.Key, ExpireAt: e.ExpireAt, Version: e.Version})
+	if err != nil {
+		return 0, err
+	}
+	data := make([]byte, 0, len(hdr)+1+len(value))
+	data = append(data, hdr...)
+	data = append(data, '\n')
+	data = append(data, value...)
+	if err := writeFileAtomic(c.path(e.File), data); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// readValue returns the value stored in the data file of e.
+func (c *LRUCache) readValue(e *entry) (string, error) {
+	file, err := os.Open(c.path(e.File))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	if _, err := readHeader(reader); err != nil {
+		return "", err
+	}
+	value, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// flushIndex writes the recency order to the index file if it changed. The caller must hold c.mu.
+func (c *LRUCache) flushIndex() error {
+	if !c.dirty {
+		return nil
+	}
+	entries := make([]*entry, 0, c.list.Len())
+	for elem := c.list.Front(); elem != nil; elem = elem.Next() {
+		entries = append(entries, elem.Value.(*entry))
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(c.dir, indexFile), data); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// recover rebuilds the cache from the index and the data files.
+// Index entries whose data file is missing are dropped, and data files written after the
+// last index flush are added back as the most recently used entries, newest first.
+func (c *LRUCache) recover() error {
+	var indexed []*entry
+	data, err := os.ReadFile(filepath.Join(c.dir, indexFile))
+	if err == nil {
+		if err := json.Unmarshal(data, &indexed); err != nil {
+			log.Printf("Ignoring corrupt disk cache index: %v", err)
+			indexed = nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	files, err := os.ReadDir(filepath.Join(c.dir, dataDir))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	onDisk := make(map[string]*entry, len(files))
+	modTimes := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, tmpSuffix) {
+			os.Remove(c.path(name)) // Leftover of an interrupted write
+			continue
+		}
+		e, modTime, err := c.readEntry(name)
+		if err != nil || expired(e, now) {
+			os.Remove(c.path(name))
+			continue
+		}
+		onDisk[name] = e
+		modTimes[name] = modTime
+	}
+
+	// Keep the indexed order for entries that still have a data file
+	for _, e := range indexed {
+		if found, ok := onDisk[e.File]; ok && found.Key == e.Key {
+			c.cache[found.Key] = c.list.PushBack(found)
+			c.bytes += found.Size
+			delete(onDisk, e.File)
+		}
+	}
+	// Entries the index does not know about were written most recently
+	orphans := make([]*entry, 0, len(onDisk))
+	for _, e := range onDisk {
+		orphans = append(orphans, e)
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return modTimes[orphans[i].File].Before(modTimes[orphans[j].File])
+	})
+	for _, e := range orphans {
+		c.cache[e.Key] = c.list.PushFront(e)
+		c.bytes += e.Size
+	}
+
+	c.dirty = true
+	for c.list.Len() > 0 && c.bytes > c.maxBytes {
+		c.remove(c.list.Back()) // The budget may have been lowered since the last run
+	}
+	return c.flushIndex()
+}
+
+// readEntry reads the header of a data file and returns the entry it describes.
+func (c *LRUCache) readEntry(name string) (*entry, time.Time, error) {
+	file, err := os.Open(c.path(name))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	hdr, err := readHeader(bufio.NewReader(file))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if fileName(hdr.Key) != name {
+		return nil, time.Time{}, fmt.Errorf("data file %s holds key %s", name, hdr.Key)
+	}
+	return &entry{Key: hdr.Key, File: name, Size: info.Size(), ExpireAt: hdr.ExpireAt, Version: hdr.Version}, info.ModTime(), nil
+}
+
+// path returns the location of a data file.
+func (c *LRUCache) path(name string) string {
+	return filepath.Join(c.dir, dataDir, name)
+}
+
+// readHeader decodes the header line of a data file.
+func readHeader(reader *bufio.Reader) (header, error) {
+	var hdr header
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return hdr, err
+	}
+	err = json.Unmarshal(line, &hdr)
+	return hdr, err
+}
+
+// writeFileAtomic writes data to a temporary file, fsyncs it and renames it over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + tmpSuffix
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fileName maps a key to the name of its data file.
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// expired reports whether the entry has expired at now.
+func expired(e *entry, now time.Time) bool {
+	return !e.ExpireAt.IsZero() && e.ExpireAt.Before(now)
+}
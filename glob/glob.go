@@ -0,0 +1,88 @@
+// Package glob matches keys against Redis-style glob patterns, so every cache tier
+// interprets the patterns given to Keys and DeletePattern the same way Redis does.
+package glob
+
+// Match reports whether s matches pattern.
+// The pattern supports * (any sequence), ? (any single byte), [abc], [^abc] and [a-z] classes,
+// and \ to escape the next byte. Unlike path.Match, / has no special meaning.
+func Match(pattern, s string) bool {
+	// Position to retry from after the last *, so backtracking stays linear in practice
+	starPattern, starString := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starPattern, starString = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if end, ok := matchClass(pattern, p, s[i]); ok {
+					p = end
+					i++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == s[i] {
+					p += 2
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+		if starPattern < 0 {
+			return false
+		}
+		// Let the last * swallow one more byte and retry
+		starString++
+		p, i = starPattern+1, starString
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches b against the character class starting at pattern[start] == '['.
+// It returns the index just past the class and whether b is in it.
+// An unterminated class extends to the end of the pattern, like in Redis.
+func matchClass(pattern string, start int, b byte) (int, bool) {
+	p := start + 1
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+	matched := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			matched = matched || pattern[p] == b
+			p++
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (lo <= b && b <= hi)
+			p += 3
+		default:
+			matched = matched || pattern[p] == b
+			p++
+		}
+	}
+	if p < len(pattern) {
+		p++ // Skip the closing ]
+	}
+	return p, matched != negate
+}
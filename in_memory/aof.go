@@ -0,0 +1,521 @@
+package in_memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// FsyncPolicy controls how often the append-only file is flushed to disk.
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"   // fsync after every write
+	FsyncEverySec FsyncPolicy = "everysec" // fsync once per second in the background
+	FsyncNo       FsyncPolicy = "no"       // leave flushing to the operating system
+)
+
+// AOFOptions configures append-only file persistence for an LRUCache.
+type AOFOptions struct {
+	Path        string      // Location of the append-only file
+	Fsync       FsyncPolicy // When to fsync the file (defaults to everysec)
+	RewriteSize int64       // Compact the file once it grows beyond this many bytes (0 disables compaction)
+}
+
+// Operations recorded in the append-only file.
+const (
+	aofPut    = "put"
+	aofDel    = "del"
+	aofDelAll = "delall"
+	aofExpire = "expire"
+	aofTag    = "tag"
+	aofHSet   = "hset"
+	aofHDel   = "hdel"
+	aofLPush  = "lpush"
+	aofSAdd   = "sadd"
+	aofResize = "resize"
+)
+
+// aofRecord is a single line of the append-only file.
+type aofRecord struct {
+	Op       string
+	Key      string
+	Value    string
+	Length   int
+	ExpireAt int64 // Unix nanoseconds, 0 if the entry never expires
+	Version  uint64
+	Tags     []string
+	Type     string            // Type of a snapshot entry, empty for strings
+	Fields   map[string]string // Hash fields
+	Members  []string          // List items, set members or removed hash fields
+}
+
+// aofLine is the JSON encoding of an aofRecord. Values, the values of hash fields and list items, set members
+// or removed hash fields are base64-encoded, since json.Marshal replaces bytes that are not valid UTF-8.
+// Files written before carry them as plain strings under value, fields and members, which are still read.
+type aofLine struct {
+	Op       string            `json:"op"`
+	Key      string            `json:"key,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	Length   int               `json:"length,omitempty"`
+	ExpireAt int64             `json:"expire_at,omitempty"`
+	Version  uint64            `json:"version,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Hash     map[string][]byte `json:"hash,omitempty"`
+	Items    [][]byte          `json:"items,omitempty"`
+
+	Value   string            `json:"value,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Members []string          `json:"members,omitempty"`
+}
+
+// MarshalJSON encodes the record as an aofLine.
+func (r aofRecord) MarshalJSON() ([]byte, error) {
+	line := aofLine{
+		Op:       r.Op,
+		Key:      r.Key,
+		Length:   r.Length,
+		ExpireAt: r.ExpireAt,
+		Version:  r.Version,
+		Tags:     r.Tags,
+		Type:     r.Type,
+	}
+	if r.Value != "" {
+		line.Data = []byte(r.Value)
+	}
+	if r.Fields != nil {
+		line.Hash = make(map[string][]byte, len(r.Fields))
+		for field, value := range r.Fields {
+			line.Hash[field] = []byte(value)
+		}
+	}
+	for _, item := range r.Members {
+		line.Items = append(line.Items, []byte(item))
+	}
+	return json.Marshal(line)
+}
+
+// UnmarshalJSON decodes a record written by MarshalJSON or by an older version of the cache.
+func (r *aofRecord) UnmarshalJSON(data []byte) error {
+	var line aofLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return err
+	}
+	*r = aofRecord{
+		Op:       line.Op,
+		Key:      line.Key,
+		Value:    line.Value,
+		Length:   line.Length,
+		ExpireAt: line.ExpireAt,
+		Version:  line.Version,
+		Tags:     line.Tags,
+		Type:     line.Type,
+		Fields:   line.Fields,
+		Members:  line.Members,
+	}
+	if line.Data != nil {
+		r.Value = string(line.Data)
+	}
+	if line.Hash != nil {
+		r.Fields = make(map[string]string, len(line.Hash))
+		for field, value := range line.Hash {
+			r.Fields[field] = string(value)
+		}
+	}
+	for _, item := range line.Items {
+		r.Members = append(r.Members, string(item))
+	}
+	return nil
+}
+
+// aof holds the state of the append-only file. All fields are guarded by the owning cache's mutex.
+type aof struct {
+	file *os.File
+	opts AOFOptions
+
+	size       int64         // Current size of the file in bytes
+	baseSize   int64         // Size of the file right after the last rewrite
+	rewriting  bool          // Whether a background rewrite is in progress
+	rewriteBuf bytes.Buffer  // Records written while a rewrite is in progress
+	stop       chan struct{} // Closed to stop the everysec fsync goroutine
+}
+
+// NewLRUCacheWithAOF initializes an LRUCache backed by an append-only file.
+// Existing records in the file are replayed before the cache is returned.
+func NewLRUCacheWithAOF(cleanupTime time.Duration, opts AOFOptions) (*LRUCache, error) {
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncEverySec
+	}
+	switch opts.Fsync {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+	default:
+		return nil, fmt.Errorf("invalid fsync policy %q: must be always, everysec or no", opts.Fsync)
+	}
+
+	c := NewLRUCache(cleanupTime)
+	size, err := c.replayAOF(opts.Path)
+	if err != nil {
+		c.Close() // Stop the cleanup goroutine
+		return nil, err
+	}
+	file, err := os.OpenFile(opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.aof = &aof{file: file, opts: opts, size: size, baseSize: size, stop: make(chan struct{})}
+	if opts.Fsync == FsyncEverySec {
+		go c.startFsyncRoutine(c.aof)
+	}
+	return c, nil
+}
+
+// CloseAOF flushes and closes the append-only file. The cache keeps working without persistence.
+func (c *LRUCache) CloseAOF() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.aof == nil {
+		return nil
+	}
+	a := c.aof
+	c.aof = nil
+	close(a.stop)
+	if err := a.file.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// Snapshot writes the current contents of the cache to the file at path in the append-only file format,
+// replacing it only once the new file is complete. Restore or NewLRUCacheWithAOF read it back.
+func (c *LRUCache) Snapshot(path string) error {
+	c.mu.Lock()
+	records := c.snapshotAOF()
+	c.mu.Unlock()
+
+	tmpPath := path + ".tmp"
+	if _, err := writeAOFFile(tmpPath, records); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Restore adds the entries of a file written by Snapshot to the cache, skipping those that expired since.
+// A missing file restores nothing.
+func (c *LRUCache) Restore(path string) error {
+	_, err := c.replayAOF(path)
+	return err
+}
+
+// replayAOF applies every record in the file at path to the cache and returns the size of the valid data.
+// A truncated or corrupt final record is dropped and the file is truncated to the last complete record.
+func (c *LRUCache) replayAOF(path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reader := bufio.NewReader(file)
+	now := time.Now()
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// The last write was cut short, drop it
+				log.Printf("Truncating incomplete record at offset %d of %s", offset, path)
+				return offset, file.Truncate(offset)
+			}
+			return offset, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		var rec aofRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				log.Printf("Truncating corrupt record at offset %d of %s", offset, path)
+				return offset, file.Truncate(offset)
+			}
+			return 0, fmt.Errorf("corrupt record at offset %d of %s: %w", offset, path, err)
+		}
+		c.applyAOF(rec, now)
+		offset += int64(len(line))
+	}
+}
+
+// applyAOF replays a single record. The caller must hold c.mu.
+func (c *LRUCache) applyAOF(rec aofRecord, now time.Time) {
+	switch rec.Op {
+	case aofPut:
+		if rec.ExpireAt != 0 && time.Unix(0, rec.ExpireAt).Before(now) {
+			c.del(rec.Key) // Skip entries that expired while the cache was down
+			return
+		}
+		if _, applied := c.put(rec.Key, rec.Value, rec.Length, timeFromUnixNano(rec.ExpireAt), rec.Version); !applied {
+			return // A newer value was already replayed
+		}
+		if rec.Type != "" {
+			c.restore(c.cache[rec.Key].Value.(*CacheNode), rec)
+		}
+		if len(rec.Tags) > 0 {
+			c.tag(c.cache[rec.Key].Value.(*CacheNode), rec.Tags) // Snapshots carry the tags of each entry
+		}
+	case aofExpire:
+		if elem, found := c.cache[rec.Key]; found {
+			if rec.ExpireAt != 0 && time.Unix(0, rec.ExpireAt).Before(now) {
+				c.del(rec.Key)
+				return
+			}
+			elem.Value.(*CacheNode).expireAt = timeFromUnixNano(rec.ExpireAt)
+		}
+	case aofTag:
+		if elem, found := c.cache[rec.Key]; found {
+			c.tag(elem.Value.(*CacheNode), rec.Tags)
+		}
+	case aofHSet:
+		c.hset(rec.Key, rec.Fields, rec.Length, rec.Version)
+	case aofHDel:
+		c.hdel(rec.Key, rec.Members, rec.Version)
+	case aofLPush:
+		c.lpush(rec.Key, rec.Members, rec.Length, rec.Version)
+	case aofSAdd:
+		c.sadd(rec.Key, rec.Members, rec.Length, rec.Version)
+	case aofDel:
+		c.del(rec.Key)
+	case aofDelAll:
+		c.clear()
+	case aofResize:
+		c.shrink(rec.Length)
+	}
+}
+
+// restore turns a node stored by a snapshot record into the hash, list or set the record describes.
+// The caller must hold c.mu.
+func (c *LRUCache) restore(node *CacheNode, rec aofRecord) {
+	node.kind = kindByName[rec.Type]
+	size := int64(len(node.key))
+	switch node.kind {
+	case kindHash:
+		node.hash = make(map[string]string, len(rec.Fields))
+		for field, value := range rec.Fields {
+			node.hash[field] = value
+			size += int64(len(field) + len(value))
+		}
+	case kindList:
+		node.items = rec.Members
+		for _, item := range rec.Members {
+			size += int64(len(item))
+		}
+	case kindSet:
+		node.members = make(map[string]struct{}, len(rec.Members))
+		for _, member := range rec.Members {
+			node.members[member] = struct{}{}
+			size += int64(len(member))
+		}
+	}
+	c.grow(node, size-node.size)
+}
+
+// logAOF appends a record to the append-only file if persistence is enabled. The caller must hold c.mu.
+func (c *LRUCache) logAOF(rec aofRecord) {
+	if c.aof == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Error encoding AOF record: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	if _, err := c.aof.file.Write(line); err != nil {
+		log.Printf("Error writing to AOF %s: %v", c.aof.opts.Path, err)
+		return
+	}
+	if c.aof.opts.Fsync == FsyncAlways {
+		if err := c.aof.file.Sync(); err != nil {
+			log.Printf("Error syncing AOF %s: %v", c.aof.opts.Path, err)
+		}
+	}
+	c.aof.size += int64(len(line))
+	if c.aof.rewriting {
+		c.aof.rewriteBuf.Write(line) // Keep writes made during the rewrite so they are not lost
+		return
+	}
+	if c.aof.opts.RewriteSize > 0 && c.aof.size >= c.aof.opts.RewriteSize && c.aof.size >= 2*c.aof.baseSize {
+		c.aof.rewriting = true
+		go c.rewriteAOF(c.aof)
+	}
+}
+
+// rewriteAOF compacts the append-only file by writing the current cache contents to a new file.
+// The snapshot is written without holding the lock; writes made meanwhile are buffered and appended before the swap.
+func (c *LRUCache) rewriteAOF(a *aof) {
+	c.mu.Lock()
+	records := c.snapshotAOF()
+	c.mu.Unlock()
+
+	tmpPath := a.opts.Path + ".rewrite"
+	size, err := writeAOFFile(tmpPath, records)
+	if err != nil {
+		log.Printf("Error rewriting AOF %s: %v", a.opts.Path, err)
+		os.Remove(tmpPath)
+		c.mu.Lock()
+		a.rewriting = false
+		a.rewriteBuf.Reset()
+		c.mu.Unlock()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer func() {
+		a.rewriting = false
+		a.rewriteBuf.Reset()
+	}()
+	if c.aof != a {
+		os.Remove(tmpPath) // The file was closed while rewriting
+		return
+	}
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		log.Printf("Error reopening rewritten AOF %s: %v", tmpPath, err)
+		os.Remove(tmpPath)
+		return
+	}
+	n, err := tmp.Write(a.rewriteBuf.Bytes())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, a.opts.Path)
+	}
+	if err != nil {
+		log.Printf("Error swapping rewritten AOF %s: %v", a.opts.Path, err)
+		tmp.Close()
+		os.Remove(tmpPath)
+		return
+	}
+	a.file.Close()
+	a.file = tmp
+	a.size = size + int64(n)
+	a.baseSize = a.size
+}
+
+// snapshotAOF returns records that rebuild the current cache contents, least recently used first. The caller must hold c.mu.
+func (c *LRUCache) snapshotAOF() []aofRecord {
+	now := time.Now()
+	records := make([]aofRecord, 0, c.list.Len())
+	for elem := c.list.Back(); elem != nil; elem = elem.Prev() {
+		node := elem.Value.(*CacheNode)
+		if !node.expireAt.IsZero() && node.expireAt.Before(now) {
+			continue
+		}
+		rec := aofRecord{
+			Op:       aofPut,
+			Key:      node.key,
+			Value:    node.value,
+			ExpireAt: unixNano(node.expireAt),
+			Version:  node.version,
+			Tags:     node.tags,
+		}
+		switch node.kind {
+		case kindHash:
+			rec.Fields = make(map[string]string, len(node.hash))
+			for field, value := range node.hash {
+				rec.Fields[field] = value
+			}
+		case kindList:
+			rec.Members = append([]string(nil), node.items...)
+		case kindSet:
+			for member := range node.members {
+				rec.Members = append(rec.Members, member)
+			}
+		}
+		if node.kind != kindString {
+			rec.Type = kindNames[node.kind]
+		}
+		records = append(records, rec)
+	}
+	// Replaying with the snapshot size as the length guarantees no entry is evicted on startup
+	for i := range records {
+		records[i].Length = len(records)
+	}
+	return records
+}
+
+// writeAOFFile writes records to a new file at path, fsyncs it and returns its size.
+func writeAOFFile(path string, records []aofRecord) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	var size int64
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return 0, err
+		}
+		line = append(line, '\n')
+		if _, err := w.Write(line); err != nil {
+			return 0, err
+		}
+		size += int64(len(line))
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return size, file.Sync()
+}
+
+// startFsyncRoutine fsyncs the append-only file once per second until it is closed.
+func (c *LRUCache) startFsyncRoutine(a *aof) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			file := a.file
+			c.mu.Unlock()
+			// A rewrite may swap and close the file concurrently; that error is harmless
+			if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+				log.Printf("Error syncing AOF %s: %v", a.opts.Path, err)
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// unixNano converts an expiration time to Unix nanoseconds, keeping the zero time as 0.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// timeFromUnixNano is the inverse of unixNano.
+func timeFromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,60 @@
+package in_memory
+
+import "time"
+
+// Item is a key-value pair for bulk writes. A Version of 0 assigns the next version of the cache.
+type Item struct {
+	Key     string
+	Value   string
+	Version uint64
+}
+
+// MGet retrieves the values of several keys under a single lock acquisition.
+// Found keys are marked as recently used in order; missing or expired keys yield an empty string.
+func (c *LRUCache) MGet(keys []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		node := c.lookup(key, now)
+		if node != nil {
+			c.list.MoveToFront(c.cache[key])
+			node.lastAccess = now
+			node.accessCount++
+			values[i] = node.value
+		}
+		if node != nil && node.kind == kindString {
+			c.stats.Hits++
+		} else {
+			c.stats.Misses++
+		}
+	}
+	return values
+}
+
+// MSet stores several key-value pairs with the same TTL under a single lock acquisition.
+// Items are stored in order, so the last item ends up most recently used. It returns the stored versions.
+func (c *LRUCache) MSet(items []Item, length int, ttl int) []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	versions := make([]uint64, len(items))
+	for i, item := range items {
+		versions[i] = c.putTTL(item.Key, item.Value, length, ttl, item.Version)
+	}
+	return versions
+}
+
+// MDel deletes several keys under a single lock acquisition and returns how many were found.
+func (c *LRUCache) MDel(keys []string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	for _, key := range keys {
+		if c.del(key) {
+			c.logAOF(aofRecord{Op: aofDel, Key: key})
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,73 @@
+package in_memory
+
+import (
+	"container/list"
+	"time"
+)
+
+// Entry is a single cache entry as reported by Entries.
+type Entry struct {
+	Key   string
+	Value string        // Value of a string, empty for hashes, lists and sets
+	Type  string        // Type of the value as reported by Type
+	TTL   time.Duration // Remaining time to live, NoExpiration if the entry never expires
+	Rank  int           // Position in recency order, 0 for the most recently used entry; expired entries keep theirs
+
+	Version uint64 // Version of the value, as assigned by Redis or by this cache
+}
+
+// entriesBatchSize is the number of entries Entries copies under the lock at a time.
+const entriesBatchSize = 100
+
+// Entries calls fn for every live entry from most to least recently used, starting at rank offset and stopping
+// early if fn returns false. Entries are copied under the lock in small batches and fn is called without it,
+// so fn may safely use the cache. Each batch resumes after the last entry of the previous one; an entry moved
+// in between may be skipped or seen twice. Iterating does not change the recency of any entry.
+func (c *LRUCache) Entries(offset int, fn func(Entry) bool) {
+	var last *list.Element
+	rank := offset
+	for {
+		var entries []Entry
+		var more bool
+		entries, last, rank, more = c.entriesBatch(last, rank)
+		for _, entry := range entries {
+			if !fn(entry) {
+				return
+			}
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// entriesBatch copies up to entriesBatchSize live entries, resuming after last if it is still cached and
+// otherwise at rank. It returns the entries, the last element it walked with the rank following it, and
+// whether more elements remain.
+func (c *LRUCache) entriesBatch(last *list.Element, rank int) ([]Entry, *list.Element, int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem := c.list.Front()
+	if last != nil && c.cache[last.Value.(*CacheNode).key] == last {
+		elem = last.Next()
+	} else {
+		for i := 0; i < rank && elem != nil; i++ {
+			elem = elem.Next()
+		}
+	}
+	now := time.Now()
+	entries := make([]Entry, 0, entriesBatchSize)
+	for ; elem != nil && len(entries) < entriesBatchSize; elem = elem.Next() {
+		last = elem
+		node := elem.Value.(*CacheNode)
+		if node.expireAt.IsZero() || node.expireAt.After(now) { // The cleanup routine removes expired entries
+			ttl := NoExpiration
+			if !node.expireAt.IsZero() {
+				ttl = node.expireAt.Sub(now)
+			}
+			entries = append(entries, Entry{Key: node.key, Value: node.value, Type: kindNames[node.kind], TTL: ttl, Rank: rank, Version: node.version})
+		}
+		rank++
+	}
+	return entries, last, rank, elem != nil
+}
@@ -2,7 +2,10 @@ package in_memory
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -10,18 +13,64 @@ import (
 
 // CacheNode represents a single node in the LRU cache with a key-value pair and expiration time.
 type CacheNode struct {
-	key      string    // Key of the cache entry
-	value    string    // Value associated with the key
-	expireAt time.Time // Expiration time for the cache entry (zero time if no expiration)
+	key      string              // Key of the cache entry
+	value    string              // Value associated with the key, empty unless kind is kindString
+	kind     valueKind           // Type of the value
+	hash     map[string]string   // Fields of a hash value
+	items    []string            // Items of a list value, head first
+	members  map[string]struct{} // Members of a set value
+	size     int64               // Size of the key and value in bytes
+	expireAt time.Time           // Expiration time for the cache entry (zero time if no expiration)
+	version  uint64              // Version of the value, increased on every write
+	tags     []string            // Tags attached to the key, kept until the key is removed
+
+	createdAt   time.Time // Time the key was first stored
+	lastAccess  time.Time // Time of the last read or write
+	accessCount int64     // Number of reads through Get
+}
+
+// EntryInfo holds metadata about a cache entry.
+type EntryInfo struct {
+	CreatedAt   time.Time     // Time the key was first stored
+	LastAccess  time.Time     // Time of the last read or write
+	TTL         time.Duration // Remaining time to live, NoExpiration if the entry never expires
+	AccessCount int64         // Number of reads through Get
+	Size        int           // Size of the key and value in bytes
+	Version     uint64        // Version of the value
 }
 
+// ErrNotInteger is returned by IncrBy when the stored value is not an integer or the result would overflow.
+var ErrNotInteger = errors.New("value is not an integer or out of range")
+
+// TTL values reported for keys without a remaining time to live.
+const (
+	NoExpiration time.Duration = -1 // The key exists but never expires
+	KeyNotFound  time.Duration = -2 // The key does not exist
+)
+
 // LRUCache implements a Least Recently Used (LRU) cache using a map and a doubly linked list.
+// Unlike the Redis tier, its methods take no context: they only wait on the mutex of the cache, held for
+// the duration of a map or list operation, so there is nothing a caller could cancel or time out.
 type LRUCache struct {
-	cache map[string]*list.Element // Map for fast access to cache elements
-	list  *list.List               // Doubly linked list to track access order
+	cache map[string]*list.Element       // Map for fast access to cache elements
+	keys  []string                       // Every key of cache in sorted order when it was last listed, see sortedKeys
+	list  *list.List                     // Doubly linked list to track access order
+	tags  map[string]map[string]struct{} // Keys carrying each tag
 
-	cleanupTime time.Duration // Time interval for periodic cleanup of expired entries
-	mu          sync.Mutex    // Mutex for concurrent access to cache data structures
+	cleanupTime time.Duration      // Time interval for periodic cleanup of expired entries
+	lastCleanup time.Time          // Time the cleanup goroutine last ran, or the interval last started
+	interval    chan time.Duration // Sends a new cleanup interval to the cleanup goroutine
+	stop        chan struct{}      // Closed by Close to stop the cleanup goroutine
+	closeOnce   sync.Once          // Makes Close safe to call more than once
+	mu          sync.Mutex         // Mutex for concurrent access to cache data structures
+	version     uint64             // Last version handed out, versions never repeat within a cache
+	evictions   uint64             // Number of entries evicted to stay within the length
+	resized     uint64             // Number of those evictions made by Resize
+	bytes       int64              // Size of all keys and values in bytes
+	stats       Stats              // Counts of operations; Evictions, Entries and Bytes are filled in by Stats
+	keysStale   bool               // Whether keys were added or removed since keys was sorted
+
+	aof *aof // Append-only file, nil when persistence is disabled
 }
 
 // NewLRUCache initializes and returns a new LRUCache instance.
@@ -29,37 +78,156 @@ func NewLRUCache(cleanupTime time.Duration) *LRUCache {
 	c := &LRUCache{
 		cache: make(map[string]*list.Element),
 		list:  list.New(),
+		tags:  make(map[string]map[string]struct{}),
 
 		cleanupTime: cleanupTime,
+		lastCleanup: time.Now(),
+		interval:    make(chan time.Duration),
+		stop:        make(chan struct{}),
 	}
-	go c.startCleanupRoutine() // Start a goroutine for periodic cache cleanup
+	go c.startCleanupRoutine(cleanupTime) // Start a goroutine for periodic cache cleanup
 	return c
 }
 
 // startCleanupRoutine starts a background goroutine to clean up expired items from the cache periodically.
-func (c *LRUCache) startCleanupRoutine() {
-	ticker := time.NewTicker(c.cleanupTime)
+func (c *LRUCache) startCleanupRoutine(cleanupTime time.Duration) {
+	ticker := time.NewTicker(cleanupTime)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			c.cleanup()
+		case d := <-c.interval:
+			ticker.Reset(d) // The same goroutine keeps running with the new interval
+		case <-c.stop:
+			return
 		}
 	}
 }
 
+// CleanupInterval returns how often expired entries are removed.
+func (c *LRUCache) CleanupInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cleanupTime
+}
+
+// LastCleanup returns when the cleanup goroutine last removed expired entries, or when the current
+// interval started if it has not run since. It stops advancing once the cache is closed.
+func (c *LRUCache) LastCleanup() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastCleanup
+}
+
+// SetCleanupInterval changes how often expired entries are removed, starting a new interval now.
+// It panics if d is not positive and does nothing once the cache is closed.
+func (c *LRUCache) SetCleanupInterval(d time.Duration) {
+	if d <= 0 {
+		panic("in_memory: non-positive cleanup interval")
+	}
+	select {
+	case c.interval <- d:
+		c.mu.Lock()
+		c.cleanupTime = d
+		c.lastCleanup = time.Now()
+		c.mu.Unlock()
+	case <-c.stop:
+	}
+}
+
+// Close stops the cleanup goroutine and closes the append-only file, if any.
+// Expired entries are still never returned, but they are only removed when accessed.
+func (c *LRUCache) Close() error {
+	c.closeOnce.Do(func() { close(c.stop) })
+	return c.CloseAOF()
+}
+
+// Len returns the number of entries in the cache, including expired entries not yet cleaned up.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.list.Len()
+}
+
+// Resize evicts the least recently used entries until at most length remain and returns how many were evicted.
+// Later writes keep the cache within the length they are given.
+func (c *LRUCache) Resize(length int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	evicted := c.shrink(length)
+	if evicted > 0 {
+		c.logAOF(aofRecord{Op: aofResize, Length: length})
+	}
+	return evicted
+}
+
+// shrink evicts the least recently used entries until at most length remain. The caller must hold c.mu.
+func (c *LRUCache) shrink(length int) int {
+	evicted := 0
+	for c.list.Len() > max(length, 0) {
+		c.evict()
+		evicted++
+	}
+	c.resized += uint64(evicted)
+	return evicted
+}
+
+// Reasons for evicting entries, as reported by Stats.
+const (
+	EvictCapacity = "capacity" // A new entry did not fit within the length
+	EvictResize   = "resize"   // Resize shrank the cache
+)
+
+// Stats counts what happened in a cache since it was created.
+type Stats struct {
+	Hits        uint64            // Reads of a string value that found it
+	Misses      uint64            // Reads of a string value that did not find it, including hashes, lists and sets
+	Sets        uint64            // Values stored, including those replayed from an append-only file
+	Deletes     uint64            // Entries deleted on request, not counting expirations and evictions
+	Expirations uint64            // Entries removed because their TTL ran out
+	Evictions   map[string]uint64 // Entries evicted to stay within the length, by reason such as EvictCapacity
+	Entries     int               // Entries currently held, including expired entries not yet cleaned up
+	Bytes       int64             // Size of all keys and values currently held, in bytes
+}
+
+// Stats returns the counts of operations of the cache and its current size.
+func (c *LRUCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Evictions = map[string]uint64{
+		EvictCapacity: c.evictions - c.resized,
+		EvictResize:   c.resized,
+	}
+	stats.Entries = c.list.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Evictions returns how many entries were evicted to stay within the length.
+func (c *LRUCache) Evictions() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evictions
+}
+
 // cleanup removes expired items from the cache.
 func (c *LRUCache) cleanup() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	now := time.Now()
+	c.lastCleanup = time.Now()
+	c.removeExpired(c.lastCleanup)
+}
+
+// removeExpired removes the items that expired before now. The caller must hold c.mu.
+func (c *LRUCache) removeExpired(now time.Time) {
 	for elem := c.list.Front(); elem != nil; {
 		next := elem.Next()
 		node := elem.Value.(*CacheNode)
 		if !node.expireAt.IsZero() && node.expireAt.Before(now) {
 			// Remove expired node from the linked list and delete from map
-			c.list.Remove(elem)
-			delete(c.cache, node.key)
+			c.expire(elem)
 		}
 		elem = next
 	}
@@ -68,60 +236,381 @@ func (c *LRUCache) cleanup() {
 // Get retrieves the value associated with the given key.
 // It moves the accessed element to the front of the list to mark it as recently used.
 func (c *LRUCache) Get(key string) string {
+	value, _ := c.GetWithVersion(key)
+	return value
+}
+
+// GetWithVersion retrieves the value and version associated with the given key like Get.
+// The version is 0 if the key is not found or has expired.
+func (c *LRUCache) GetWithVersion(key string) (string, uint64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if elem, found := c.cache[key]; found {
 		node := elem.Value.(*CacheNode)
-		if node.expireAt.IsZero() || node.expireAt.After(time.Now()) {
+		if now := time.Now(); node.expireAt.IsZero() || node.expireAt.After(now) {
 			c.list.MoveToFront(elem) // Move accessed item to the front of the list
-			return node.value
+			node.lastAccess = now
+			node.accessCount++
+			if node.kind != kindString {
+				c.stats.Misses++
+				return "", 0 // Hashes, lists and sets have no string value
+			}
+			c.stats.Hits++
+			return node.value, node.version
 		}
 		// Remove the expired element from both the list and the map
-		c.list.Remove(elem)
-		delete(c.cache, key)
+		c.expire(elem)
+	}
+	c.stats.Misses++
+	return "", 0 // Return empty string if key not found or expired
+}
+
+// Peek returns the value associated with the given key without changing its recency or access statistics.
+func (c *LRUCache) Peek(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node := c.lookup(key, time.Now()); node != nil {
+		return node.value
 	}
 	return "" // Return empty string if key not found or expired
 }
 
+// Inspect returns metadata about the given key without changing its recency.
+// The boolean is false if the key is not found or has expired.
+func (c *LRUCache) Inspect(key string) (EntryInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	node := c.lookup(key, now)
+	if node == nil {
+		return EntryInfo{}, false
+	}
+	ttl := NoExpiration
+	if !node.expireAt.IsZero() {
+		ttl = node.expireAt.Sub(now)
+	}
+	return EntryInfo{
+		CreatedAt:   node.createdAt,
+		LastAccess:  node.lastAccess,
+		TTL:         ttl,
+		AccessCount: node.accessCount,
+		Size:        int(node.size),
+		Version:     node.version,
+	}, true
+}
+
+// Expire sets the time to live of an existing key without rewriting its value.
+// A non-positive duration deletes the key. It reports whether the key was found.
+func (c *LRUCache) Expire(key string, d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lookup(key, time.Now()) == nil {
+		return false
+	}
+	if d <= 0 {
+		c.del(key)
+		c.logAOF(aofRecord{Op: aofDel, Key: key})
+		return true
+	}
+	expireAt := time.Now().Add(d)
+	c.cache[key].Value.(*CacheNode).expireAt = expireAt
+	c.logAOF(aofRecord{Op: aofExpire, Key: key, ExpireAt: unixNano(expireAt)})
+	return true
+}
+
+// Persist removes the expiration of an existing key. It reports whether the key was found.
+func (c *LRUCache) Persist(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.lookup(key, time.Now())
+	if node == nil {
+		return false
+	}
+	node.expireAt = time.Time{}
+	c.logAOF(aofRecord{Op: aofExpire, Key: key})
+	return true
+}
+
+// Touch marks an existing key as recently used without reading it. It reports whether the key was found.
+func (c *LRUCache) Touch(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	node := c.lookup(key, now)
+	if node == nil {
+		return false
+	}
+	c.list.MoveToFront(c.cache[key])
+	node.lastAccess = now
+	return true
+}
+
+// TTL returns the remaining time to live of the given key,
+// NoExpiration if it never expires or KeyNotFound if it does not exist.
+func (c *LRUCache) TTL(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	node := c.lookup(key, now)
+	if node == nil {
+		return KeyNotFound
+	}
+	if node.expireAt.IsZero() {
+		return NoExpiration
+	}
+	return node.expireAt.Sub(now)
+}
+
+// lookup returns the live node for key without touching recency, removing it if it has expired.
+// The caller must hold c.mu.
+func (c *LRUCache) lookup(key string, now time.Time) *CacheNode {
+	elem, found := c.cache[key]
+	if !found {
+		return nil
+	}
+	node := elem.Value.(*CacheNode)
+	if !node.expireAt.IsZero() && !node.expireAt.After(now) {
+		// Remove the expired element from both the list and the map
+		c.expire(elem)
+		return nil
+	}
+	return node
+}
+
 // Put adds a key-value pair to the cache with an optional TTL.
 // If the key already exists, it updates the value and moves the element to the front.
 // If the cache exceeds maxLength, it evicts the least recently used element.
 func (c *LRUCache) Put(key string, value string, length int, ttl int) {
+	c.PutWithVersion(key, value, length, ttl, 0)
+}
+
+// PutWithVersion stores a key-value pair like Put with the given version, typically one assigned by
+// another tier. A version of 0 assigns the next version of this cache. A write older than the version
+// already stored is ignored, so mirrored writes cannot go back in time. It returns the stored version.
+func (c *LRUCache) PutWithVersion(key string, value string, length int, ttl int, version uint64) uint64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.putTTL(key, value, length, ttl, version)
+}
+
+// SetNX stores the key-value pair only if the key does not exist. It reports whether the value was stored.
+func (c *LRUCache) SetNX(key string, value string, length int, ttl int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lookup(key, time.Now()) != nil {
+		return false
+	}
+	c.putTTL(key, value, length, ttl, 0)
+	return true
+}
+
+// SetXX stores the key-value pair only if the key already exists. It reports whether the value was stored.
+func (c *LRUCache) SetXX(key string, value string, length int, ttl int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lookup(key, time.Now()) == nil {
+		return false
+	}
+	c.putTTL(key, value, length, ttl, 0)
+	return true
+}
+
+// GetSet stores the key-value pair and returns the previous value.
+// The boolean reports whether the key existed before.
+func (c *LRUCache) GetSet(key string, value string, length int, ttl int) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, existed := "", false
+	if node := c.lookup(key, time.Now()); node != nil {
+		old, existed = node.value, true
+	}
+	c.putTTL(key, value, length, ttl, 0)
+	return old, existed
+}
+
+// CompareAndSwap stores newValue only if the key exists and currently holds oldValue.
+// It reports whether the value was swapped.
+func (c *LRUCache) CompareAndSwap(key string, oldValue string, newValue string, length int, ttl int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.lookup(key, time.Now())
+	if node == nil || node.kind != kindString || node.value != oldValue {
+		return false
+	}
+	c.putTTL(key, newValue, length, ttl, 0)
+	return true
+}
+
+// CompareVersionAndSwap stores the value only if the key exists and its version equals version.
+// It returns the new version and whether the value was stored.
+func (c *LRUCache) CompareVersionAndSwap(key string, version uint64, value string, length int, ttl int) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.lookup(key, time.Now())
+	if node == nil || node.version != version {
+		return 0, false
+	}
+	return c.putTTL(key, value, length, ttl, 0), true
+}
+
+// putTTL stores the entry with a TTL in seconds and returns its version. The caller must hold c.mu.
+func (c *LRUCache) putTTL(key string, value string, length int, ttl int, version uint64) uint64 {
+	expireAt := time.Time{}
+	if ttl > 0 {
+		expireAt = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	return c.store(key, value, length, expireAt, version)
+}
+
+// store stores the entry, records it in the append-only file and returns its version. A write turned away
+// by put is not recorded, so replaying the file cannot bring it back. The caller must hold c.mu.
+func (c *LRUCache) store(key string, value string, length int, expireAt time.Time, version uint64) uint64 {
+	version, applied := c.put(key, value, length, expireAt, version)
+	if applied {
+		c.logAOF(aofRecord{Op: aofPut, Key: key, Value: value, Length: length, ExpireAt: unixNano(expireAt), Version: version})
+	}
+	return version
+}
+
+// PutKeepTTL stores a key-value pair like PutWithVersion but keeps the current expiration of an existing key.
+// New keys are stored without expiration. It returns the stored version.
+func (c *LRUCache) PutKeepTTL(key string, value string, length int, version uint64) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireAt := time.Time{}
+	if node := c.lookup(key, time.Now()); node != nil {
+		expireAt = node.expireAt
+	}
+	return c.store(key, value, length, expireAt, version)
+}
+
+// PutWithExpiration stores a key-value pair like PutWithVersion with a TTL given as a duration, for values whose
+// remaining time to live another tier reports. A negative TTL stores the value without expiration.
+func (c *LRUCache) PutWithExpiration(key string, value string, length int, ttl time.Duration, version uint64) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireAt := time.Time{}
+	if ttl >= 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	return c.store(key, value, length, expireAt, version)
+}
+
+// SetVersion replaces the version of the value of an existing key, even with an older version, for a value
+// another tier has just assigned a new version to. The change is not recorded in the append-only file.
+// It reports whether the key was found.
+func (c *LRUCache) SetVersion(key string, version uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.lookup(key, time.Now())
+	if node == nil {
+		return false
+	}
+	node.version = version
+	if version > c.version {
+		c.version = version // Keep handing out versions above any version seen
+	}
+	return true
+}
+
+// IncrBy atomically adds delta to the integer value of key and returns the new value.
+// A missing key counts as 0 and is created without expiration; an existing key keeps its expiration.
+func (c *LRUCache) IncrBy(key string, delta int64, length int) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var current int64
+	expireAt := time.Time{}
+	if node := c.lookup(key, time.Now()); node != nil {
+		if node.kind != kindString {
+			return 0, ErrWrongType
+		}
+		n, err := strconv.ParseInt(node.value, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		current = n
+		expireAt = node.expireAt
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrNotInteger
+	}
+	current += delta
+	c.store(key, strconv.FormatInt(current, 10), length, expireAt, 0)
+	return current, nil
+}
+
+// Update replaces the string value of key with the result of fn, reading and writing it under the lock of the
+// cache so that concurrent updates never overwrite each other. The key keeps its expiration and gets a new version.
+// It returns the new value, its version and whether the key was found; fn is not called for a missing key,
+// a key holding another type fails with ErrWrongType and errors of fn are returned as they are.
+func (c *LRUCache) Update(key string, length int, fn func(value string) (string, error)) (string, uint64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.lookup(key, time.Now())
+	if node == nil {
+		return "", 0, false, nil
+	}
+	if node.kind != kindString {
+		return "", 0, true, ErrWrongType
+	}
+	value, err := fn(node.value)
+	if err != nil {
+		return "", 0, true, err
+	}
+	return value, c.store(key, value, length, node.expireAt, 0), true, nil
+}
+
+// put stores the entry with an absolute expiration time and returns its version and whether it was stored.
+// A version of 0 assigns the next version of this cache. A write older than the stored value is turned away,
+// returning the version of that value. The caller must hold c.mu.
+func (c *LRUCache) put(key string, value string, length int, expireAt time.Time, version uint64) (uint64, bool) {
+	if version == 0 {
+		c.version++
+		version = c.version
+	} else if version > c.version {
+		c.version = version // Keep handing out versions above any version seen
+	}
+	now := time.Now()
 	if elem, found := c.cache[key]; found {
 		node := elem.Value.(*CacheNode)
-		node.value = value
-		if ttl > 0 {
-			node.expireAt = time.Now().Add(time.Duration(ttl) * time.Second)
-		} else {
-			node.expireAt = time.Time{} // Reset expiration if ttl <= 0
+		if node.version > version {
+			return node.version, false // A newer value was already stored
+		}
+		c.stats.Sets++
+		if node.kind != kindString {
+			node.kind, node.hash, node.items, node.members = kindString, nil, nil, nil // Overwrite any type like SET
 		}
+		c.grow(node, int64(len(key)+len(value))-node.size)
+		node.value = value
+		node.expireAt = expireAt // Zero time resets expiration
+		node.version = version
+		node.lastAccess = now
 		c.list.MoveToFront(elem) // Move existing item to the front
-		return
+		return version, true
 	}
+	c.stats.Sets++
 	if c.list.Len() >= length {
 		c.evict() // Evict least recently used element if cache is full
 	}
 	// Add new element to the front of the list
-	expireAt := time.Time{}
-	if ttl > 0 {
-		expireAt = time.Now().Add(time.Duration(ttl) * time.Second)
-	}
-	newNode := &CacheNode{key: key, value: value, expireAt: expireAt}
+	newNode := &CacheNode{key: key, value: value, expireAt: expireAt, version: version, createdAt: now, lastAccess: now}
 	entry := c.list.PushFront(newNode)
 	c.cache[key] = entry
+	c.keysStale = true
+	c.grow(newNode, int64(len(key)+len(value)))
+	return version, true
 }
 
 // evict removes the least recently used element from the cache.
 func (c *LRUCache) evict() {
 	if evicted := c.list.Back(); evicted != nil {
-		c.list.Remove(evicted)
-		delete(c.cache, evicted.Value.(*CacheNode).key)
+		c.remove(evicted)
+		c.evictions++
 	}
 }
 
 // Print returns a string representation of the cache contents in order from most to least recently used.
+// The format is ambiguous for keys or values containing ":" or ", "; use Entries to read entries reliably.
 func (c *LRUCache) Print() string {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -133,8 +622,7 @@ func (c *LRUCache) Print() string {
 		if node.expireAt.IsZero() || node.expireAt.After(now) {
 			orderedItems = append(orderedItems, fmt.Sprintf("%s:%s", node.key, node.value))
 		} else {
-			c.list.Remove(elem)
-			delete(c.cache, node.key)
+			c.expire(elem)
 		}
 		elem = next
 	}
@@ -145,16 +633,62 @@ func (c *LRUCache) Print() string {
 func (c *LRUCache) DEL_ALL() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.clear()
+	c.logAOF(aofRecord{Op: aofDelAll})
+}
+
+// clear empties the cache. The caller must hold c.mu.
+func (c *LRUCache) clear() {
 	c.list.Init()                            // Clear the linked list
 	c.cache = make(map[string]*list.Element) // Reset the cache map
+	c.keys, c.keysStale = nil, false
+	c.tags = make(map[string]map[string]struct{})
+	c.bytes = 0
 }
 
 // Del deletes a key-value pair from the cache.
 func (c *LRUCache) Del(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if elem, found := c.cache[key]; found {
-		c.list.Remove(elem)                          // Remove element from linked list
-		delete(c.cache, elem.Value.(*CacheNode).key) // Delete from cache map
+	if c.del(key) {
+		c.logAOF(aofRecord{Op: aofDel, Key: key})
 	}
 }
+
+// DelVersion deletes the key only if it still holds the given version and reports whether it was deleted.
+func (c *LRUCache) DelVersion(key string, version uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.cache[key]; !found || elem.Value.(*CacheNode).version != version || !c.del(key) {
+		return false
+	}
+	c.logAOF(aofRecord{Op: aofDel, Key: key})
+	return true
+}
+
+// del removes the key if present and reports whether it was found. The caller must hold c.mu.
+func (c *LRUCache) del(key string) bool {
+	elem, found := c.cache[key]
+	if !found {
+		return false
+	}
+	c.remove(elem)
+	c.stats.Deletes++
+	return true
+}
+
+// expire removes an element whose TTL ran out. The caller must hold c.mu.
+func (c *LRUCache) expire(elem *list.Element) {
+	c.remove(elem)
+	c.stats.Expirations++
+}
+
+// remove unlinks an element from the list, the map and the tag index. The caller must hold c.mu.
+func (c *LRUCache) remove(elem *list.Element) {
+	node := elem.Value.(*CacheNode)
+	c.list.Remove(elem)       // Remove element from linked list
+	delete(c.cache, node.key) // Delete from cache map
+	c.keysStale = true
+	c.bytes -= node.size
+	c.untag(node)
+}
@@ -0,0 +1,66 @@
+package in_memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/glob"
+)
+
+// Keys returns up to limit live keys matching the Redis-style glob pattern, walking the keys in sorted order.
+// Listing starts after cursor, the last key of the previous page ("" for the first page), and the returned
+// cursor is "" once every key has been listed. Keys added or removed between pages behave like in a SCAN:
+// a key present for the whole walk is returned exactly once. A limit of zero or less returns every key.
+func (c *LRUCache) Keys(pattern string, cursor string, limit int) ([]string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	keys := []string{}
+	sorted := c.sortedKeys()
+	i := sort.SearchStrings(sorted, cursor)
+	if i < len(sorted) && sorted[i] == cursor {
+		i++
+	}
+	for ; i < len(sorted); i++ {
+		key := sorted[i]
+		// Expired keys are dropped by lookup
+		if !glob.Match(pattern, key) || c.lookup(key, now) == nil {
+			continue
+		}
+		if limit > 0 && len(keys) == limit {
+			return keys, keys[limit-1] // More keys follow this page
+		}
+		keys = append(keys, key)
+	}
+	return keys, ""
+}
+
+// sortedKeys returns every key of the cache in sorted order. Writes only mark the order stale, so the keys are
+// sorted again when listed after a key was added or removed rather than on every write. The caller must hold c.mu.
+func (c *LRUCache) sortedKeys() []string {
+	if c.keysStale {
+		c.keys = make([]string, 0, len(c.cache))
+		for key := range c.cache {
+			c.keys = append(c.keys, key)
+		}
+		sort.Strings(c.keys)
+		c.keysStale = false
+	}
+	return c.keys
+}
+
+// DeletePattern deletes every key matching the Redis-style glob pattern and returns how many were deleted.
+func (c *LRUCache) DeletePattern(pattern string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	deleted := 0
+	for key := range c.cache {
+		// Expired keys are dropped by lookup without being counted
+		if glob.Match(pattern, key) && c.lookup(key, now) != nil && c.del(key) {
+			c.logAOF(aofRecord{Op: aofDel, Key: key})
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,87 @@
+package in_memory
+
+import (
+	"errors"
+	"time"
+)
+
+// Quota limits how much a cache may hold. Zero fields are not enforced.
+type Quota struct {
+	MaxEntries int   // Maximum number of entries
+	MaxBytes   int64 // Maximum size of all keys and values in bytes
+}
+
+// Errors returned by CheckQuota.
+var (
+	ErrEntriesQuota = errors.New("entries quota exceeded")
+	ErrBytesQuota   = errors.New("bytes quota exceeded")
+)
+
+// Bytes returns the size of all keys and values in the cache, including expired entries not yet cleaned up.
+func (c *LRUCache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// QuotaWrite describes a write checked by CheckWrites.
+type QuotaWrite struct {
+	Key     string
+	Size    int64 // Size of the key and value after the write if Replace is set, otherwise the bytes it adds to the value
+	Replace bool  // Whether the write replaces the value, like Put, rather than adding to it, like HSet
+}
+
+// CheckQuota reports whether storing value under key would exceed the quota, returning
+// ErrEntriesQuota or ErrBytesQuota if so. Replacing an existing entry only counts the size difference
+// and never adds an entry. Expired entries are not counted.
+func (c *LRUCache) CheckQuota(key, value string, q Quota) error {
+	return c.CheckWrites([]QuotaWrite{{Key: key, Size: int64(len(key) + len(value)), Replace: true}}, q)
+}
+
+// CheckWrites reports whether the writes together would exceed the quota like CheckQuota.
+// A write adding to an entry that does not exist yet also counts its key.
+func (c *LRUCache) CheckWrites(writes []QuotaWrite, q Quota) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	err := c.checkQuota(writes, q, now)
+	if err != nil {
+		// Expired entries the cleanup routine has not removed yet may be holding the room
+		c.removeExpired(now)
+		err = c.checkQuota(writes, q, now)
+	}
+	return err
+}
+
+// checkQuota implements CheckWrites. The caller must hold c.mu.
+func (c *LRUCache) checkQuota(writes []QuotaWrite, q Quota, now time.Time) error {
+	entries := c.list.Len()
+	bytes := c.bytes
+	added := map[string]bool{}
+	for _, w := range writes {
+		var size int64
+		exists := added[w.Key]
+		if node := c.lookup(w.Key, now); node != nil {
+			size, exists = node.size, true
+		}
+		if !exists {
+			entries++
+			added[w.Key] = true
+		}
+		switch {
+		case w.Replace:
+			bytes += w.Size - size
+		case exists:
+			bytes += w.Size
+		default:
+			bytes += int64(len(w.Key)) + w.Size
+		}
+	}
+	if q.MaxEntries > 0 && entries > q.MaxEntries {
+		return ErrEntriesQuota
+	}
+	if q.MaxBytes > 0 && bytes > q.MaxBytes {
+		return ErrBytesQuota
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package in_memory
+
+import (
+	"sort"
+	"time"
+)
+
+// Tag attaches tags to an existing key so it can be invalidated together with other keys carrying them.
+// Tags stay attached until the key is deleted, evicted or expires. It reports whether the key was found.
+func (c *LRUCache) Tag(key string, tags ...string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node := c.lookup(key, time.Now())
+	if node == nil {
+		return false
+	}
+	c.tag(node, tags)
+	c.logAOF(aofRecord{Op: aofTag, Key: key, Tags: tags})
+	return true
+}
+
+// KeysByTag returns the live keys carrying the given tag in sorted order.
+func (c *LRUCache) KeysByTag(tag string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	keys := []string{}
+	for key := range c.tags[tag] {
+		if c.lookup(key, now) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InvalidateTag deletes every key carrying the given tag and returns how many were deleted.
+func (c *LRUCache) InvalidateTag(tag string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	for key := range c.tags[tag] {
+		if c.del(key) {
+			c.logAOF(aofRecord{Op: aofDel, Key: key})
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// tag adds tags to a node and to the tag index, skipping tags it already carries. The caller must hold c.mu.
+func (c *LRUCache) tag(node *CacheNode, tags []string) {
+	for _, tag := range tags {
+		keys, found := c.tags[tag]
+		if !found {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		if _, tagged := keys[node.key]; tagged {
+			continue
+		}
+		keys[node.key] = struct{}{}
+		node.tags = append(node.tags, tag)
+	}
+}
+
+// untag removes a node from the tag index. The caller must hold c.mu.
+func (c *LRUCache) untag(node *CacheNode) {
+	for _, tag := range node.tags {
+		delete(c.tags[tag], node.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	node.tags = nil
+}
@@ -0,0 +1,315 @@
+package in_memory
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrWrongType is returned when an operation is used on a key holding another type of value.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// valueKind is the type of the value stored in a CacheNode.
+type valueKind uint8
+
+const (
+	kindString valueKind = iota
+	kindHash
+	kindList
+	kindSet
+)
+
+// kindNames are the names reported by Type, matching the Redis TYPE command.
+var kindNames = [...]string{kindString: "string", kindHash: "hash", kindList: "list", kindSet: "set"}
+
+// kindByName is the inverse of kindNames.
+var kindByName = map[string]valueKind{"string": kindString, "hash": kindHash, "list": kindList, "set": kindSet}
+
+// Type returns the type of the value stored at key: "string", "hash", "list" or "set", or "none" if not found.
+func (c *LRUCache) Type(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node := c.lookup(key, time.Now()); node != nil {
+		return kindNames[node.kind]
+	}
+	return "none"
+}
+
+// HSet sets fields of the hash stored at key, creating the hash if needed, and returns the number of new fields.
+// The key keeps its expiration and is marked as recently used. If the cache exceeds length, the least
+// recently used element is evicted.
+func (c *LRUCache) HSet(key string, fields map[string]string, length int) (int, error) {
+	return c.HSetWithVersion(key, fields, length, 0)
+}
+
+// HSetWithVersion sets fields of the hash stored at key like HSet, giving the key the version another tier
+// assigned to the write. A version of 0 assigns the next version of this cache; a key holding a newer version
+// keeps it, since the write is applied either way.
+func (c *LRUCache) HSetWithVersion(key string, fields map[string]string, length int, version uint64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	added, err := c.hset(key, fields, length, version)
+	if err == nil {
+		c.logAOF(aofRecord{Op: aofHSet, Key: key, Length: length, Fields: fields, Version: version})
+	}
+	return added, err
+}
+
+// HGet returns the value of a field of the hash stored at key. The boolean reports whether the field exists.
+func (c *LRUCache) HGet(key, field string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node, err := c.read(key, kindHash)
+	if node == nil {
+		return "", false, err
+	}
+	value, found := node.hash[field]
+	return value, found, nil
+}
+
+// HGetAll returns a copy of the hash stored at key, or an empty map if the key does not exist.
+func (c *LRUCache) HGetAll(key string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fields := map[string]string{}
+	node, err := c.read(key, kindHash)
+	if node != nil {
+		for field, value := range node.hash {
+			fields[field] = value
+		}
+	}
+	return fields, err
+}
+
+// HDel removes fields from the hash stored at key and returns how many were removed.
+// Like in Redis, the key is deleted once its last field is removed.
+func (c *LRUCache) HDel(key string, fields ...string) (int, error) {
+	return c.HDelWithVersion(key, 0, fields...)
+}
+
+// HDelWithVersion removes fields from the hash stored at key like HDel, with a version like HSetWithVersion.
+func (c *LRUCache) HDelWithVersion(key string, version uint64, fields ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed, err := c.hdel(key, fields, version)
+	if removed > 0 {
+		c.logAOF(aofRecord{Op: aofHDel, Key: key, Members: fields, Version: version})
+	}
+	return removed, err
+}
+
+// LPush inserts values at the head of the list stored at key, one after the other like the Redis LPUSH,
+// creating the list if needed, and returns the new length of the list.
+// The key keeps its expiration and is marked as recently used.
+func (c *LRUCache) LPush(key string, values []string, length int) (int, error) {
+	return c.LPushWithVersion(key, values, length, 0)
+}
+
+// LPushWithVersion inserts values at the head of the list stored at key like LPush, with a version like
+// HSetWithVersion.
+func (c *LRUCache) LPushWithVersion(key string, values []string, length int, version uint64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.lpush(key, values, length, version)
+	if err == nil {
+		c.logAOF(aofRecord{Op: aofLPush, Key: key, Length: length, Members: values, Version: version})
+	}
+	return n, err
+}
+
+// LRange returns the items of the list stored at key between start and stop, both inclusive.
+// Negative indexes count from the tail like in Redis, so LRange(key, 0, -1) returns the whole list.
+func (c *LRUCache) LRange(key string, start, stop int) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	items := []string{}
+	node, err := c.read(key, kindList)
+	if node == nil {
+		return items, err
+	}
+	n := len(node.items)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return items, nil
+	}
+	return append(items, node.items[start:stop+1]...), nil
+}
+
+// SAdd adds members to the set stored at key, creating the set if needed, and returns the number of new members.
+// The key keeps its expiration and is marked as recently used.
+func (c *LRUCache) SAdd(key string, members []string, length int) (int, error) {
+	return c.SAddWithVersion(key, members, length, 0)
+}
+
+// SAddWithVersion adds members to the set stored at key like SAdd, with a version like HSetWithVersion.
+func (c *LRUCache) SAddWithVersion(key string, members []string, length int, version uint64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	added, err := c.sadd(key, members, length, version)
+	if err == nil {
+		c.logAOF(aofRecord{Op: aofSAdd, Key: key, Length: length, Members: members, Version: version})
+	}
+	return added, err
+}
+
+// SMembers returns the members of the set stored at key in sorted order.
+func (c *LRUCache) SMembers(key string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	members := []string{}
+	node, err := c.read(key, kindSet)
+	if node != nil {
+		for member := range node.members {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+	}
+	return members, err
+}
+
+// hset implements HSet. The caller must hold c.mu.
+func (c *LRUCache) hset(key string, fields map[string]string, length int, version uint64) (int, error) {
+	node, err := c.write(key, kindHash, length, version)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for field, value := range fields {
+		if old, found := node.hash[field]; found {
+			c.grow(node, int64(len(value)-len(old)))
+		} else {
+			c.grow(node, int64(len(field)+len(value)))
+			added++
+		}
+		node.hash[field] = value
+	}
+	return added, nil
+}
+
+// hdel implements HDel. The caller must hold c.mu.
+func (c *LRUCache) hdel(key string, fields []string, version uint64) (int, error) {
+	node, err := c.read(key, kindHash)
+	if node == nil {
+		return 0, err
+	}
+	removed := 0
+	for _, field := range fields {
+		if value, found := node.hash[field]; found {
+			delete(node.hash, field)
+			c.grow(node, -int64(len(field)+len(value)))
+			removed++
+		}
+	}
+	if len(node.hash) == 0 {
+		c.del(key)
+	} else if removed > 0 {
+		c.bump(node, version)
+	}
+	return removed, nil
+}
+
+// lpush implements LPush. The caller must hold c.mu.
+func (c *LRUCache) lpush(key string, values []string, length int, version uint64) (int, error) {
+	node, err := c.write(key, kindList, length, version)
+	if err != nil {
+		return 0, err
+	}
+	items := make([]string, len(values), len(values)+len(node.items))
+	for i, value := range values {
+		items[len(values)-1-i] = value // The last value pushed ends up at the head
+		c.grow(node, int64(len(value)))
+	}
+	node.items = append(items, node.items...)
+	return len(node.items), nil
+}
+
+// sadd implements SAdd. The caller must hold c.mu.
+func (c *LRUCache) sadd(key string, members []string, length int, version uint64) (int, error) {
+	node, err := c.write(key, kindSet, length, version)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, member := range members {
+		if _, found := node.members[member]; !found {
+			node.members[member] = struct{}{}
+			c.grow(node, int64(len(member)))
+			added++
+		}
+	}
+	return added, nil
+}
+
+// write returns the node of key for a write to a value of the given kind, creating an empty value if the key
+// does not exist. The node is marked as recently used and gets a new version, see bump. The caller must hold c.mu.
+func (c *LRUCache) write(key string, kind valueKind, length int, version uint64) (*CacheNode, error) {
+	now := time.Now()
+	node := c.lookup(key, now)
+	if node == nil {
+		c.put(key, "", length, time.Time{}, version)
+		node = c.cache[key].Value.(*CacheNode)
+		node.kind = kind
+		switch kind {
+		case kindHash:
+			node.hash = make(map[string]string)
+		case kindSet:
+			node.members = make(map[string]struct{})
+		}
+		return node, nil
+	}
+	if node.kind != kind {
+		return nil, ErrWrongType
+	}
+	c.list.MoveToFront(c.cache[key])
+	node.lastAccess = now
+	c.bump(node, version)
+	return node, nil
+}
+
+// bump gives a node written in place the given version, or the next version of this cache if it is 0.
+// A node keeps a newer version it already has. The caller must hold c.mu.
+func (c *LRUCache) bump(node *CacheNode, version uint64) {
+	if version == 0 {
+		c.version++
+		version = c.version
+	} else if version > c.version {
+		c.version = version // Keep handing out versions above any version seen
+	}
+	if version > node.version {
+		node.version = version
+	}
+}
+
+// read returns the node of key for a read of a value of the given kind, marking it as recently used.
+// It returns a nil node if the key does not exist. The caller must hold c.mu.
+func (c *LRUCache) read(key string, kind valueKind) (*CacheNode, error) {
+	now := time.Now()
+	node := c.lookup(key, now)
+	if node == nil {
+		return nil, nil
+	}
+	if node.kind != kind {
+		return nil, ErrWrongType
+	}
+	c.list.MoveToFront(c.cache[key])
+	node.lastAccess = now
+	node.accessCount++
+	return node, nil
+}
+
+// grow adds delta bytes to the size of a node and of the cache. The caller must hold c.mu.
+func (c *LRUCache) grow(node *CacheNode, delta int64) {
+	node.size += delta
+	c.bytes += delta
+}
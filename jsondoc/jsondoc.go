@@ -0,0 +1,491 @@
+// Package jsondoc reads and updates JSON documents stored as cache values, so every tier
+// applies the same path lookups and patches and a value changes the same way wherever it lives.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidJSON  = errors.New("value is not valid JSON")
+	ErrInvalidPath  = errors.New("invalid JSON path")
+	ErrPathNotFound = errors.New("JSON path not found")
+	ErrInvalidPatch = errors.New("invalid JSON patch")
+	ErrTestFailed   = errors.New("JSON patch test operation failed")
+)
+
+// Compact validates value as a single JSON document and returns it without insignificant whitespace.
+func Compact(value string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(value)); err != nil {
+		return "", ErrInvalidJSON
+	}
+	return buf.String(), nil
+}
+
+// Query returns the JSON encoding of the element of doc selected by path.
+// The path is a JSONPath subset: $ is the document, .name and ['name'] select a member
+// and [n] selects an array element, counting from the end when n is negative.
+func Query(doc, path string) (string, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	node, err := decode(doc)
+	if err != nil {
+		return "", err
+	}
+	for _, step := range steps {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[step.name]
+			if step.isIndex || !ok {
+				return "", ErrPathNotFound
+			}
+			node = child
+		case []any:
+			i := step.index
+			if i < 0 {
+				i += len(n)
+			}
+			if !step.isIndex || i < 0 || i >= len(n) {
+				return "", ErrPathNotFound
+			}
+			node = n[i]
+		default:
+			return "", ErrPathNotFound
+		}
+	}
+	return encode(node)
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) to doc and returns the result.
+// Members of the patch replace those of doc, null members remove them, and a patch
+// that is not an object replaces the whole document.
+func MergePatch(doc, patch string) (string, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return "", err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return "", ErrInvalidPatch
+	}
+	return encode(mergePatch(target, p))
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+		} else {
+			t[name] = mergePatch(t[name], value)
+		}
+	}
+	return t
+}
+
+// operation is one step of a JSON Patch. A missing value is nil while a null value is "null".
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Patch applies a JSON Patch (RFC 6902) to doc and returns the result. The operations are
+// applied in order and either all of them succeed or doc is left unchanged.
+func Patch(doc, patch string) (string, error) {
+	node, err := decode(doc)
+	if err != nil {
+		return "", err
+	}
+	var ops []operation
+	if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+		return "", ErrInvalidPatch
+	}
+	for i, op := range ops {
+		if node, err = apply(node, op); err != nil {
+			return "", fmt.Errorf("%w (operation %d)", err, i)
+		}
+	}
+	return encode(node)
+}
+
+// apply performs one operation on node and returns the resulting document.
+func apply(node any, op operation) (any, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: %q requires a path", ErrInvalidPatch, op.Op)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: %q requires a value", ErrInvalidPatch, op.Op)
+		}
+		if value, err = decode(string(op.Value)); err != nil {
+			return nil, ErrInvalidPatch
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: %q requires from", ErrInvalidPatch, op.Op)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = get(node, from); err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			value = clone(value)
+		} else if isPrefix(from, path) {
+			return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+		} else if node, err = remove(node, from); err != nil {
+			return nil, err
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return add(node, path, value)
+	case "remove":
+		return remove(node, path)
+	case "replace":
+		if _, err := get(node, path); err != nil {
+			return nil, err
+		}
+		return set(node, path, value)
+	default: // test
+		current, err := get(node, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, ErrTestFailed
+		}
+		return node, nil
+	}
+}
+
+// get returns the value at path.
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			node = child
+		case []any:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// add inserts value at path, replacing an existing member or shifting array elements to the right.
+func add(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(node, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			i := len(c)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(c)); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, ErrPathNotFound
+	})
+}
+
+// remove deletes the value at path, shifting array elements to the left.
+func remove(node any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	return update(node, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, ErrPathNotFound
+			}
+			delete(c, token)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, ErrPathNotFound
+	})
+}
+
+// set replaces the existing value at path.
+func set(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(node, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = value
+			return c, nil
+		}
+		return nil, ErrPathNotFound
+	})
+}
+
+// update walks to the container holding the last token of path and stores the container fn returns
+// in its place, since changing the length of an array gives a new slice.
+func update(node any, path []string, fn func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		updated, err := update(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = updated
+		return n, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := update(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	}
+	return nil, ErrPathNotFound
+}
+
+// arrayIndex parses an array index token of a JSON Pointer, which must not exceed max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, ErrPathNotFound
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, ErrPathNotFound
+	}
+	return i, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// isPrefix reports whether prefix is a proper prefix of path.
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equal reports whether two decoded values are the same JSON value, comparing numbers by value.
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for name, value := range x {
+			if other, ok := y[name]; !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	default:
+		return a == b
+	}
+}
+
+// clone returns a deep copy of a decoded value, so a copied value can be changed independently.
+func clone(node any) any {
+	switch n := node.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(n))
+		for name, value := range n {
+			c[name] = clone(value)
+		}
+		return c
+	case []any:
+		c := make([]any, len(n))
+		for i, value := range n {
+			c[i] = clone(value)
+		}
+		return c
+	default:
+		return node
+	}
+}
+
+// decode parses a single JSON document, keeping numbers as json.Number so they round-trip unchanged.
+func decode(doc string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var node any
+	if err := dec.Decode(&node); err != nil {
+		return nil, ErrInvalidJSON
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrInvalidJSON // Trailing data after the document
+	}
+	return node, nil
+}
+
+// encode returns the compact JSON encoding of node without escaping HTML characters.
+func encode(node any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// pathStep selects a member by name or an array element by index.
+type pathStep struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// parsePath parses a JSONPath made of member and index selectors.
+func parsePath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, ErrInvalidPath
+	}
+	steps := []pathStep{}
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case '.':
+			end := i + 1
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			if end == i+1 {
+				return nil, ErrInvalidPath
+			}
+			steps = append(steps, pathStep{name: path[i+1 : end]})
+			i = end
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, ErrInvalidPath
+			}
+			inner := path[i+1 : i+end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, pathStep{name: inner[1 : len(inner)-1]})
+			} else if n, err := strconv.Atoi(inner); err == nil {
+				steps = append(steps, pathStep{index: n, isIndex: true})
+			} else {
+				return nil, ErrInvalidPath
+			}
+			i += end + 1
+		default:
+			return nil, ErrInvalidPath
+		}
+	}
+	return steps, nil
+}
@@ -1,21 +1,318 @@
 package zin1
 
 import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/devisettymahidhar315/zin1/api"
+	"github.com/devisettymahidhar315/zin1/config"
+	"github.com/devisettymahidhar315/zin1/multi_cache"
+	"github.com/devisettymahidhar315/zin1/redis"
 	"github.com/gin-gonic/gin"
 )
 
-func Hello() *gin.Engine {
+// ConfigEnv names the environment variable holding the path of the configuration file read by Hello.
+const ConfigEnv = "ZIN1_CONFIG"
+
+// Options configures a Server. Zero values select the defaults.
+type Options struct {
+	// Cache is the cache served by the Server. When nil, the Server creates one connected to
+	// CacheOptions.Redis and closes it with the Server.
+	Cache        *multi_cache.MultiCache
+	CacheOptions multi_cache.Options
 
-	// Initialize the Gin router and routes
-	r := gin.Default()
+	API api.Options // Capacity, value size limit and print format of the endpoints
 
-	r.GET("/:key", api.GetCacheValue)
-	r.DELETE("/:key", api.DeleteCacheValue)
-	r.POST("/:key/:value/:time", api.SetCacheValue)
-	r.GET("/redis/print", api.PrintRedisCache)
-	r.GET("/inmemory/print", api.PrintInMemoryCache)
-	r.DELETE("/all", api.DeleteAll)
+	// LegacyRoutes mounts the unversioned routes next to /v1.
+	LegacyRoutes bool
+
+	LogLevel slog.Level // Lowest level of the messages logged by the Server, info if zero
+
+	Addr            string        // Address Serve listens on, :8080 if empty
+	ShutdownTimeout time.Duration // How long Serve waits for requests in flight when stopping, 10 seconds if zero
+	SnapshotPath    string        // File Serve saves the in-memory tier to when stopping and loads it from when starting, none if empty
+}
+
+// Server serves one cache over HTTP. Several servers, each with its own cache, can run in one process.
+type Server struct {
+	cache        *multi_cache.MultiCache
+	ownsCache    bool
+	handler      *api.Handler
+	legacyRoutes bool
+	level        *slog.LevelVar // Lowest level logged, changed by Reload
+	logger       *slog.Logger
+
+	addr string
+
+	closed context.Context    // Done once Close is called, which stops WatchConfig
+	close  context.CancelFunc // Cancels closed
+
+	mu              sync.Mutex     // Serializes reloads and guards the fields below
+	config          *config.Config // Configuration the Server was built from or last reloaded, nil if built from Options
+	shutdownTimeout time.Duration
+	snapshotPath    string
+}
+
+// NewServer returns a Server configured by opts. Nothing is mounted until Mount or Engine is called.
+func NewServer(opts Options) *Server {
+	if opts.Addr == "" {
+		opts.Addr = ":8080"
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 10 * time.Second
+	}
+	s := &Server{
+		cache:           opts.Cache,
+		legacyRoutes:    opts.LegacyRoutes,
+		level:           new(slog.LevelVar),
+		addr:            opts.Addr,
+		shutdownTimeout: opts.ShutdownTimeout,
+		snapshotPath:    opts.SnapshotPath,
+	}
+	s.closed, s.close = context.WithCancel(context.Background())
+	s.level.Set(opts.LogLevel)
+	s.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: s.level}))
+	if s.cache == nil {
+		s.cache = multi_cache.NewMultiCacheWithOptions(opts.CacheOptions)
+		s.ownsCache = true
+	}
+	s.handler = api.NewHandler(s.cache, opts.API)
+	return s
+}
+
+// NewServerFromConfig returns a Server configured by cfg, which GET /v1/admin/config prints.
+// The settings that can change while serving are changed by Reload.
+func NewServerFromConfig(cfg *config.Config) *Server {
+	level, _ := cfg.Level()
+	retries := cfg.Redis.MaxRetries
+	if retries == 0 {
+		retries = -1 // redis.Options reads zero as the default
+	}
+	s := NewServer(Options{
+		CacheOptions: multi_cache.Options{
+			Redis: redis.Options{
+				Addr:     cfg.Redis.Addr,
+				Password: cfg.Redis.Password,
+				DB:       cfg.Redis.DB,
+				PoolSize: cfg.Redis.PoolSize,
+
+				ReadTimeout:  time.Duration(cfg.Redis.ReadTimeout),
+				WriteTimeout: time.Duration(cfg.Redis.WriteTimeout),
+				MaxRetries:   retries,
+				RetryBackoff: time.Duration(cfg.Redis.RetryBackoff),
+			},
+			CleanupInterval: time.Duration(cfg.CleanupInterval),
+			Breaker: multi_cache.BreakerOptions{
+				Failures: cfg.Redis.BreakerFailures,
+				Cooldown: time.Duration(cfg.Redis.BreakerCooldown),
+			},
+		},
+		API:          apiOptions(cfg),
+		LegacyRoutes: cfg.LegacyRoutes,
+		LogLevel:     level,
+
+		Addr:            cfg.Addr,
+		ShutdownTimeout: time.Duration(cfg.ShutdownTimeout),
+		SnapshotPath:    cfg.SnapshotPath,
+	})
+	s.config = cfg
+	return s
+}
+
+// apiOptions returns the options of the endpoints set by cfg
+func apiOptions(cfg *config.Config) api.Options {
+	return api.Options{
+		Capacity:           cfg.Capacity,
+		MaxValueSize:       cfg.MaxValueSize,
+		LegacyPrint:        cfg.LegacyPrint,
+		DefaultTTL:         int(time.Duration(cfg.DefaultTTL) / time.Second),
+		MaxWritesPerSecond: cfg.MaxWritesPerSecond,
+		ProbeTimeout:       time.Duration(cfg.ProbeTimeout),
+		Config:             cfg,
+	}
+}
+
+// Cache returns the cache served by the Server.
+func (s *Server) Cache() *multi_cache.MultiCache {
+	return s.cache
+}
 
+// Mount registers the routes of the Server on r, which may be an engine or a router group.
+func (s *Server) Mount(r gin.IRouter) {
+	h := s.handler
+	v1 := r.Group("/v1", h.CountRequests, api.V1, h.LimitWrites)
+	mountProbes(h, v1)
+	mountV1(h, v1)
+	// The probes take precedence over the legacy GET /:key, so probes at the root work with the legacy routes too
+	mountProbes(h, r.Group("", h.CountRequests))
+	if s.legacyRoutes {
+		mountLegacy(h, r.Group("", h.CountRequests, h.LimitWrites))
+	}
+}
+
+// Engine returns a new gin engine serving the routes of the Server and logging every request.
+func (s *Server) Engine() *gin.Engine {
+	r := gin.New()
+	r.Use(s.logRequest, gin.Recovery())
+	r.NoRoute(s.handler.CountRequests, api.NotFound)
+	s.Mount(r)
 	return r
 }
+
+// logRequest is the middleware logging each request at the info level, or the error level if it failed with a 5xx status
+func (s *Server) logRequest(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+	level := slog.LevelInfo
+	if ctx.Writer.Status() >= 500 {
+		level = slog.LevelError
+	}
+	s.logger.Log(ctx.Request.Context(), level, "request",
+		"method", ctx.Request.Method,
+		"path", ctx.Request.URL.Path,
+		"status", ctx.Writer.Status(),
+		"duration", time.Since(start),
+		"client", ctx.ClientIP())
+}
+
+// Close stops WatchConfig and closes the cache if the Server created it. A cache passed in Options is left open.
+func (s *Server) Close() error {
+	s.close()
+	if !s.ownsCache {
+		return nil
+	}
+	return s.cache.Close()
+}
+
+// NewServerFromEnv returns a Server configured by the file named in ZIN1_CONFIG, if any, and the ZIN1_* environment
+// variables, with a cache connected to Redis on localhost:6379 by default. The file is reloaded on SIGHUP and
+// whenever it changes until the Server is closed, see WatchConfig.
+func NewServerFromEnv() (*Server, error) {
+	path := os.Getenv(ConfigEnv)
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	s := NewServerFromConfig(cfg)
+	if path != "" {
+		go s.WatchConfig(context.Background(), path)
+	}
+	return s, nil
+}
+
+// Hello returns the engine of a Server built by NewServerFromEnv. It exits if the configuration is invalid.
+// The Server is never closed: its cache and the configuration watcher live as long as the process, so call
+// Hello once, or use NewServerFromEnv to close the Server.
+func Hello() *gin.Engine {
+	s, err := NewServerFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	return s.Engine()
+}
+
+// mountProbes registers the metrics and health routes.
+func mountProbes(h *api.Handler, r gin.IRouter) {
+	r.GET("/metrics", h.Metrics)
+	r.GET("/healthz", h.Healthz)
+	r.GET("/livez", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+}
+
+// mountV1 registers the versioned routes. Keys only appear under /v1/keys/:key, so no key name
+// can collide with another route.
+func mountV1(h *api.Handler, v1 gin.IRouter) {
+	keys := v1.Group("/keys")
+	keys.GET("", h.ListKeys)
+	keys.DELETE("", h.DeleteKeysByPattern)
+	keys.GET("/:key", h.GetRawCacheValue)
+	keys.PUT("/:key", h.PutCacheValue)
+	keys.PATCH("/:key", h.PatchJSONCacheValue)
+	keys.DELETE("/:key", h.DeleteCacheValue)
+	keys.GET("/:key/meta", h.InspectCacheValue)
+	keys.GET("/:key/ttl", h.GetCacheTTL)
+	keys.GET("/:key/type", h.GetCacheType)
+	keys.POST("/:key/expire", h.ExpireCacheValue)
+	keys.POST("/:key/persist", h.PersistCacheValue)
+	keys.POST("/:key/touch", h.TouchCacheValue)
+	keys.POST("/:key/incr", h.IncrCacheValue)
+	keys.POST("/:key/hash", h.HSetCacheValue)
+	keys.GET("/:key/hash", h.HGetAllCacheValue)
+	keys.GET("/:key/hash/:field", h.HGetCacheValue)
+	keys.DELETE("/:key/hash/:field", h.HDelCacheValue)
+	keys.POST("/:key/list", h.LPushCacheValue)
+	keys.GET("/:key/list", h.LRangeCacheValue)
+	keys.POST("/:key/set", h.SAddCacheValue)
+	keys.GET("/:key/set", h.SMembersCacheValue)
+
+	v1.POST("/batch/get", h.BatchGetCacheValues)
+	v1.POST("/batch/set", h.BatchSetCacheValues)
+	v1.POST("/batch/delete", h.BatchDeleteCacheValues)
+	v1.GET("/tags/:tag", h.GetTaggedKeys)
+	v1.DELETE("/tags/:tag", h.InvalidateTag)
+
+	ns := v1.Group("/ns")
+	ns.GET("", h.ListNamespaces)
+	ns.POST("/:namespace", h.CreateNamespace)
+	ns.GET("/:namespace", h.GetNamespace)
+	ns.DELETE("/:namespace", h.DropNamespace)
+	ns.POST("/:namespace/quota", h.SetNamespaceQuota)
+	ns.GET("/:namespace/keys/:key", h.GetNamespaceValue)
+	ns.POST("/:namespace/keys/:key", h.SetNamespaceValue)
+	ns.DELETE("/:namespace/keys/:key", h.DeleteNamespaceValue)
+
+	v1.GET("/admin/usage", h.GetUsage)
+	v1.GET("/admin/config", h.GetConfig)
+	v1.DELETE("/admin/cache", h.DeleteAll)
+	v1.GET("/debug/redis", h.PrintRedisCache)
+	v1.GET("/debug/inmemory", h.PrintInMemoryCache)
+}
+
+// mountLegacy registers the unversioned routes
+func mountLegacy(h *api.Handler, r gin.IRouter) {
+	r.GET("/:key", h.GetCacheValue)
+	r.DELETE("/:key", h.DeleteCacheValue)
+	r.POST("/:key/:value/:time", h.SetCacheValue)
+	r.GET("/redis/print", h.PrintRedisCache)
+	r.GET("/inmemory/print", h.PrintInMemoryCache)
+	r.DELETE("/all", h.DeleteAll)
+	r.GET("/keys", h.ListKeys)
+	r.DELETE("/keys", h.DeleteKeysByPattern)
+	r.GET("/keys/:key", h.GetRawCacheValue)
+	r.PUT("/keys/:key", h.PutCacheValue)
+	r.PATCH("/keys/:key", h.PatchJSONCacheValue)
+	r.POST("/keys/:key/json", h.SetJSONCacheValue)
+	r.GET("/keys/:key/meta", h.InspectCacheValue)
+	r.GET("/keys/:key/ttl", h.GetCacheTTL)
+	r.GET("/keys/:key/type", h.GetCacheType)
+	r.POST("/keys/:key/expire", h.ExpireCacheValue)
+	r.POST("/keys/:key/persist", h.PersistCacheValue)
+	r.POST("/keys/:key/touch", h.TouchCacheValue)
+	r.POST("/keys/:key/incr", h.IncrCacheValue)
+	r.POST("/keys/:key/hash", h.HSetCacheValue)
+	r.GET("/keys/:key/hash", h.HGetAllCacheValue)
+	r.GET("/keys/:key/hash/:field", h.HGetCacheValue)
+	r.DELETE("/keys/:key/hash/:field", h.HDelCacheValue)
+	r.POST("/keys/:key/list", h.LPushCacheValue)
+	r.GET("/keys/:key/list", h.LRangeCacheValue)
+	r.POST("/keys/:key/set", h.SAddCacheValue)
+	r.GET("/keys/:key/set", h.SMembersCacheValue)
+	r.POST("/batch/get", h.BatchGetCacheValues)
+	r.POST("/batch/set", h.BatchSetCacheValues)
+	r.POST("/batch/delete", h.BatchDeleteCacheValues)
+	r.GET("/tags/:tag", h.GetTaggedKeys)
+	r.DELETE("/tags/:tag", h.InvalidateTag)
+	r.GET("/ns", h.ListNamespaces)
+	r.POST("/ns/:namespace", h.CreateNamespace)
+	r.GET("/ns/:namespace", h.GetNamespace)
+	r.DELETE("/ns/:namespace", h.DropNamespace)
+	r.POST("/ns/:namespace/quota", h.SetNamespaceQuota)
+	r.GET("/admin/usage", h.GetUsage)
+	r.GET("/ns/:namespace/keys/:key", h.GetNamespaceValue)
+	r.POST("/ns/:namespace/keys/:key", h.SetNamespaceValue)
+	r.DELETE("/ns/:namespace/keys/:key", h.DeleteNamespaceValue)
+}
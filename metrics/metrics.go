@@ -0,0 +1,255 @@
+// Package metrics implements counters and histograms and writes them in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the content type of the Prometheus text format written by Writer.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// LatencyBuckets are the upper bounds in seconds of latency histograms, from 100µs to 2.5s.
+var LatencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Counter is a count that only goes up. The zero value is ready to use.
+type Counter struct {
+	n atomic.Uint64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.n.Add(1)
+}
+
+// Add adds n to the counter.
+func (c *Counter) Add(n uint64) {
+	c.n.Add(n)
+}
+
+// Value returns the count.
+func (c *Counter) Value() uint64 {
+	return c.n.Load()
+}
+
+// CounterVec is a set of counters told apart by the values of their labels.
+type CounterVec struct {
+	mu       sync.Mutex
+	counters map[string]*Counter // By label values joined with labelSep
+}
+
+// labelSep joins label values in map keys, since it cannot appear in HTTP methods, routes or status codes
+const labelSep = "\x00"
+
+// With returns the counter of the given label values, creating it on first use.
+func (v *CounterVec) With(values ...string) *Counter {
+	key := strings.Join(values, labelSep)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.counters == nil {
+		v.counters = make(map[string]*Counter)
+	}
+	c, found := v.counters[key]
+	if !found {
+		c = &Counter{}
+		v.counters[key] = c
+	}
+	return c
+}
+
+// Each calls fn with the label values and count of every counter, sorted by label values.
+func (v *CounterVec) Each(fn func(values []string, n uint64)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.counters))
+	for key := range v.counters {
+		keys = append(keys, key)
+	}
+	counters := make([]*Counter, len(keys))
+	sort.Strings(keys)
+	for i, key := range keys {
+		counters[i] = v.counters[key]
+	}
+	v.mu.Unlock()
+	for i, key := range keys {
+		fn(strings.Split(key, labelSep), counters[i].Value())
+	}
+}
+
+// Histogram counts observations in buckets with fixed upper bounds and is safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64 // Upper bounds of the buckets, in increasing order
+	counts []uint64  // Observations per bucket, not cumulative, with a last bucket for +Inf
+	sum    float64
+}
+
+// NewHistogram returns a histogram with buckets of the given upper bounds, in increasing order.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// Observe adds an observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v) // First bucket whose bound is at least v
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := HistogramSnapshot{Bounds: h.bounds, Cumulative: make([]uint64, len(h.bounds)), Sum: h.sum}
+	for i, n := range h.counts {
+		s.Count += n
+		if i < len(h.bounds) {
+			s.Cumulative[i] = s.Count
+		}
+	}
+	return s
+}
+
+// HistogramSnapshot is the state of a histogram at one point in time.
+type HistogramSnapshot struct {
+	Bounds     []float64 // Upper bounds of the buckets
+	Cumulative []uint64  // Observations at or below each bound
+	Count      uint64    // Number of observations
+	Sum        float64   // Sum of the observations
+}
+
+// HistogramVec is a set of histograms with the same buckets told apart by the values of their labels.
+type HistogramVec struct {
+	bounds     []float64
+	mu         sync.Mutex
+	histograms map[string]*Histogram // By label values joined with labelSep
+}
+
+// NewHistogramVec returns a set of histograms with buckets of the given upper bounds, in increasing order.
+func NewHistogramVec(bounds []float64) *HistogramVec {
+	return &HistogramVec{bounds: bounds, histograms: make(map[string]*Histogram)}
+}
+
+// With returns the histogram of the given label values, creating it on first use.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	key := strings.Join(values, labelSep)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, found := v.histograms[key]
+	if !found {
+		h = NewHistogram(v.bounds)
+		v.histograms[key] = h
+	}
+	return h
+}
+
+// Each calls fn with the label values and state of every histogram, sorted by label values.
+func (v *HistogramVec) Each(fn func(values []string, s HistogramSnapshot)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.histograms))
+	for key := range v.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	histograms := make([]*Histogram, len(keys))
+	for i, key := range keys {
+		histograms[i] = v.histograms[key]
+	}
+	v.mu.Unlock()
+	for i, key := range keys {
+		fn(strings.Split(key, labelSep), histograms[i].Snapshot())
+	}
+}
+
+// Writer writes metrics in the Prometheus text format. Samples of the same metric must be written
+// one after another; the HELP and TYPE lines are written before the first of them.
+type Writer struct {
+	w       io.Writer
+	err     error           // First write error, after which nothing more is written
+	written map[string]bool // Metrics whose HELP and TYPE lines were written
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, written: make(map[string]bool)}
+}
+
+// Err returns the first error returned by the underlying writer.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Counter writes a sample of a counter. Labels are given as name and value pairs.
+func (w *Writer) Counter(name, help string, value uint64, labels ...string) {
+	w.header(name, "counter", help)
+	w.sample(name, labels, strconv.FormatUint(value, 10))
+}
+
+// Gauge writes a sample of a gauge. Labels are given as name and value pairs.
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.header(name, "gauge", help)
+	w.sample(name, labels, formatFloat(value))
+}
+
+// Histogram writes the buckets, sum and count of a histogram. Labels are given as name and value pairs.
+func (w *Writer) Histogram(name, help string, s HistogramSnapshot, labels ...string) {
+	w.header(name, "histogram", help)
+	for i, bound := range s.Bounds {
+		w.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", formatFloat(bound)), strconv.FormatUint(s.Cumulative[i], 10))
+	}
+	w.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", "+Inf"), strconv.FormatUint(s.Count, 10))
+	w.sample(name+"_sum", labels, formatFloat(s.Sum))
+	w.sample(name+"_count", labels, strconv.FormatUint(s.Count, 10))
+}
+
+// header writes the HELP and TYPE lines of a metric the first time it is written
+func (w *Writer) header(name, kind, help string) {
+	if w.written[name] {
+		return
+	}
+	w.written[name] = true
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help), name, kind)
+}
+
+// sample writes one line with the labels given as name and value pairs
+func (w *Writer) sample(name string, labels []string, value string) {
+	if len(labels) == 0 {
+		w.printf("%s %s\n", name, value)
+		return
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	w.printf("%s{%s} %s\n", name, strings.Join(pairs, ","), value)
+}
+
+// labelEscaper escapes label values as the text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// printf writes to the underlying writer unless a previous write failed
+func (w *Writer) printf(format string, args ...any) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
+
+// formatFloat formats a sample value, with +Inf, -Inf and NaN spelled as the text format requires
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,366 @@
+package multi_cache
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/redis"
+)
+
+// A circuit breaker stands in front of Redis. Once Failures operations in a row saw a Redis command fail,
+// it opens and every operation is served by the in-memory tier alone, without waiting on Redis. After
+// Cooldown it lets one operation probe Redis: if it succeeds the breaker closes, otherwise it opens again.
+// Keys written while Redis was skipped are replayed to Redis before it is used again: strings, hashes,
+// lists and sets are copied from memory, keys deleted from memory are deleted from Redis, and deleted
+// patterns and invalidated tags are deleted again. Content types and tags of replayed keys are not copied.
+// Del_ALL only clears from Redis the keys memory held, which it records like deleted keys. Redis is never
+// flushed by a replay: past maxOutageKeys changed keys, the others are lost and only replayed if memory holds them.
+// A MultiCache and its namespaces share one breaker, since they share the connection to Redis.
+
+// States of the circuit breaker, as reported by Stats and Health.
+const (
+	BreakerClosed   = "closed"    // Operations use Redis
+	BreakerOpen     = "open"      // Operations skip Redis until the cooldown ends
+	BreakerHalfOpen = "half-open" // One operation probes Redis, the others skip it
+)
+
+// BreakerOptions configures the circuit breaker in front of Redis. Zero values select the defaults.
+type BreakerOptions struct {
+	Failures int           // Operations failing in a row that open the breaker, 5 if zero
+	Cooldown time.Duration // How long the breaker stays open before probing Redis, 5 seconds if zero
+}
+
+// maxOutageKeys is how many changed keys an outage tracks; beyond it the changes are lost, see outage
+const maxOutageKeys = 100000
+
+// BreakerStats counts what the circuit breaker did since the cache was created.
+type BreakerStats struct {
+	State    string // BreakerClosed, BreakerOpen or BreakerHalfOpen
+	Opens    uint64 // Times the breaker opened
+	Degraded uint64 // Operations served without Redis
+	Replayed uint64 // Keys replayed to Redis after an outage
+}
+
+// breaker is the circuit breaker in front of Redis.
+type breaker struct {
+	opts BreakerOptions
+
+	mu         sync.Mutex
+	state      string
+	generation uint64    // Changes with the state, so outcomes of operations allowed in an earlier state are ignored
+	failures   int       // Operations failing in a row
+	openedAt   time.Time // When the breaker last opened
+	probing    bool      // Whether the half-open probe is running
+	opens      uint64
+
+	degraded, replayed atomic.Uint64
+}
+
+// newBreaker returns a closed breaker configured by opts.
+func newBreaker(opts BreakerOptions) *breaker {
+	if opts.Failures <= 0 {
+		opts.Failures = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 5 * time.Second
+	}
+	return &breaker{opts: opts, state: BreakerClosed}
+}
+
+// setState moves the breaker to state, starting a new generation. The caller must hold b.mu.
+func (b *breaker) setState(state string) {
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.probing = false
+}
+
+// allow reports whether an operation may use Redis. Once the cooldown ended, only one operation at a time
+// may, as a probe. Every allowed operation must report its outcome with done, passing the returned token.
+func (b *breaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.Cooldown {
+		b.setState(BreakerHalfOpen)
+	}
+	switch b.state {
+	case BreakerClosed:
+		return b.generation, true
+	case BreakerHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return b.generation, true
+		}
+	}
+	return 0, false
+}
+
+// done records whether an operation allowed by allow with the given token used Redis without any command failing.
+// Outcomes of operations allowed before the breaker last changed state are ignored: a slow operation started
+// before Redis went down cannot close the breaker, nor one that failed before a probe succeeded reopen it.
+func (b *breaker) done(token uint64, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if token != b.generation {
+		return
+	}
+	switch {
+	case ok && b.state == BreakerHalfOpen:
+		b.setState(BreakerClosed)
+	case ok:
+		b.failures = 0
+	case b.state == BreakerHalfOpen:
+		b.open()
+	default:
+		b.failures++
+		if b.failures >= b.opts.Failures {
+			b.open()
+		}
+	}
+}
+
+// open opens the breaker. The caller must hold b.mu.
+func (b *breaker) open() {
+	b.setState(BreakerOpen)
+	b.openedAt = time.Now()
+	b.opens++
+}
+
+// stats returns the state and counts of the breaker.
+func (b *breaker) stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.Cooldown {
+		b.setState(BreakerHalfOpen) // Reported as it will be for the next operation
+	}
+	return BreakerStats{State: b.state, Opens: b.opens, Degraded: b.degraded.Load(), Replayed: b.replayed.Load()}
+}
+
+// outage tracks what changed in the in-memory tier of a MultiCache while Redis was skipped.
+type outage struct {
+	replayMu sync.RWMutex // Held for reading by operations using Redis and for writing by replay
+	pending  atomic.Bool  // Whether anything waits to be replayed
+
+	mu       sync.Mutex // Guards the fields below
+	keys     map[string]struct{}
+	patterns []string // Patterns deleted from memory, see DeletePattern
+	tags     []string // Tags invalidated in memory, see InvalidateTag
+	lost     bool     // Keys beyond maxOutageKeys changed, so every key memory holds is replayed too
+	length   int      // Largest capacity given to a write, used by the replayed writes
+}
+
+// changes holds what an outage recorded, taken by replay.
+type changes struct {
+	keys           map[string]struct{}
+	patterns, tags []string
+	lost           bool
+	length         int
+}
+
+// add records that keys changed in memory, written with the given capacity, 0 if the write gave none.
+func (o *outage) add(length int, keys ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.length = max(o.length, length)
+	if o.keys == nil {
+		o.keys = make(map[string]struct{})
+	}
+	for _, key := range keys {
+		if _, found := o.keys[key]; !found && len(o.keys) >= maxOutageKeys {
+			o.lost = true
+			continue
+		}
+		o.keys[key] = struct{}{}
+	}
+	o.pending.Store(true)
+}
+
+// addPattern records that the keys matching a pattern were deleted from memory.
+func (o *outage) addPattern(pattern string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.patterns = append(o.patterns, pattern)
+	o.pending.Store(true)
+}
+
+// addTag records that the keys carrying a tag were deleted from memory.
+func (o *outage) addTag(tag string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.tags = append(o.tags, tag)
+	o.pending.Store(true)
+}
+
+// take returns what was recorded and forgets it.
+func (o *outage) take() changes {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ch := changes{keys: o.keys, patterns: o.patterns, tags: o.tags, lost: o.lost, length: o.length}
+	o.keys, o.patterns, o.tags, o.lost = nil, nil, nil, false
+	o.pending.Store(false)
+	return ch
+}
+
+// restore records again changes whose replay failed, along with anything recorded since.
+func (o *outage) restore(ch changes) {
+	if ch.lost {
+		o.mu.Lock()
+		o.lost = true
+		o.mu.Unlock()
+	}
+	for _, pattern := range ch.patterns {
+		o.addPattern(pattern)
+	}
+	for _, tag := range ch.tags {
+		o.addTag(tag)
+	}
+	keys := make([]string, 0, len(ch.keys))
+	for key := range ch.keys {
+		keys = append(keys, key)
+	}
+	o.add(ch.length, keys...)
+}
+
+// redisCall runs fn, which uses Redis, unless the breaker skips Redis, replaying the changes of an outage
+// first. fn must send its commands with the context it is given, whose failures are tracked apart from those
+// of concurrent operations. It reports whether fn ran without any of its Redis commands failing; when it did
+// not, the caller serves the operation from the in-memory tier alone and reports the keys it wrote with degrade.
+func (c *MultiCache) redisCall(ctx context.Context, fn func(ctx context.Context)) bool {
+	token, allowed := c.breaker.allow()
+	if !allowed {
+		return false
+	}
+	ok := !c.outage.pending.Load() || c.replay(ctx)
+	if ok {
+		ctx = redis.TrackFailures(ctx)
+		c.outage.replayMu.RLock()
+		fn(ctx)
+		c.outage.replayMu.RUnlock()
+		ok = !redis.Failed(ctx)
+	}
+	c.breaker.done(token, ok)
+	return ok
+}
+
+// degrade counts an operation served without Redis and records the keys it wrote in memory, with the
+// capacity it was given, for replay.
+func (c *MultiCache) degrade(length int, keys ...string) {
+	c.breaker.degraded.Add(1)
+	if length > 0 || len(keys) > 0 {
+		c.outage.add(length, keys...)
+	}
+}
+
+// degradedWrite finishes a write the in-memory tier took alone while Redis was skipped: it records the key
+// for replay and copies a stored value to the disk tier. It returns the version of the stored value, 0 if the
+// write stored nothing.
+func (c *MultiCache) degradedWrite(key, value string, length int, t int, stored bool) uint64 {
+	if !stored {
+		c.degrade(0)
+		return 0
+	}
+	c.degrade(length, key)
+	if c.diskCache != nil {
+		c.diskCache.Put(key, value, int(c.diskLength.Load()), t)
+	}
+	info, _ := c.inMemoryCache.Inspect(key)
+	return info.Version
+}
+
+// replay copies the changes of an outage from the in-memory tier to Redis and reports whether it succeeded.
+// If a Redis command fails, the changes are recorded again for the next attempt. The replay runs to the end even
+// if the operation that started it is cancelled, each Redis operation keeping its own timeout.
+func (c *MultiCache) replay(ctx context.Context) bool {
+	ctx = redis.TrackFailures(context.WithoutCancel(ctx))
+	c.outage.replayMu.Lock()
+	defer c.outage.replayMu.Unlock()
+	ch := c.outage.take()
+	length := ch.length
+	if length <= 0 {
+		length = max(c.inMemoryCache.Len(), 1)
+	}
+	if ch.lost {
+		log.Printf("More than %d keys changed while Redis was unavailable, replaying only those held in memory", maxOutageKeys)
+		if ch.keys == nil {
+			ch.keys = make(map[string]struct{})
+		}
+		c.inMemoryCache.Entries(0, func(e in_memory.Entry) bool {
+			ch.keys[e.Key] = struct{}{}
+			return true
+		})
+	}
+	for _, pattern := range ch.patterns {
+		c.redisCache.DeletePattern(ctx, pattern)
+	}
+	for _, tag := range ch.tags {
+		c.redisCache.InvalidateTag(ctx, tag)
+	}
+	for key := range ch.keys {
+		if redis.Failed(ctx) {
+			break
+		}
+		c.replayKey(ctx, key, length)
+		if !redis.Failed(ctx) {
+			c.breaker.replayed.Add(1)
+		}
+	}
+	if redis.Failed(ctx) {
+		c.outage.restore(ch)
+		return false
+	}
+	return true
+}
+
+// replayKey copies the value of key from the in-memory tier to Redis, or deletes it from Redis if memory does
+// not hold it. A replayed string takes the version Redis assigns to it in both tiers; one written over a JSON
+// document while Redis was unavailable replaces the document even if it is not JSON, as it did in memory.
+func (c *MultiCache) replayKey(ctx context.Context, key string, length int) {
+	kind := c.inMemoryCache.Type(key)
+	if kind == "none" {
+		c.redisCache.Del(ctx, key)
+		return
+	}
+	info, _ := c.inMemoryCache.Inspect(key)
+	ttl := ttlSeconds(info.TTL)
+	if kind == "string" {
+		value := c.inMemoryCache.Peek(key)
+		version, err := c.redisCache.Put(ctx, key, value, length, ttl)
+		if err != nil {
+			c.redisCache.Del(ctx, key)
+			version, _ = c.redisCache.Put(ctx, key, value, length, ttl)
+		}
+		c.inMemoryCache.SetVersion(key, version)
+		return
+	}
+	c.redisCache.Del(ctx, key)
+	switch kind {
+	case "hash":
+		fields, _ := c.inMemoryCache.HGetAll(key)
+		c.redisCache.HSet(ctx, key, fields, length)
+	case "list":
+		items, _ := c.inMemoryCache.LRange(key, 0, -1)
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i] // LPUSH inserts the last value at the head
+		}
+		c.redisCache.LPush(ctx, key, items, length)
+	case "set":
+		members, _ := c.inMemoryCache.SMembers(key)
+		c.redisCache.SAdd(ctx, key, members, length)
+	}
+	if ttl > 0 {
+		c.redisCache.Expire(ctx, key, time.Duration(ttl)*time.Second)
+	}
+}
+
+// ttlSeconds converts a remaining time to live to whole seconds, rounding up, or -1 for no expiration.
+func ttlSeconds(ttl time.Duration) int {
+	if ttl <= 0 {
+		return -1
+	}
+	return int(math.Ceil(ttl.Seconds()))
+}
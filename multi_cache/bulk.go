@@ -0,0 +1,141 @@
+package multi_cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/redis"
+)
+
+// Item is a key-value pair for bulk writes.
+type Item struct {
+	Key   string
+	Value string
+}
+
+// MGet retrieves the values of several keys from both Redis and in-memory caches concurrently.
+// Like Get, a key only yields a value when both tiers agree, falling back to the disk tier when both miss.
+func (c *MultiCache) MGet(ctx context.Context, keys []string) []string {
+	var redis_values, inmemory_values []string
+	var ok bool
+	var wg sync.WaitGroup
+	wg.Add(2) // Add two goroutines to the wait group
+	go func() {
+		defer wg.Done()
+		inmemory_values = c.inMemoryCache.MGet(keys)
+	}()
+	go func() {
+		defer wg.Done()
+		ok = c.redisCall(ctx, func(ctx context.Context) { redis_values = c.redisCache.MGet(ctx, keys) })
+	}()
+	wg.Wait() // Wait for both goroutines to finish
+	if !ok {
+		// Serve the in-memory copies alone while Redis is unavailable
+		c.degrade(0)
+		redis_values = inmemory_values
+	}
+
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		if redis_values[i] == "" && inmemory_values[i] == "" && c.diskCache != nil {
+			values[i] = c.diskCache.Get(key)
+			c.countRead(values[i], values[i])
+			continue
+		}
+		c.countRead(redis_values[i], inmemory_values[i])
+		if redis_values[i] == inmemory_values[i] {
+			values[i] = redis_values[i]
+		}
+	}
+	return values
+}
+
+// MSet stores several key-value pairs with the same TTL in every tier and returns the versions Redis assigned.
+// The in-memory tier is written under a single lock once Redis has answered, carrying the same versions.
+// A namespace stores none of the items if they exceed its quota together, and no tier stores any of them if one
+// would replace a JSON document with a value that is not JSON, see SetWithContentType.
+func (c *MultiCache) MSet(ctx context.Context, items []Item, length int, t int) ([]uint64, error) {
+	length = c.writeLength(ctx, length)
+	writes := make([]in_memory.QuotaWrite, len(items))
+	for i, item := range items {
+		writes[i] = replacing(item.Key, item.Value)
+	}
+	done, err := c.admit(ctx, writes...)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	redisItems := make([]redis.Item, len(items))
+	for i, item := range items {
+		redisItems[i] = redis.Item{Key: item.Key, Value: item.Value}
+	}
+	var versions []uint64
+	ok := c.redisCall(ctx, func(ctx context.Context) { versions, err = c.redisCache.MSet(ctx, redisItems, length, t) })
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	if c.diskCache != nil {
+		// Store in disk cache concurrently, using the tier's own capacity and the versions Redis assigned
+		wg.Add(1)
+		go func(versions []uint64) {
+			defer wg.Done()
+			for i, item := range items {
+				var version uint64
+				if ok {
+					version = versions[i]
+				}
+				c.diskCache.PutWithVersion(item.Key, item.Value, int(c.diskLength.Load()), t, version)
+			}
+		}(versions)
+	}
+	inMemoryItems := make([]in_memory.Item, len(items))
+	keys := make([]string, len(items))
+	for i, item := range items {
+		inMemoryItems[i] = in_memory.Item{Key: item.Key, Value: item.Value}
+		if ok {
+			inMemoryItems[i].Version = versions[i]
+		}
+		keys[i] = item.Key
+	}
+	inMemoryVersions := c.inMemoryCache.MSet(inMemoryItems, length, t)
+	if !ok {
+		versions = inMemoryVersions
+		c.degrade(length, keys...)
+	}
+	wg.Wait() // Wait for the disk tier to finish
+	return versions, nil
+}
+
+// MDel deletes several keys from every tier concurrently and returns how many Redis held,
+// or the in-memory tier while Redis is unavailable.
+func (c *MultiCache) MDel(ctx context.Context, keys []string) int {
+	var deleted, inmemory_deleted int
+	var ok bool
+	var wg sync.WaitGroup
+	wg.Add(2) // Add two goroutines to the wait group
+	go func() {
+		defer wg.Done()
+		inmemory_deleted = c.inMemoryCache.MDel(keys)
+	}()
+	go func() {
+		defer wg.Done()
+		ok = c.redisCall(ctx, func(ctx context.Context) { deleted = c.redisCache.MDel(ctx, keys) })
+	}()
+	if c.diskCache != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, key := range keys {
+				c.diskCache.Del(key)
+			}
+		}()
+	}
+	wg.Wait() // Wait for all goroutines to finish
+	if !ok {
+		c.degrade(0, keys...)
+		return inmemory_deleted
+	}
+	return deleted
+}
@@ -0,0 +1,34 @@
+package multi_cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/redis"
+)
+
+// Entry is a single cache entry as reported by the Entries methods.
+type Entry struct {
+	Key   string
+	Value string        // Value of a string, empty for hashes, lists and sets
+	Type  string        // Type of the value: "string", "hash", "list" or "set"
+	TTL   time.Duration // Remaining time to live, -1 if the entry never expires
+	Rank  int           // Position in recency order within the tier, 0 for the most recently used entry; expired entries keep theirs
+}
+
+// RedisEntries calls fn for every entry of the Redis cache from most to least recently used,
+// starting at rank offset and stopping early if fn returns false.
+func (c *MultiCache) RedisEntries(ctx context.Context, offset int, fn func(Entry) bool) {
+	c.redisCache.Entries(ctx, offset, func(e redis.Entry) bool {
+		return fn(Entry{Key: e.Key, Value: e.Value, Type: e.Type, TTL: e.TTL, Rank: e.Rank})
+	})
+}
+
+// InMemoryEntries calls fn for every entry of the in-memory cache from most to least recently used,
+// starting at rank offset and stopping early if fn returns false.
+func (c *MultiCache) InMemoryEntries(offset int, fn func(Entry) bool) {
+	c.inMemoryCache.Entries(offset, func(e in_memory.Entry) bool {
+		return fn(Entry{Key: e.Key, Value: e.Value, Type: e.Type, TTL: e.TTL, Rank: e.Rank})
+	})
+}
@@ -0,0 +1,62 @@
+package multi_cache
+
+import (
+	"context"
+	"time"
+)
+
+// Statuses reported by Health for a MultiCache and each of its tiers.
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded" // Redis is down or skipped by the circuit breaker, but the in-memory tier is up
+	StatusDown     = "down"
+)
+
+// staleCleanups is how many cleanup intervals may pass without a cleanup before the in-memory tier is reported down.
+const staleCleanups = 3
+
+// TierHealth is the state of one tier as probed by Health.
+type TierHealth struct {
+	Status  string        // StatusUp or StatusDown
+	Error   string        // Why the tier is down, empty if it is up
+	Latency time.Duration // Time the Redis probe took, 0 for the in-memory tier
+	Breaker string        // State of the circuit breaker in front of Redis, empty for the in-memory tier
+
+	LastCleanup     time.Time     // Last time the in-memory tier removed expired entries, zero for Redis
+	CleanupInterval time.Duration // How often the in-memory tier removes expired entries, 0 for Redis
+}
+
+// Health is the state of a MultiCache and its tiers.
+type Health struct {
+	Status string                // StatusUp, StatusDegraded or StatusDown
+	Tiers  map[string]TierHealth // By tier name such as TierRedis
+}
+
+// Health pings Redis, giving up when ctx is done, and checks that the in-memory tier still removes expired entries.
+// The cache is degraded when only the in-memory tier is up or the circuit breaker is not closed, so operations
+// may be served by the in-memory tier alone, and down when the in-memory tier is.
+func (c *MultiCache) Health(ctx context.Context) Health {
+	start := time.Now()
+	redisHealth := TierHealth{Status: StatusUp}
+	if err := c.redisCache.Ping(ctx); err != nil {
+		redisHealth = TierHealth{Status: StatusDown, Error: err.Error()}
+	}
+	redisHealth.Latency = time.Since(start)
+	redisHealth.Breaker = c.breaker.stats().State
+
+	lastCleanup, interval := c.inMemoryCache.LastCleanup(), c.inMemoryCache.CleanupInterval()
+	inMemoryHealth := TierHealth{Status: StatusUp, LastCleanup: lastCleanup, CleanupInterval: interval}
+	if since := time.Since(lastCleanup); since > staleCleanups*interval {
+		inMemoryHealth.Status = StatusDown
+		inMemoryHealth.Error = "no cleanup for " + since.Round(time.Millisecond).String()
+	}
+
+	health := Health{Status: StatusUp, Tiers: map[string]TierHealth{TierInMemory: inMemoryHealth, TierRedis: redisHealth}}
+	switch {
+	case inMemoryHealth.Status == StatusDown:
+		health.Status = StatusDown
+	case redisHealth.Status == StatusDown, redisHealth.Breaker != BreakerClosed:
+		health.Status = StatusDegraded
+	}
+	return health
+}
@@ -0,0 +1,108 @@
+package multi_cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/jsondoc"
+	"github.com/devisettymahidhar315/zin1/redis"
+)
+
+// JSON documents are stored as compact strings in every tier, so Get returns them unchanged,
+// with application/json as their content type.
+// Patches run in Redis, which is authoritative, inside an optimistic transaction; the other tiers
+// mirror the patched document with its new version and the expiration Redis keeps for it.
+// Writes without a content type only replace a document with JSON, so it stays valid; see SetWithContentType.
+// While Redis is unavailable, patches apply to the in-memory copy alone.
+
+var (
+	ErrNotFound = redis.ErrNotFound // The key to read or patch does not exist
+	ErrConflict = redis.ErrConflict // The key kept changing while a patch was applied
+)
+
+// SetJSON validates value as a JSON document and stores it like Set. It returns the version
+// Redis assigned to the document, or jsondoc.ErrInvalidJSON without storing anything.
+func (c *MultiCache) SetJSON(ctx context.Context, key, value string, length int, t int, tags ...string) (uint64, error) {
+	doc, err := jsondoc.Compact(value)
+	if err != nil {
+		return 0, err
+	}
+	version, _, err := c.SetWithContentType(ctx, key, doc, "application/json", length, t, tags...)
+	return version, err
+}
+
+// GetJSON returns the JSON encoding of the element of the document stored at key selected by path,
+// "$" being the whole document, along with the version of the document. See jsondoc.Query.
+func (c *MultiCache) GetJSON(ctx context.Context, key, path string) (string, uint64, error) {
+	doc, version := c.GetWithVersion(ctx, key)
+	if doc == "" {
+		return "", 0, ErrNotFound
+	}
+	value, err := jsondoc.Query(doc, path)
+	if err != nil {
+		return "", 0, err
+	}
+	return value, version, nil
+}
+
+// MergePatchJSON applies a JSON Merge Patch to the document stored at key and returns the
+// patched document and its version. See jsondoc.MergePatch.
+func (c *MultiCache) MergePatchJSON(ctx context.Context, key, patch string, length int) (string, uint64, error) {
+	return c.updateJSON(ctx, key, length, len(patch), func(doc string) (string, error) {
+		return jsondoc.MergePatch(doc, patch)
+	})
+}
+
+// PatchJSON applies a JSON Patch to the document stored at key and returns the patched document
+// and its version. Either every operation of the patch is applied or none is. See jsondoc.Patch.
+func (c *MultiCache) PatchJSON(ctx context.Context, key, patch string, length int) (string, uint64, error) {
+	return c.updateJSON(ctx, key, length, len(patch), func(doc string) (string, error) {
+		return jsondoc.Patch(doc, patch)
+	})
+}
+
+// updateJSON replaces the document stored at key with the result of fn in Redis and mirrors it
+// with the expiration Redis keeps for the key.
+// The quota of a namespace counts the patch, of size grow, as added to the document.
+func (c *MultiCache) updateJSON(ctx context.Context, key string, length int, grow int, fn func(doc string) (string, error)) (string, uint64, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, in_memory.QuotaWrite{Key: key, Size: int64(grow)})
+	if err != nil {
+		return "", 0, err
+	}
+	defer done()
+	var doc string
+	var version uint64
+	var ttl time.Duration
+	if !c.redisCall(ctx, func(ctx context.Context) { doc, version, ttl, err = c.redisCache.Update(ctx, key, length, fn) }) {
+		return c.updateInMemoryJSON(key, length, fn)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	c.inMemoryCache.PutWithExpiration(key, doc, length, ttl, version)
+	if c.diskCache != nil {
+		c.diskCache.PutWithVersion(key, doc, int(c.diskLength.Load()), ttlSeconds(ttl), version)
+	}
+	return doc, version, nil
+}
+
+// updateInMemoryJSON replaces the document stored at key with the result of fn in the in-memory tier alone,
+// while Redis is unavailable, and records the key for replay. The document is read and written under the lock
+// of the in-memory tier, so concurrent patches apply one after the other as they do in Redis.
+func (c *MultiCache) updateInMemoryJSON(key string, length int, fn func(doc string) (string, error)) (string, uint64, error) {
+	c.degrade(0)
+	doc, version, found, err := c.inMemoryCache.Update(key, length, fn)
+	if !found {
+		return "", 0, ErrNotFound
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	c.outage.add(length, key)
+	if c.diskCache != nil {
+		c.diskCache.PutKeepTTL(key, doc, int(c.diskLength.Load()))
+	}
+	return doc, version, nil
+}
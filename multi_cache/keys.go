@@ -0,0 +1,38 @@
+package multi_cache
+
+import "context"
+
+// Keys returns keys matching the Redis-style glob pattern, starting at cursor (0 for the first page),
+// along with the cursor of the next page, which is 0 once every key has been listed.
+// Redis holds every key the in-memory tier does, so the listing comes from a SCAN there.
+// While Redis is unavailable the first page lists every matching key of the in-memory tier instead.
+func (c *MultiCache) Keys(ctx context.Context, pattern string, cursor uint64, limit int) ([]string, uint64) {
+	var keys []string
+	var next uint64
+	if !c.redisCall(ctx, func(ctx context.Context) { keys, next = c.redisCache.Keys(ctx, pattern, cursor, limit) }) {
+		c.degrade(0)
+		if cursor != 0 {
+			return []string{}, 0 // The cursor belongs to a SCAN of Redis
+		}
+		keys, _ = c.inMemoryCache.Keys(pattern, "", 0)
+		return keys, 0
+	}
+	return keys, next
+}
+
+// DeletePattern deletes every key matching the Redis-style glob pattern from every tier
+// and returns how many Redis held, or the in-memory tier while Redis is unavailable.
+func (c *MultiCache) DeletePattern(ctx context.Context, pattern string) int {
+	var deleted []string
+	ok := c.redisCall(ctx, func(ctx context.Context) { deleted = c.redisCache.DeletePattern(ctx, pattern) })
+	inMemoryDeleted := c.inMemoryCache.DeletePattern(pattern)
+	if c.diskCache != nil {
+		c.diskCache.DeletePattern(pattern)
+	}
+	if !ok {
+		c.degrade(0)
+		c.outage.addPattern(pattern)
+		return inMemoryDeleted
+	}
+	return len(deleted)
+}
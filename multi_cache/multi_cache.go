@@ -1,72 +1,770 @@
 package multi_cache
 
 import (
+	"context"
+	"errors"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/devisettymahidhar315/zin1/disk"
 	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/metrics"
 	"github.com/devisettymahidhar315/zin1/redis"
 )
 
-// MultiCache struct manages both Redis and in-memory caches.
+// MultiCache struct manages both Redis and in-memory caches, with an optional disk tier beneath them.
 type MultiCache struct {
 	redisCache    *redis.LRUCache
 	inMemoryCache *in_memory.LRUCache
+	diskCache     *disk.LRUCache // L3 tier, nil when disabled
+	diskLength    atomic.Int64   // Maximum number of entries in the disk tier
+	length        atomic.Int64   // Length of the latest write, which disk hits are promoted within
+	capacity      atomic.Int64   // Capacity of a namespace, which replaces the length writes are given; 0 in the root
+	limits        *quotaState    // Quota of a namespace, nil in the root
+
+	touchMu sync.Mutex // Guards touched
+	touched []string   // Keys read from the in-memory tier alone, oldest first, to promote in Redis, see touch
+
+	cleanupInterval time.Duration // How often in-memory tiers, namespaces included, remove expired entries
+
+	nsMu       sync.Mutex            // Guards namespaces
+	namespaces map[string]*Namespace // Namespaces by name, nil in the MultiCache of a namespace
+
+	breaker *breaker // Circuit breaker in front of Redis, shared with the namespaces
+	outage  outage   // Changes to replay to Redis once the breaker lets operations through again
+
+	hits, misses, divergences atomic.Uint64 // Counts of reads, see Stats
+}
+
+// Options configures a MultiCache.
+type Options struct {
+	Redis           redis.Options  // Connection to the Redis tier
+	CleanupInterval time.Duration  // How often the in-memory tier removes expired entries, 1 second if zero
+	Breaker         BreakerOptions // Circuit breaker in front of Redis
 }
 
 // NewMultiCache initializes a new MultiCache with Redis and in-memory LRU caches.
 func NewMultiCache() *MultiCache {
+	return NewMultiCacheWithOptions(Options{})
+}
+
+// NewMultiCacheWithOptions initializes a new MultiCache with Redis and in-memory LRU caches configured by opts.
+func NewMultiCacheWithOptions(opts Options) *MultiCache {
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = 1 * time.Second
+	}
 	return &MultiCache{
-		redisCache:    redis.NewLRUCache(),
-		inMemoryCache: in_memory.NewLRUCache(1 * time.Second),
+		redisCache:      redis.NewLRUCacheWithOptions(opts.Redis),
+		inMemoryCache:   in_memory.NewLRUCache(opts.CleanupInterval),
+		cleanupInterval: opts.CleanupInterval,
+		namespaces:      make(map[string]*Namespace),
+		breaker:         newBreaker(opts.Breaker),
+	}
+}
+
+// Close stops the background work of every tier and closes the connections to Redis. Closing the
+// MultiCache of a namespace only stops its in-memory tier, since it shares Redis with its parent.
+func (c *MultiCache) Close() error {
+	errs := []error{}
+	if c.namespaces != nil {
+		for _, ns := range c.namespaceList() {
+			errs = append(errs, ns.inMemoryCache.Close())
+		}
+	}
+	errs = append(errs, c.inMemoryCache.Close())
+	if c.diskCache != nil {
+		errs = append(errs, c.diskCache.Close())
+	}
+	if c.namespaces != nil {
+		errs = append(errs, c.redisCache.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// SaveSnapshot writes the entries of the in-memory tier to the file at path, for LoadSnapshot to restore
+// after a restart. Namespaces and the other tiers are not included.
+func (c *MultiCache) SaveSnapshot(path string) error {
+	return c.inMemoryCache.Snapshot(path)
+}
+
+// LoadSnapshot adds the entries of a file written by SaveSnapshot to the in-memory tier. A missing file loads nothing.
+// Redis may have changed since the snapshot was saved, so the in-memory entries are then checked against the versions
+// Redis holds, snapshotBatch keys per HMGET, and those whose version differs are dropped, as are all of them if
+// Redis cannot be reached: reads would otherwise find a stale copy.
+func (c *MultiCache) LoadSnapshot(ctx context.Context, path string) error {
+	if err := c.inMemoryCache.Restore(path); err != nil {
+		return err
+	}
+	var entries []in_memory.Entry
+	c.inMemoryCache.Entries(0, func(entry in_memory.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	for start := 0; start < len(entries); start += snapshotBatch {
+		batch := entries[start:min(start+snapshotBatch, len(entries))]
+		keys := make([]string, len(batch))
+		for i, entry := range batch {
+			keys[i] = entry.Key
+		}
+		var versions []uint64
+		var err error
+		if !c.redisCall(ctx, func(ctx context.Context) { versions, err = c.redisCache.Versions(ctx, keys) }) || err != nil {
+			versions = make([]uint64, len(batch)) // No version can match
+		}
+		for i, entry := range batch {
+			if versions[i] != entry.Version || entry.Version == 0 {
+				c.inMemoryCache.DelVersion(entry.Key, entry.Version)
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotBatch is the number of keys LoadSnapshot checks against Redis at a time.
+const snapshotBatch = 256
+
+// Stats counts the reads of a MultiCache and holds the stats of its in-memory, Redis and disk tiers.
+type Stats struct {
+	Hits        uint64 // Reads answered with a value
+	Misses      uint64 // Reads answered without a value, divergences included
+	Divergences uint64 // Reads where the in-memory and Redis tiers held different values
+	InMemory    in_memory.Stats
+	Redis       redis.Stats
+	Disk        *disk.Stats // nil without a disk tier
+	Breaker     BreakerStats
+}
+
+// Stats returns the counts of reads of the cache and the stats of its tiers.
+func (c *MultiCache) Stats(ctx context.Context) Stats {
+	stats := Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Divergences: c.divergences.Load(),
+		InMemory:    c.inMemoryCache.Stats(),
+		Redis:       c.redisCache.Stats(ctx),
+		Breaker:     c.breaker.stats(),
+	}
+	if c.diskCache != nil {
+		diskStats := c.diskCache.Stats()
+		stats.Disk = &diskStats
+	}
+	return stats
+}
+
+// RedisLatencies calls fn with the latency histogram of every command sent to Redis, by command name.
+func (c *MultiCache) RedisLatencies(fn func(command string, latency metrics.HistogramSnapshot)) {
+	c.redisCache.Latencies(fn)
+}
+
+// RedisRetries calls fn with the number of retries of every operation Redis failed to answer, by operation name.
+func (c *MultiCache) RedisRetries(fn func(operation string, n uint64)) {
+	c.redisCache.Retries(fn)
+}
+
+// countRead counts a read that found value in Redis and inMemory as a hit, a miss or a divergence.
+func (c *MultiCache) countRead(value, inMemory string) {
+	switch {
+	case value != inMemory:
+		c.divergences.Add(1)
+		c.misses.Add(1)
+	case value == "":
+		c.misses.Add(1)
+	default:
+		c.hits.Add(1)
+	}
+}
+
+// Resize evicts the least recently used entries of every tier until at most length remain in each.
+// The disk tier and namespaces whose capacity is larger than length are capped to it: they keep that limit
+// for later writes. Later writes keep the other tiers within the length they are given, so pass the same length to them.
+func (c *MultiCache) Resize(ctx context.Context, length int) {
+	c.promoteTouched(ctx)
+	c.length.Store(int64(length))
+	c.inMemoryCache.Resize(length)
+	c.redisCache.Resize(ctx, length)
+	if c.diskCache != nil && c.diskLength.Load() > int64(length) {
+		c.diskLength.Store(int64(length))
+		c.diskCache.Resize(length)
+	}
+	if c.namespaces != nil {
+		for _, ns := range c.namespaceList() {
+			if ns.capacity.Load() > int64(length) {
+				ns.capacity.Store(int64(length))
+				ns.MultiCache.Resize(ctx, length)
+			}
+		}
+	}
+}
+
+// SetCleanupInterval changes how often the in-memory tiers, namespaces included, remove expired entries.
+// It panics if d is not positive.
+func (c *MultiCache) SetCleanupInterval(d time.Duration) {
+	c.nsMu.Lock()
+	c.cleanupInterval = d // Used by namespaces created from now on
+	c.nsMu.Unlock()
+	c.inMemoryCache.SetCleanupInterval(d)
+	if c.namespaces != nil {
+		for _, ns := range c.namespaceList() {
+			ns.inMemoryCache.SetCleanupInterval(d)
+		}
+	}
+}
+
+// NewMultiCacheWithDisk initializes a MultiCache that also keeps up to length entries
+// in a disk tier under dir, using at most maxBytes of disk.
+func NewMultiCacheWithDisk(dir string, length int, maxBytes int64) (*MultiCache, error) {
+	diskCache, err := disk.NewLRUCache(dir, maxBytes, 1*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := NewMultiCache()
+	c.diskCache = diskCache
+	c.diskLength.Store(int64(length))
+	return c, nil
+}
+
+// Set stores the key-value pair in every tier and returns the version Redis assigned to it.
+// The disk tier is written concurrently; the in-memory copy is written once Redis has answered,
+// carrying the same version, so every tier agrees on it.
+// Any tags given are attached to the key once it is stored, see Tag.
+// Only a namespace fails a write, when it exceeds its quota.
+func (c *MultiCache) Set(ctx context.Context, key, value string, length int, t int, tags ...string) (uint64, error) {
+	version, _, err := c.SetWithContentType(ctx, key, value, "", length, t, tags...)
+	return version, err
+}
+
+// SetWithContentType stores the key-value pair like Set along with the content type of the value,
+// which only Redis keeps. An empty content type stores the value without one, like Set.
+// It returns the version and whether Redis held the key before.
+// Without a content type, a JSON document is only replaced by JSON; other values fail with
+// jsondoc.ErrInvalidJSON and leave every tier alone. A TTL that is neither -1 nor greater than 0 fails with
+// redis.ErrInvalidTTL.
+func (c *MultiCache) SetWithContentType(ctx context.Context, key, value, contentType string, length int, t int, tags ...string) (uint64, bool, error) {
+	if t != -1 && t <= 0 {
+		return 0, false, redis.ErrInvalidTTL // Checked here too, so a write is refused even while Redis is skipped
+	}
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, replacing(key, value))
+	if err != nil {
+		return 0, false, err
+	}
+	defer done()
+	var version uint64
+	var existed bool
+	ok := c.redisCall(ctx, func(ctx context.Context) {
+		version, existed, err = c.redisCache.PutWithContentType(ctx, key, value, contentType, length, t)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	var wg sync.WaitGroup
+	if c.diskCache != nil {
+		// Store in disk cache concurrently, using the tier's own capacity and the version Redis assigned
+		wg.Add(1)
+		go func(version uint64) {
+			defer wg.Done()
+			c.diskCache.PutWithVersion(key, value, int(c.diskLength.Load()), t, version)
+		}(version)
+	}
+	if ok {
+		c.inMemoryCache.PutWithVersion(key, value, length, t, version)
+	} else {
+		existed = c.inMemoryCache.Type(key) != "none"
+		version = c.inMemoryCache.PutWithVersion(key, value, length, t, 0)
+		c.degrade(length, key)
+	}
+	if len(tags) > 0 {
+		c.Tag(ctx, key, tags...)
+	}
+	wg.Wait() // Wait for the disk tier to finish
+	return version, existed, nil
+}
+
+// IncrBy atomically adds delta to the integer value of key and returns the new value.
+// Redis is authoritative: the increment runs there with INCRBY and the other tiers mirror its result
+// along with the expiration Redis keeps for the key.
+func (c *MultiCache) IncrBy(ctx context.Context, key string, delta int64, length int) (int64, error) {
+	length = c.writeLength(ctx, length)
+	// An integer takes at most 20 bytes
+	done, err := c.admit(ctx, in_memory.QuotaWrite{Key: key, Size: int64(len(key)) + 20, Replace: true})
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	var value int64
+	var version uint64
+	var ttl time.Duration
+	ok := c.redisCall(ctx, func(ctx context.Context) { value, version, ttl, err = c.redisCache.IncrBy(ctx, key, delta, length) })
+	if !ok {
+		value, err = c.inMemoryCache.IncrBy(key, delta, length)
+		c.degrade(length, key)
+	}
+	if err != nil {
+		return 0, err
+	}
+	str := strconv.FormatInt(value, 10)
+	if !ok {
+		if c.diskCache != nil {
+			c.diskCache.PutKeepTTL(key, str, int(c.diskLength.Load()))
+		}
+		return value, nil
+	}
+	// Mirror the result with the TTL Redis reports; the version keeps a slower mirror of an older
+	// increment from overwriting a newer one in memory
+	c.inMemoryCache.PutWithExpiration(key, str, length, ttl, version)
+	if c.diskCache != nil {
+		c.diskCache.PutWithVersion(key, str, int(c.diskLength.Load()), ttlSeconds(ttl), version)
+	}
+	return value, nil
+}
+
+// SetNX stores the key-value pair only if the key does not exist.
+// Redis decides atomically and the other tiers mirror a successful write.
+// It returns the new version and whether the value was stored.
+func (c *MultiCache) SetNX(ctx context.Context, key, value string, length int, t int) (uint64, bool, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, replacing(key, value))
+	if err != nil {
+		return 0, false, err
+	}
+	defer done()
+	var version uint64
+	var stored bool
+	if !c.redisCall(ctx, func(ctx context.Context) { version, stored, err = c.redisCache.SetNX(ctx, key, value, length, t) }) {
+		stored = c.inMemoryCache.SetNX(key, value, length, t)
+		return c.degradedWrite(key, value, length, t, stored), stored, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if stored {
+		c.mirror(key, value, length, t, version)
+	}
+	return version, stored, nil
+}
+
+// SetXX stores the key-value pair only if the key already exists.
+// Redis decides atomically and the other tiers mirror a successful write.
+// It returns the new version and whether the value was stored.
+func (c *MultiCache) SetXX(ctx context.Context, key, value string, length int, t int) (uint64, bool, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, replacing(key, value))
+	if err != nil {
+		return 0, false, err
+	}
+	defer done()
+	var version uint64
+	var stored bool
+	if !c.redisCall(ctx, func(ctx context.Context) { version, stored, err = c.redisCache.SetXX(ctx, key, value, length, t) }) {
+		stored = c.inMemoryCache.SetXX(key, value, length, t)
+		return c.degradedWrite(key, value, length, t, stored), stored, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if stored {
+		c.mirror(key, value, length, t, version)
+	}
+	return version, stored, nil
+}
+
+// GetSet stores the key-value pair and returns the previous value held by Redis and the new version.
+// The boolean reports whether the key existed before.
+func (c *MultiCache) GetSet(ctx context.Context, key, value string, length int, t int) (string, uint64, bool, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, replacing(key, value))
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer done()
+	var old string
+	var version uint64
+	var existed bool
+	if !c.redisCall(ctx, func(ctx context.Context) {
+		old, version, existed, err = c.redisCache.GetSet(ctx, key, value, length, t)
+	}) {
+		old, existed = c.inMemoryCache.GetSet(key, value, length, t)
+		return old, c.degradedWrite(key, value, length, t, true), existed, nil
+	}
+	if err != nil {
+		return "", 0, false, err
+	}
+	c.mirror(key, value, length, t, version)
+	return old, version, existed, nil
+}
+
+// CompareAndSwap stores newValue only if the key currently holds oldValue in Redis.
+// It returns the new version and whether the value was swapped; the other tiers mirror a successful swap.
+func (c *MultiCache) CompareAndSwap(ctx context.Context, key, oldValue, newValue string, length int, t int) (uint64, bool, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, replacing(key, newValue))
+	if err != nil {
+		return 0, false, err
+	}
+	defer done()
+	var version uint64
+	var stored bool
+	if !c.redisCall(ctx, func(ctx context.Context) {
+		version, stored, err = c.redisCache.CompareAndSwap(ctx, key, oldValue, newValue, length, t)
+	}) {
+		stored = c.inMemoryCache.CompareAndSwap(key, oldValue, newValue, length, t)
+		return c.degradedWrite(key, newValue, length, t, stored), stored, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if stored {
+		c.mirror(key, newValue, length, t, version)
+	}
+	return version, stored, nil
+}
+
+// CompareVersionAndSwap stores the value only if the key's version in Redis equals version.
+// It returns the new version and whether the value was stored; the other tiers mirror a successful swap.
+func (c *MultiCache) CompareVersionAndSwap(ctx context.Context, key string, version uint64, value string, length int, t int) (uint64, bool, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, replacing(key, value))
+	if err != nil {
+		return 0, false, err
+	}
+	defer done()
+	var newVersion uint64
+	var stored bool
+	if !c.redisCall(ctx, func(ctx context.Context) {
+		newVersion, stored, err = c.redisCache.CompareVersionAndSwap(ctx, key, version, value, length, t)
+	}) {
+		_, stored = c.inMemoryCache.CompareVersionAndSwap(key, version, value, length, t)
+		return c.degradedWrite(key, value, length, t, stored), stored, nil
 	}
+	if err != nil {
+		return 0, false, err
+	}
+	if stored {
+		c.mirror(key, value, length, t, newVersion)
+	}
+	return newVersion, stored, nil
+}
+
+// writeLength returns the length a write may fill the tiers to: the capacity of a namespace, which replaces the
+// length the write was given, or that length in the root cache. It is recorded for promotions from the disk tier.
+// The keys read from memory since the last write are promoted in Redis first, so it evicts the same keys.
+func (c *MultiCache) writeLength(ctx context.Context, length int) int {
+	c.promoteTouched(ctx)
+	if capacity := c.capacity.Load(); capacity > 0 {
+		length = int(capacity)
+	}
+	c.length.Store(int64(length))
+	return length
+}
+
+// mirror copies a write that already succeeded in Redis to the in-memory and disk tiers.
+// Both tiers ignore mirrored writes older than the version they hold, so concurrent
+// mirrors cannot be applied out of order.
+func (c *MultiCache) mirror(key, value string, length int, t int, version uint64) {
+	c.inMemoryCache.PutWithVersion(key, value, length, t, version)
+	if c.diskCache != nil {
+		c.diskCache.PutWithVersion(key, value, int(c.diskLength.Load()), t, version)
+	}
+}
+
+// Incr increments the integer value of key by one.
+func (c *MultiCache) Incr(ctx context.Context, key string, length int) (int64, error) {
+	return c.IncrBy(ctx, key, 1, length)
+}
+
+// Decr decrements the integer value of key by one.
+func (c *MultiCache) Decr(ctx context.Context, key string, length int) (int64, error) {
+	return c.IncrBy(ctx, key, -1, length)
 }
 
-// Set stores the key-value pair in both Redis and in-memory caches concurrently.
-func (c *MultiCache) Set(key, value string, length int, t int) {
+// Get retrieves the value for a key from both Redis and in-memory caches concurrently and compares them.
+func (c *MultiCache) Get(ctx context.Context, key string) string {
+	value, _ := c.GetWithVersion(ctx, key)
+	return value
+}
+
+// GetWithContentType retrieves the value for a key like GetWithVersion, along with the content type it was
+// stored with. The content type is empty if the value has none or was served by the disk tier.
+// Redis returns the content type along with the value, in the same round trip.
+func (c *MultiCache) GetWithContentType(ctx context.Context, key string) (string, uint64, string) {
+	return c.get(ctx, key, true)
+}
+
+// GetWithVersion retrieves the value for a key like Get, along with the version Redis assigned to it.
+// The version is 0 if the key is not found or was served by the disk tier.
+func (c *MultiCache) GetWithVersion(ctx context.Context, key string) (string, uint64) {
+	value, version, _ := c.get(ctx, key, false)
+	return value, version
+}
+
+// get retrieves the value for a key and its version from both Redis and in-memory caches concurrently,
+// along with the content type Redis keeps for it if withContentType is set.
+func (c *MultiCache) get(ctx context.Context, key string, withContentType bool) (string, uint64, string) {
+	var redis_value, inmemory_value, contentType string
+	var version, inmemory_version uint64
+	var ok bool
 	var wg sync.WaitGroup
 	wg.Add(2) // Add two goroutines to the wait group
-	// Store in Redis cache concurrently
+	// Retrieve value from in-memory cache concurrently
 	go func() {
 		defer wg.Done()
-		c.redisCache.Put(key, value, length, t)
+		inmemory_value, inmemory_version = c.inMemoryCache.GetWithVersion(key)
 	}()
-	// Store in inmemory cache concurrently
+	// Retrieve value from redis cache concurrently
 	go func() {
 		defer wg.Done()
-		c.inMemoryCache.Put(key, value, length, t)
+		ok = c.redisCall(ctx, func(ctx context.Context) {
+			if withContentType {
+				redis_value, version, contentType = c.redisCache.GetWithContentType(ctx, key)
+			} else {
+				redis_value, version = c.redisCache.GetWithVersion(ctx, key)
+			}
+		})
 	}()
 	wg.Wait() // Wait for both goroutines to finish
+	if !ok {
+		// Serve the in-memory copy alone while Redis is unavailable
+		c.degrade(0)
+		redis_value, version, contentType = inmemory_value, inmemory_version, ""
+	}
+
+	// Fall back to the disk tier when neither Redis nor the in-memory cache holds the key
+	if redis_value == "" && inmemory_value == "" && c.diskCache != nil {
+		value := c.diskCache.Get(key)
+		c.countRead(value, value)
+		if value != "" && ok {
+			version = c.promote(ctx, key, value)
+		}
+		return value, version, ""
+	}
+
+	// Return the value if they match, otherwise return an empty string
+	c.countRead(redis_value, inmemory_value)
+	if redis_value == inmemory_value {
+		return redis_value, version, contentType
+	} else {
+		return "", 0, ""
+	}
+
 }
 
-// Get retrieves the value for a key from both Redis and in-memory caches concurrently and compares them.
-func (c *MultiCache) Get(key string) string {
+// promote copies a value found only in the disk tier into Redis and the in-memory cache with its remaining TTL,
+// so the next reads are served by the faster tiers. A key written to Redis in the meantime is left alone.
+// It returns the version of the promoted value, or 0 if it was not promoted.
+func (c *MultiCache) promote(ctx context.Context, key, value string) uint64 {
+	length := int(c.length.Load())
+	if length <= 0 {
+		return 0 // No write has told the capacity of the faster tiers yet
+	}
+	t := ttlSeconds(c.diskCache.TTL(key))
+	var version uint64
+	var stored bool
+	var err error
+	if !c.redisCall(ctx, func(ctx context.Context) { version, stored, err = c.redisCache.SetNX(ctx, key, value, length, t) }) || !stored || err != nil {
+		return 0
+	}
+	c.inMemoryCache.PutWithVersion(key, value, length, t, version)
+	return version
+}
+
+// KeyInfo describes a key across all cache tiers.
+type KeyInfo struct {
+	CreatedAt   time.Time     // Time the key was first stored in memory
+	LastAccess  time.Time     // Time of the last read or write in memory
+	TTL         time.Duration // Remaining time to live, -1 if the key never expires
+	AccessCount int64         // Number of reads served by the in-memory cache
+	Size        int           // Size of the key and value in bytes
+	Version     uint64        // Version of the value, as assigned by Redis
+	Tiers       []string      // Tiers that currently hold the key
+}
+
+// Names of the cache tiers reported by Inspect.
+const (
+	TierInMemory = "inmemory"
+	TierRedis    = "redis"
+	TierDisk     = "disk"
+)
+
+// Peek retrieves the value for a key like Get, without changing recency in any tier.
+func (c *MultiCache) Peek(ctx context.Context, key string) string {
 	var redis_value, inmemory_value string
+	var ok bool
 	var wg sync.WaitGroup
 	wg.Add(2) // Add two goroutines to the wait group
-	// Retrieve value from in-memory cache concurrently
+	// Peek in-memory cache concurrently
 	go func() {
 		defer wg.Done()
-		inmemory_value = c.inMemoryCache.Get(key)
+		inmemory_value = c.inMemoryCache.Peek(key)
 	}()
-	// Retrieve value from redis cache concurrently
+	// Peek redis cache concurrently
 	go func() {
 		defer wg.Done()
-		redis_value = c.redisCache.Get(key)
+		ok = c.redisCall(ctx, func(ctx context.Context) { redis_value = c.redisCache.Peek(ctx, key) })
 	}()
 	wg.Wait() // Wait for both goroutines to finish
+	if !ok {
+		c.degrade(0)
+		redis_value = inmemory_value
+	}
 
-	// Return the value if they match, otherwise return an empty string
+	if redis_value == "" && inmemory_value == "" && c.diskCache != nil {
+		return c.diskCache.Peek(key)
+	}
 	if redis_value == inmemory_value {
 		return redis_value
-	} else {
-		return ""
 	}
+	return ""
+}
+
+// Inspect returns metadata about a key and the tiers holding it, without changing recency.
+// Access statistics come from the in-memory cache; TTL and size fall back to Redis when memory misses.
+// The boolean is false if no tier holds the key.
+func (c *MultiCache) Inspect(ctx context.Context, key string) (KeyInfo, bool) {
+	var memInfo in_memory.EntryInfo
+	var redisInfo redis.EntryInfo
+	var inMemory, inRedis, onDisk bool
+	var wg sync.WaitGroup
+	wg.Add(2) // Add two goroutines to the wait group
+	go func() {
+		defer wg.Done()
+		memInfo, inMemory = c.inMemoryCache.Inspect(key)
+	}()
+	go func() {
+		defer wg.Done()
+		if !c.redisCall(ctx, func(ctx context.Context) { redisInfo, inRedis = c.redisCache.Inspect(ctx, key) }) {
+			c.degrade(0)
+		}
+	}()
+	if c.diskCache != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			onDisk = c.diskCache.Has(key)
+		}()
+	}
+	wg.Wait() // Wait for all goroutines to finish
 
+	info := KeyInfo{Tiers: []string{}}
+	if inMemory {
+		info.Tiers = append(info.Tiers, TierInMemory)
+		info.CreatedAt = memInfo.CreatedAt
+		info.LastAccess = memInfo.LastAccess
+		info.TTL = memInfo.TTL
+		info.AccessCount = memInfo.AccessCount
+		info.Size = memInfo.Size
+		info.Version = memInfo.Version
+	}
+	if inRedis {
+		info.Tiers = append(info.Tiers, TierRedis)
+		info.Version = redisInfo.Version // Redis assigns versions, so its view wins
+		if !inMemory {
+			info.TTL = redisInfo.TTL
+			info.Size = redisInfo.Size
+		}
+	}
+	if onDisk {
+		info.Tiers = append(info.Tiers, TierDisk)
+	}
+	return info, len(info.Tiers) > 0
+}
+
+// Expire sets the time to live of a key in every tier concurrently without rewriting its value.
+// A non-positive duration deletes the key. It reports whether any tier held the key.
+func (c *MultiCache) Expire(ctx context.Context, key string, d time.Duration) bool {
+	return c.forEachTier(
+		func() bool { return c.inMemoryCache.Expire(key, d) },
+		func() bool {
+			var found bool
+			if !c.redisCall(ctx, func(ctx context.Context) { found = c.redisCache.Expire(ctx, key, d) }) {
+				c.degrade(0, key)
+			}
+			return found
+		},
+		func() bool { return c.diskCache.Expire(key, d) },
+	)
+}
+
+// Persist removes the expiration of a key in every tier concurrently.
+// It reports whether any tier held the key.
+func (c *MultiCache) Persist(ctx context.Context, key string) bool {
+	return c.forEachTier(
+		func() bool { return c.inMemoryCache.Persist(key) },
+		func() bool {
+			var found bool
+			if !c.redisCall(ctx, func(ctx context.Context) { found = c.redisCache.Persist(ctx, key) }) {
+				c.degrade(0, key)
+			}
+			return found
+		},
+		func() bool { return c.diskCache.Persist(key) },
+	)
+}
+
+// Touch marks a key as recently used in every tier concurrently without reading it.
+// It reports whether any tier held the key.
+func (c *MultiCache) Touch(ctx context.Context, key string) bool {
+	return c.forEachTier(
+		func() bool { return c.inMemoryCache.Touch(key) },
+		func() bool {
+			var found bool
+			if !c.redisCall(ctx, func(ctx context.Context) { found = c.redisCache.Touch(ctx, key) }) {
+				c.degrade(0)
+			}
+			return found
+		},
+		func() bool { return c.diskCache.Touch(key) },
+	)
+}
+
+// TTL returns the remaining time to live of a key, -1 if it never expires and -2 if no tier holds it.
+// The in-memory cache is consulted first, then Redis and the disk tier.
+func (c *MultiCache) TTL(ctx context.Context, key string) time.Duration {
+	if ttl := c.inMemoryCache.TTL(key); ttl != in_memory.KeyNotFound {
+		return ttl
+	}
+	ttl := time.Duration(-2)
+	if !c.redisCall(ctx, func(ctx context.Context) { ttl = c.redisCache.TTL(ctx, key) }) {
+		c.degrade(0)
+	}
+	if ttl != -2 {
+		return ttl
+	}
+	if c.diskCache != nil {
+		return c.diskCache.TTL(key)
+	}
+	return -2
+}
+
+// forEachTier runs one operation per tier concurrently, skipping the disk tier when it is disabled,
+// and reports whether any of them returned true.
+func (c *MultiCache) forEachTier(inMemory, redis, disk func() bool) bool {
+	ops := []func() bool{inMemory, redis}
+	if c.diskCache != nil {
+		ops = append(ops, disk)
+	}
+	results := make([]bool, len(ops))
+	var wg sync.WaitGroup
+	wg.Add(len(ops)) // Add one goroutine per tier to the wait group
+	for i, op := range ops {
+		go func(i int, op func() bool) {
+			defer wg.Done()
+			results[i] = op()
+		}(i, op)
+	}
+	wg.Wait() // Wait for all goroutines to finish
+
+	for _, found := range results {
+		if found {
+			return true
+		}
+	}
+	return false
 }
 
 // Print_redis prints the contents of the Redis cache.
-func (c *MultiCache) Print_redis() string {
+func (c *MultiCache) Print_redis(ctx context.Context) string {
 	var wg sync.WaitGroup
 	wg.Add(1) // Add one goroutine to the wait group
 	var result string
@@ -74,7 +772,7 @@ func (c *MultiCache) Print_redis() string {
 	// Print the Redis cache contents concurrently
 	go func() {
 		defer wg.Done()
-		result = c.redisCache.Print()
+		result = c.redisCache.Print(ctx)
 	}()
 
 	wg.Wait() // Wait for the goroutine to finish
@@ -97,10 +795,26 @@ func (c *MultiCache) Print_in_mem() string {
 	return result
 }
 
+// Print_disk prints the contents of the disk cache, or an empty string when the tier is disabled.
+func (c *MultiCache) Print_disk() string {
+	if c.diskCache == nil {
+		return ""
+	}
+	return c.diskCache.Print()
+}
+
 // Del deletes the key-value pair from both Redis and in-memory caches concurrently.
-func (c *MultiCache) Del(key string) {
+func (c *MultiCache) Del(ctx context.Context, key string) {
 	var wg sync.WaitGroup
 	wg.Add(2) // Add two goroutines to the wait group
+	if c.diskCache != nil {
+		// Delete from disk cache concurrently
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.diskCache.Del(key)
+		}()
+	}
 
 	// Delete from in-memory cache concurrently
 	go func() {
@@ -111,28 +825,63 @@ func (c *MultiCache) Del(key string) {
 	// Delete from Redis cache concurrently
 	go func() {
 		defer wg.Done()
-		c.redisCache.Del(key)
+		if !c.redisCall(ctx, func(ctx context.Context) { c.redisCache.Del(ctx, key) }) {
+			c.degrade(0, key)
+		}
 	}()
 
 	wg.Wait() // Wait for both goroutines to finish
 }
 
 // Del_ALL deletes the entire data from both Redis and in-memory caches concurrently.
-func (c *MultiCache) Del_ALL() {
+// On the root cache this includes the entries of every namespace, though the namespaces themselves remain.
+// While Redis is skipped, only the keys memory held are deleted from Redis once it is back, see redisCall.
+func (c *MultiCache) Del_ALL(ctx context.Context) {
 	var wg sync.WaitGroup
 	wg.Add(2) // Add two goroutines to the wait group
+	if c.diskCache != nil {
+		// Delete from disk cache concurrently
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.diskCache.DEL_ALL()
+		}()
+	}
 
-	// Delete from in-memory cache concurrently
+	// Delete from in-memory cache concurrently, remembering the keys in case Redis is skipped
+	var cleared []string
 	go func() {
 		defer wg.Done()
-		c.inMemoryCache.DEL_ALL()
+		cleared = c.clearInMemory()
 	}()
 
 	// Delete from Redis cache concurrently
+	ok := true
 	go func() {
 		defer wg.Done()
-		c.redisCache.DEL_ALL()
+		ok = c.redisCall(ctx, func(ctx context.Context) { c.redisCache.DEL_ALL(ctx) })
 	}()
 
 	wg.Wait() // Wait for both goroutines to finish
+	if !ok {
+		c.degrade(0, cleared...)
+	}
+
+	// Flushing Redis also removed the entries of every namespace
+	for _, ns := range c.namespaceList() {
+		if keys := ns.clearInMemory(); !ok {
+			ns.outage.add(0, keys...)
+		}
+	}
+}
+
+// clearInMemory empties the in-memory tier and returns the keys it held.
+func (c *MultiCache) clearInMemory() []string {
+	var keys []string
+	c.inMemoryCache.Entries(0, func(e in_memory.Entry) bool {
+		keys = append(keys, e.Key)
+		return true
+	})
+	c.inMemoryCache.DEL_ALL()
+	return keys
 }
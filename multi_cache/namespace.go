@@ -0,0 +1,169 @@
+package multi_cache
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+
+	"github.com/devisettymahidhar315/zin1/in_memory"
+)
+
+// Errors returned by CreateNamespace.
+var (
+	ErrInvalidNamespace = errors.New("invalid namespace name: use 1 to 64 letters, digits, '-' or '_'")
+	ErrInvalidCapacity  = errors.New("invalid namespace capacity: must be greater than 0")
+	ErrInvalidTTL       = errors.New("invalid namespace default TTL: must be -1 (no expiration) or greater than 0")
+	ErrNamespaceExists  = errors.New("namespace already exists")
+	ErrNestedNamespace  = errors.New("namespaces can only be created in the root cache")
+)
+
+// namespaceName matches valid namespace names, which must not contain glob characters.
+var namespaceName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// NamespaceOptions configures a namespace.
+type NamespaceOptions struct {
+	Capacity   int   // Maximum number of entries in each tier of the namespace
+	DefaultTTL int   // TTL in seconds for writes that do not give one, -1 (or 0) for no expiration
+	Quota      Quota // Hard limits on the writes to the namespace, see SetQuota
+}
+
+// Namespace is a logical database within a MultiCache, with its own keys, capacity and eviction accounting.
+// It embeds a MultiCache whose Redis keys live under the namespace prefix and whose in-memory tier is its own;
+// namespaces have no disk tier. Every write fills the tiers up to the capacity of the namespace, whatever
+// length it is given, and every write that may add entries or bytes, such as Set, MSet, IncrBy or HSet, fails
+// with ErrRateLimited, ErrEntriesQuota or ErrBytesQuota without writing if it would exceed the quota.
+type Namespace struct {
+	*MultiCache
+	name string
+	opts NamespaceOptions
+}
+
+// NamespaceInfo describes a namespace and its usage.
+type NamespaceInfo struct {
+	Name       string
+	Capacity   int
+	DefaultTTL int
+	Quota      Quota
+	Entries    int    // Number of entries held by Redis
+	Bytes      int64  // Size of the keys and values held by Redis
+	Evictions  uint64 // Number of entries Redis evicted to stay within the capacity
+	Rejected   uint64 // Number of writes rejected because of the quota
+
+	InMemoryEvictions uint64 // Number of entries the in-memory tier evicted to stay within the capacity
+}
+
+// Name returns the name of the namespace.
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// Options returns the options of the namespace, including its current quota.
+func (n *Namespace) Options() NamespaceOptions {
+	opts := n.opts
+	opts.Capacity = int(n.capacity.Load())
+	opts.Quota = n.Quota()
+	return opts
+}
+
+// Info returns the configuration and usage of the namespace.
+func (n *Namespace) Info(ctx context.Context) NamespaceInfo {
+	n.limits.mu.Lock()
+	quota, rejected := n.limits.quota, n.limits.rejected
+	n.limits.mu.Unlock()
+	return NamespaceInfo{
+		Name:       n.name,
+		Capacity:   int(n.capacity.Load()),
+		DefaultTTL: n.opts.DefaultTTL,
+		Quota:      quota,
+		Entries:    n.redisCache.Len(ctx),
+		Bytes:      n.redisCache.Bytes(ctx),
+		Evictions:  n.redisCache.Evictions(),
+		Rejected:   rejected,
+
+		InMemoryEvictions: n.inMemoryCache.Evictions(),
+	}
+}
+
+// CreateNamespace creates a namespace in this process. Namespaces are shared through Redis, so keys already
+// stored under the same name, by another replica or a previous process, are kept; DropNamespace deletes them.
+func (c *MultiCache) CreateNamespace(ctx context.Context, name string, opts NamespaceOptions) (*Namespace, error) {
+	if !namespaceName.MatchString(name) {
+		return nil, ErrInvalidNamespace
+	}
+	if opts.Capacity <= 0 {
+		return nil, ErrInvalidCapacity
+	}
+	if opts.DefaultTTL == 0 {
+		opts.DefaultTTL = -1
+	} else if opts.DefaultTTL < -1 {
+		return nil, ErrInvalidTTL
+	}
+	if err := opts.Quota.validate(); err != nil {
+		return nil, err
+	}
+	c.nsMu.Lock()
+	defer c.nsMu.Unlock()
+	if c.namespaces == nil {
+		return nil, ErrNestedNamespace
+	}
+	if _, found := c.namespaces[name]; found {
+		return nil, ErrNamespaceExists
+	}
+	ns := &Namespace{
+		MultiCache: &MultiCache{
+			redisCache:    c.redisCache.Namespace(name),
+			inMemoryCache: in_memory.NewLRUCache(c.cleanupInterval),
+			breaker:       c.breaker,
+			limits:        &quotaState{quota: opts.Quota},
+		},
+		name: name,
+		opts: opts,
+	}
+	ns.capacity.Store(int64(opts.Capacity))
+	c.namespaces[name] = ns
+	return ns, nil
+}
+
+// Namespace returns the namespace with the given name.
+func (c *MultiCache) Namespace(name string) (*Namespace, bool) {
+	c.nsMu.Lock()
+	defer c.nsMu.Unlock()
+	ns, found := c.namespaces[name]
+	return ns, found
+}
+
+// Namespaces returns the configuration and usage of every namespace, sorted by name.
+func (c *MultiCache) Namespaces(ctx context.Context) []NamespaceInfo {
+	infos := []NamespaceInfo{}
+	for _, ns := range c.namespaceList() {
+		infos = append(infos, ns.Info(ctx))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// DropNamespace deletes a namespace and all of its entries. It reports whether the namespace existed.
+func (c *MultiCache) DropNamespace(ctx context.Context, name string) bool {
+	c.nsMu.Lock()
+	ns, found := c.namespaces[name]
+	delete(c.namespaces, name)
+	c.nsMu.Unlock()
+	if !found {
+		return false
+	}
+	ns.Del_ALL(ctx)
+	ns.inMemoryCache.Close()
+	return true
+}
+
+// namespaceList returns the current namespaces without holding the lock afterwards.
+func (c *MultiCache) namespaceList() []*Namespace {
+	c.nsMu.Lock()
+	defer c.nsMu.Unlock()
+	list := make([]*Namespace, 0, len(c.namespaces))
+	for _, ns := range c.namespaces {
+		list = append(list, ns)
+	}
+	return list
+}
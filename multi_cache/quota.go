@@ -0,0 +1,187 @@
+package multi_cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/redis"
+)
+
+// Quota sets hard limits on a namespace. Zero fields are not enforced.
+// Unlike the capacity, which evicts the least recently used entries, a quota rejects the write.
+type Quota struct {
+	MaxEntries         int     // Maximum number of entries
+	MaxBytes           int64   // Maximum size of all keys and values in bytes
+	MaxWritesPerSecond float64 // Maximum sustained write rate, with bursts of up to one second of writes
+}
+
+// Errors returned by the writes to a namespace when its quota is exceeded.
+var (
+	ErrEntriesQuota = in_memory.ErrEntriesQuota
+	ErrBytesQuota   = in_memory.ErrBytesQuota
+	ErrRateLimited  = errors.New("write rate limit exceeded")
+	ErrInvalidQuota = errors.New("invalid quota: limits must not be negative")
+)
+
+// validate checks that no limit is negative.
+func (q Quota) validate() error {
+	if q.MaxEntries < 0 || q.MaxBytes < 0 || q.MaxWritesPerSecond < 0 {
+		return ErrInvalidQuota
+	}
+	return nil
+}
+
+// rateLimiter is a token bucket refilled at the configured rate.
+type rateLimiter struct {
+	tokens float64   // Writes currently allowed
+	last   time.Time // Time of the last refill, zero before the first write
+}
+
+// allow reports whether n writes are allowed at rate writes per second and takes a token for each if so.
+// A batch is allowed while a token is left, the writes beyond it being paid back before the next one.
+// A rate of zero or less allows every write.
+func (l *rateLimiter) allow(rate float64, n int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	burst := math.Max(rate, 1)
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens = math.Min(burst, l.tokens+now.Sub(l.last).Seconds()*rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
+}
+
+// RateLimiter limits a rate of events with the token bucket of namespace quotas and is safe for concurrent use.
+// The zero value allows every event.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // Events allowed per second, 0 for no limit
+	limiter rateLimiter
+}
+
+// SetRate changes the events allowed per second, with bursts of up to one second of events.
+// A rate of zero or less allows every event.
+func (l *RateLimiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+}
+
+// Allow reports whether an event is allowed now and counts it if so.
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limiter.allow(l.rate, 1, time.Now())
+}
+
+// quotaState holds the quota of a namespace and what is needed to enforce it.
+type quotaState struct {
+	mu       sync.Mutex // Serializes quota checks with the writes they admit
+	quota    Quota
+	limiter  rateLimiter
+	rejected uint64 // Writes rejected by the quota
+}
+
+// Quota returns the quota of the namespace.
+func (n *Namespace) Quota() Quota {
+	n.limits.mu.Lock()
+	defer n.limits.mu.Unlock()
+	return n.limits.quota
+}
+
+// SetQuota replaces the quota of the namespace. Entries already stored are kept even if they exceed it.
+func (n *Namespace) SetQuota(q Quota) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	n.limits.mu.Lock()
+	defer n.limits.mu.Unlock()
+	n.limits.quota = q
+	return nil
+}
+
+// Put stores the key-value pair in the namespace like Set, using the capacity of the namespace.
+// A TTL of 0 uses the default TTL of the namespace.
+// It returns ErrRateLimited, ErrEntriesQuota or ErrBytesQuota without writing if the quota is exceeded.
+func (n *Namespace) Put(ctx context.Context, key, value string, t int) (uint64, error) {
+	if t == 0 {
+		t = n.opts.DefaultTTL
+	}
+	return n.Set(ctx, key, value, int(n.capacity.Load()), t)
+}
+
+// replacing describes for admit a write replacing the value of key with value.
+func replacing(key, value string) in_memory.QuotaWrite {
+	return in_memory.QuotaWrite{Key: key, Size: int64(len(key) + len(value)), Replace: true}
+}
+
+// adding describes for admit a write adding the given items to the hash, list or set stored at key.
+func adding(key string, items ...string) in_memory.QuotaWrite {
+	w := in_memory.QuotaWrite{Key: key}
+	for _, item := range items {
+		w.Size += int64(len(item))
+	}
+	return w
+}
+
+// admit checks writes against the quota of a namespace, taking one write per key from its rate limit, and
+// returns ErrRateLimited, ErrEntriesQuota or ErrBytesQuota if they would exceed it; the root cache has no quota.
+// Admitted writes must be made before calling done, so concurrent writes cannot each take the last room left.
+func (c *MultiCache) admit(ctx context.Context, writes ...in_memory.QuotaWrite) (done func(), err error) {
+	if c.limits == nil {
+		return func() {}, nil
+	}
+	c.limits.mu.Lock()
+	q := c.limits.quota
+	if err := c.checkQuota(ctx, q, writes); err != nil {
+		c.limits.rejected++
+		c.limits.mu.Unlock()
+		return nil, err
+	}
+	if q.MaxEntries == 0 && q.MaxBytes == 0 {
+		// Only the rate is limited, which the write cannot change
+		c.limits.mu.Unlock()
+		return func() {}, nil
+	}
+	return c.limits.mu.Unlock, nil
+}
+
+// checkQuota implements admit. The caller must hold c.limits.mu.
+func (c *MultiCache) checkQuota(ctx context.Context, q Quota, writes []in_memory.QuotaWrite) error {
+	if !c.limits.limiter.allow(q.MaxWritesPerSecond, len(writes), time.Now()) {
+		return ErrRateLimited
+	}
+	if q.MaxEntries == 0 && q.MaxBytes == 0 {
+		return nil
+	}
+	if err := c.inMemoryCache.CheckWrites(writes, in_memory.Quota{MaxEntries: q.MaxEntries, MaxBytes: q.MaxBytes}); err != nil {
+		return err
+	}
+	// Redis is authoritative on the entries and bytes it holds; while it is unavailable the in-memory check stands
+	redisWrites := make([]redis.QuotaWrite, len(writes))
+	for i, w := range writes {
+		redisWrites[i] = redis.QuotaWrite(w)
+	}
+	var entries, bytes bool
+	c.redisCall(ctx, func(ctx context.Context) {
+		entries, bytes = c.redisCache.Exceeds(ctx, redisWrites, q.MaxEntries, q.MaxBytes)
+	})
+	if entries {
+		return ErrEntriesQuota
+	}
+	if bytes {
+		return ErrBytesQuota
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package multi_cache
+
+import "context"
+
+// Tag attaches tags to an existing key in both Redis and in-memory caches.
+// Redis is authoritative; the boolean reports whether it held the key.
+// The disk tier does not index tags, InvalidateTag removes tagged keys from it by name.
+func (c *MultiCache) Tag(ctx context.Context, key string, tags ...string) bool {
+	var found bool
+	if !c.redisCall(ctx, func(ctx context.Context) { found = c.redisCache.Tag(ctx, key, tags...) }) {
+		c.degrade(0)
+		return c.inMemoryCache.Tag(key, tags...)
+	}
+	if !found {
+		return false
+	}
+	c.inMemoryCache.Tag(key, tags...)
+	return true
+}
+
+// KeysByTag returns the keys carrying the given tag according to Redis, or to the in-memory tier while
+// Redis is unavailable.
+func (c *MultiCache) KeysByTag(ctx context.Context, tag string) []string {
+	var keys []string
+	if !c.redisCall(ctx, func(ctx context.Context) { keys = c.redisCache.KeysByTag(ctx, tag) }) {
+		c.degrade(0)
+		return c.inMemoryCache.KeysByTag(tag)
+	}
+	return keys
+}
+
+// InvalidateTag deletes every key carrying the given tag from every tier and returns how many Redis held.
+func (c *MultiCache) InvalidateTag(ctx context.Context, tag string) int {
+	// Collect the in-memory keys first so the disk tier also loses keys Redis already expired
+	keys := c.inMemoryCache.KeysByTag(tag)
+	var deleted []string
+	if !c.redisCall(ctx, func(ctx context.Context) { deleted = c.redisCache.InvalidateTag(ctx, tag) }) {
+		c.degrade(0)
+		c.outage.addTag(tag)
+		deleted = keys
+	}
+	c.inMemoryCache.InvalidateTag(tag)
+	c.inMemoryCache.MDel(deleted)
+	if c.diskCache != nil {
+		for _, key := range append(keys, deleted...) { // Duplicates are harmless
+			c.diskCache.Del(key)
+		}
+	}
+	return len(deleted)
+}
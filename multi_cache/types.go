@@ -0,0 +1,240 @@
+package multi_cache
+
+import "context"
+
+// Hashes, lists and sets are written to Redis first, which is authoritative and reports whether the key existed.
+// The in-memory tier mirrors a write only when it holds the whole value: when Redis created the key or when
+// the in-memory tier already holds it. Reads use the in-memory copy when it has the expected type and fall back
+// to Redis otherwise; either way the key is promoted in both tiers so they keep evicting the same keys, Redis
+// promoting the keys read from memory in a batch before its next eviction. The in-memory copy carries the
+// version Redis assigned to each write.
+// The disk tier only stores strings, so writes drop any string it holds for the key.
+// While Redis is unavailable, reads and writes use the in-memory tier alone.
+
+// Type returns the type of the value stored at key according to Redis: "string", "hash", "list", "set" or "none".
+func (c *MultiCache) Type(ctx context.Context, key string) string {
+	var kind string
+	if !c.redisCall(ctx, func(ctx context.Context) { kind = c.redisCache.Type(ctx, key) }) {
+		c.degrade(0)
+		return c.inMemoryCache.Type(key)
+	}
+	return kind
+}
+
+// HSet sets fields of the hash stored at key and returns the number of new fields.
+func (c *MultiCache) HSet(ctx context.Context, key string, fields map[string]string, length int) (int, error) {
+	length = c.writeLength(ctx, length)
+	items := make([]string, 0, 2*len(fields))
+	for field, value := range fields {
+		items = append(items, field, value)
+	}
+	done, err := c.admit(ctx, adding(key, items...))
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	var added int
+	var existed bool
+	var version uint64
+	if !c.redisCall(ctx, func(ctx context.Context) { added, existed, version, err = c.redisCache.HSet(ctx, key, fields, length) }) {
+		c.degradeTyped(key, length)
+		return c.inMemoryCache.HSet(key, fields, length)
+	}
+	if err != nil {
+		return 0, err
+	}
+	c.mirrorTyped(key, existed, func() error {
+		_, err := c.inMemoryCache.HSetWithVersion(key, fields, length, version)
+		return err
+	})
+	return added, nil
+}
+
+// HGet returns the value of a field of the hash stored at key. The boolean reports whether the field exists.
+func (c *MultiCache) HGet(ctx context.Context, key, field string) (string, bool, error) {
+	if c.inMemoryHolds(ctx, key, "hash") {
+		return c.inMemoryCache.HGet(key, field)
+	}
+	var value string
+	var found bool
+	var err error
+	if !c.redisCall(ctx, func(ctx context.Context) { value, found, err = c.redisCache.HGet(ctx, key, field) }) {
+		c.degrade(0)
+		return c.inMemoryCache.HGet(key, field)
+	}
+	return value, found, err
+}
+
+// HGetAll returns the hash stored at key, or an empty map if the key does not exist.
+func (c *MultiCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	if c.inMemoryHolds(ctx, key, "hash") {
+		return c.inMemoryCache.HGetAll(key)
+	}
+	var fields map[string]string
+	var err error
+	if !c.redisCall(ctx, func(ctx context.Context) { fields, err = c.redisCache.HGetAll(ctx, key) }) {
+		c.degrade(0)
+		return c.inMemoryCache.HGetAll(key)
+	}
+	return fields, err
+}
+
+// HDel removes fields from the hash stored at key and returns how many were removed.
+func (c *MultiCache) HDel(ctx context.Context, key string, fields ...string) (int, error) {
+	var removed int
+	var version uint64
+	var err error
+	if !c.redisCall(ctx, func(ctx context.Context) { removed, version, err = c.redisCache.HDel(ctx, key, fields...) }) {
+		c.degradeTyped(key, 0)
+		return c.inMemoryCache.HDel(key, fields...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	c.mirrorTyped(key, true, func() error {
+		_, err := c.inMemoryCache.HDelWithVersion(key, version, fields...)
+		return err
+	})
+	return removed, nil
+}
+
+// LPush inserts values at the head of the list stored at key and returns the new length of the list.
+func (c *MultiCache) LPush(ctx context.Context, key string, values []string, length int) (int, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, adding(key, values...))
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	var n int
+	var existed bool
+	var version uint64
+	if !c.redisCall(ctx, func(ctx context.Context) { n, existed, version, err = c.redisCache.LPush(ctx, key, values, length) }) {
+		c.degradeTyped(key, length)
+		return c.inMemoryCache.LPush(key, values, length)
+	}
+	if err != nil {
+		return 0, err
+	}
+	c.mirrorTyped(key, existed, func() error {
+		_, err := c.inMemoryCache.LPushWithVersion(key, values, length, version)
+		return err
+	})
+	return n, nil
+}
+
+// LRange returns the items of the list stored at key between start and stop, both inclusive.
+// Negative indexes count from the tail, so LRange(key, 0, -1) returns the whole list.
+func (c *MultiCache) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	if c.inMemoryHolds(ctx, key, "list") {
+		return c.inMemoryCache.LRange(key, start, stop)
+	}
+	var items []string
+	var err error
+	if !c.redisCall(ctx, func(ctx context.Context) { items, err = c.redisCache.LRange(ctx, key, start, stop) }) {
+		c.degrade(0)
+		return c.inMemoryCache.LRange(key, start, stop)
+	}
+	return items, err
+}
+
+// SAdd adds members to the set stored at key and returns the number of new members.
+func (c *MultiCache) SAdd(ctx context.Context, key string, members []string, length int) (int, error) {
+	length = c.writeLength(ctx, length)
+	done, err := c.admit(ctx, adding(key, members...))
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	var added int
+	var existed bool
+	var version uint64
+	if !c.redisCall(ctx, func(ctx context.Context) { added, existed, version, err = c.redisCache.SAdd(ctx, key, members, length) }) {
+		c.degradeTyped(key, length)
+		return c.inMemoryCache.SAdd(key, members, length)
+	}
+	if err != nil {
+		return 0, err
+	}
+	c.mirrorTyped(key, existed, func() error {
+		_, err := c.inMemoryCache.SAddWithVersion(key, members, length, version)
+		return err
+	})
+	return added, nil
+}
+
+// SMembers returns the members of the set stored at key in sorted order.
+func (c *MultiCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	if c.inMemoryHolds(ctx, key, "set") {
+		return c.inMemoryCache.SMembers(key)
+	}
+	var members []string
+	var err error
+	if !c.redisCall(ctx, func(ctx context.Context) { members, err = c.redisCache.SMembers(ctx, key) }) {
+		c.degrade(0)
+		return c.inMemoryCache.SMembers(key)
+	}
+	return members, err
+}
+
+// mirrorTyped applies a write Redis accepted to the in-memory tier if that keeps the in-memory copy whole.
+// existed reports whether Redis held the key before the write. A copy the write cannot be applied to is dropped.
+func (c *MultiCache) mirrorTyped(key string, existed bool, apply func() error) {
+	if c.diskCache != nil {
+		c.diskCache.Del(key)
+	}
+	if !existed {
+		c.inMemoryCache.Del(key) // Any copy is stale, the write creates the whole value
+	} else if c.inMemoryCache.Type(key) == "none" {
+		return // Applying the write would leave a partial copy, reads fall back to Redis
+	}
+	if apply() != nil {
+		c.inMemoryCache.Del(key)
+	}
+}
+
+// degradeTyped records a write of a hash, list or set the in-memory tier takes alone while Redis is unavailable.
+func (c *MultiCache) degradeTyped(key string, length int) {
+	if c.diskCache != nil {
+		c.diskCache.Del(key)
+	}
+	c.degrade(length, key)
+}
+
+// inMemoryHolds reports whether the in-memory tier holds key with the given type. If it does, the key is
+// queued for promotion in Redis, since the read served from memory never reaches it.
+func (c *MultiCache) inMemoryHolds(ctx context.Context, key, kind string) bool {
+	if c.inMemoryCache.Type(key) != kind {
+		return false
+	}
+	c.touch(ctx, key)
+	return true
+}
+
+// touchBatch is how many keys read from memory are queued before they are promoted in Redis without waiting
+// for a write.
+const touchBatch = 256
+
+// touch queues key, just read from the in-memory tier alone, for promotion in Redis. Redis only evicts when it
+// is written to, so the queue is promoted before the next write, see writeLength, or once it holds touchBatch keys.
+func (c *MultiCache) touch(ctx context.Context, key string) {
+	c.touchMu.Lock()
+	c.touched = append(c.touched, key)
+	full := len(c.touched) >= touchBatch
+	c.touchMu.Unlock()
+	if full {
+		c.promoteTouched(ctx)
+	}
+}
+
+// promoteTouched promotes the keys queued by touch in Redis, in the order they were read. They are dropped if
+// Redis is unavailable, leaving the order of its list as it was.
+func (c *MultiCache) promoteTouched(ctx context.Context) {
+	c.touchMu.Lock()
+	keys := c.touched
+	c.touched = nil
+	c.touchMu.Unlock()
+	if len(keys) > 0 {
+		c.redisCall(ctx, func(ctx context.Context) { c.redisCache.Promote(ctx, keys) })
+	}
+}
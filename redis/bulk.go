@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"log"
+
+	"github.com/devisettymahidhar315/zin1/jsondoc"
+	"github.com/go-redis/redis/v8"
+)
+
+// Item is a key-value pair for bulk writes
+type Item struct {
+	Key   string
+	Value string
+}
+
+// mgetScript reads several keys and moves the ones found to the front of the list in one round trip
+// KEYS[1] is the list and the remaining KEYS the keys to read; missing keys and keys holding
+// hashes, lists or sets yield false
+var mgetScript = redis.NewScript(`
+local values = {}
+for i = 2, #KEYS do
+	local value = false
+	if redis.call('TYPE', KEYS[i]).ok == 'string' then
+		value = redis.call('GET', KEYS[i])
+	end
+	if value then
+		redis.call('LREM', KEYS[1], 0, KEYS[i])
+		redis.call('LPUSH', KEYS[1], KEYS[i])
+		values[i - 1] = value
+	else
+		values[i - 1] = false
+	end
+end
+return values
+`)
+
+// msetScript stores several keys, assigns each a new version and moves them to the front of the list
+// KEYS are the list, the version counter, the version hash, the content type hash, the sizes hash and then
+// the keys; ARGV[1] is the TTL in milliseconds (0 for none) and ARGV[2] the offset of the user key in the keys,
+// followed by one value per key
+// It returns the versions in order; if a value would replace a JSON document without being JSON, see jsonLua,
+// it stores none of them
+var msetScript = redis.NewScript(sizeLua + jsonLua + `
+local ttl = tonumber(ARGV[1])
+local offset = tonumber(ARGV[2])
+local contentTypes = {}
+for i = 6, #KEYS do
+	contentTypes[i] = guard(KEYS[4], KEYS[i], ARGV[i - 3], '')
+	if not contentTypes[i] then
+		return redis.error_reply('INVALIDJSON value of ' .. KEYS[i] .. ' is not a JSON document')
+	end
+end
+local versions = {}
+for i = 6, #KEYS do
+	if ttl > 0 then
+		redis.call('SET', KEYS[i], ARGV[i - 3], 'PX', ttl)
+	else
+		redis.call('SET', KEYS[i], ARGV[i - 3])
+	end
+	resize(KEYS[5], KEYS[i], size(KEYS[i], offset))
+	local version = redis.call('INCR', KEYS[2])
+	redis.call('HSET', KEYS[3], KEYS[i], version)
+	if contentTypes[i] ~= '' then
+		redis.call('HSET', KEYS[4], KEYS[i], contentTypes[i])
+	else
+		redis.call('HDEL', KEYS[4], KEYS[i])
+	end
+	redis.call('LREM', KEYS[1], 0, KEYS[i])
+	redis.call('LPUSH', KEYS[1], KEYS[i])
+	versions[i - 5] = version
+end
+return versions
+`)
+
+// MGet retrieves the values of several keys in a single round trip
+// Found keys are moved to the front of the list; missing keys yield an empty string
+func (c *LRUCache) MGet(ctx context.Context, keys []string) []string {
+	values := make([]string, len(keys))
+	if len(keys) == 0 {
+		return values
+	}
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var res []interface{}
+	err := c.retry(ctx, "mget", func(ctx context.Context) (err error) {
+		res, err = mgetScript.Run(ctx, c.client, append([]string{c.list}, c.redisKeys(keys)...)).Slice()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error getting %d keys: %v", len(keys), err)
+		return values
+	}
+	for i, value := range res {
+		s, ok := value.(string)
+		values[i] = s
+		c.countRead(ok)
+	}
+	return values
+}
+
+// MSet stores several key-value pairs with the same TTL in a single round trip and returns their versions
+// Items are stored in order, so the last item ends up at the front of the list
+// If an item would replace a JSON document with a value that is not JSON, no item is stored and
+// jsondoc.ErrInvalidJSON is returned; failures of Redis are logged
+func (c *LRUCache) MSet(ctx context.Context, items []Item, maxLength, ttl int) ([]uint64, error) {
+	versions := make([]uint64, len(items))
+	if len(items) == 0 {
+		return versions, nil
+	}
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	ttlMillis := 0
+	if ttl > 0 {
+		ttlMillis = ttl * 1000
+	}
+	keys := []string{c.list, versionKey, c.versions, c.contentTypes, c.sizes}
+	args := []interface{}{ttlMillis, c.offset()}
+	for _, item := range items {
+		keys = append(keys, c.key(item.Key))
+		args = append(args, item.Value)
+	}
+	res, err := msetScript.Run(ctx, c.client, keys, args...).Slice()
+	if err = scriptError(err); err == jsondoc.ErrInvalidJSON {
+		return versions, err
+	} else if err != nil {
+		log.Printf("Error setting %d keys: %v", len(items), err)
+		return versions, nil
+	}
+	for i, version := range res {
+		versions[i] = uint64(version.(int64))
+	}
+	// Ensure cache size does not exceed maxLength
+	c.evictItems(ctx, maxLength)
+	c.counters.sets.Add(uint64(len(items)))
+	return versions, nil
+}
+
+// MDel deletes several keys in a single atomic step and returns how many existed
+func (c *LRUCache) MDel(ctx context.Context, keys []string) int {
+	return len(c.mdel(ctx, keys))
+}
+
+// mdel deletes several keys in a single atomic step and returns those that existed
+func (c *LRUCache) mdel(ctx context.Context, keys []string) []string {
+	if len(keys) == 0 {
+		return []string{}
+	}
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	existed, err := c.delete(ctx, c.redisKeys(keys)...)
+	if err != nil {
+		log.Printf("Error deleting %d keys: %v", len(keys), err)
+		return []string{}
+	}
+	deleted := []string{}
+	for i, found := range existed {
+		if found {
+			deleted = append(deleted, keys[i])
+		}
+	}
+	c.counters.deletes.Add(uint64(len(deleted)))
+	return deleted
+}
@@ -0,0 +1,194 @@
+package redis
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/devisettymahidhar315/zin1/jsondoc"
+	"github.com/go-redis/redis/v8"
+)
+
+// Keys used to keep per-entry versions
+const (
+	versionKey  = "cache:version"  // Counter handing out versions, so versions never repeat
+	versionsKey = "cache:versions" // Hash mapping each key to the version of its value
+)
+
+// contentTypesKey is the hash mapping keys stored with a content type to that content type
+const contentTypesKey = "cache:content-types"
+
+// jsonLua defines the check the scripts storing strings use to keep JSON documents valid: guard(contentTypes,
+// key, value, contentType) returns the content type to store for value, the application/json of the document
+// key holds when the write gives none, or false if value is not JSON and so cannot replace that document
+// A write giving its own content type, such as a raw PUT of text, replaces the document whatever it holds
+const jsonLua = `
+local function guard(contentTypes, key, value, contentType)
+	if contentType ~= '' or redis.call('HGET', contentTypes, key) ~= 'application/json' then
+		return contentType
+	end
+	if not pcall(cjson.decode, value) then
+		return false
+	end
+	return 'application/json'
+end
+`
+
+// errInvalidJSON starts the error reply of the scripts refusing to replace a JSON document with a value that is not JSON
+const errInvalidJSON = "INVALIDJSON"
+
+// scriptError returns jsondoc.ErrInvalidJSON for the error reply of a script refusing a value that is not JSON,
+// and err otherwise
+func scriptError(err error) error {
+	if err != nil && strings.HasPrefix(err.Error(), errInvalidJSON) {
+		return jsondoc.ErrInvalidJSON
+	}
+	return err
+}
+
+// Modes understood by setIfScript
+const (
+	modeSet    = "set"    // Always set
+	modeNX     = "nx"     // Set only if the key does not exist
+	modeXX     = "xx"     // Set only if the key exists
+	modeGetSet = "getset" // Always set and return the previous value
+	modeCAS    = "cas"    // Set only if the key holds the expected value
+	modeVer    = "ver"    // Set only if the key has the expected version
+)
+
+// setIfScript conditionally sets a key, assigns it a new version and moves it to the front of the list
+// in one atomic step
+// KEYS are the key, the list, the version counter, the version hash, the content type hash and the sizes hash;
+// ARGV holds the value, the TTL in milliseconds (0 for none), the mode, the expected value or version,
+// the content type, which is removed when empty, and the offset of the user key in the key
+// It returns {stored, existed, previous value, version}; like SET, it replaces hashes, lists and sets,
+// whose previous value is reported as empty. A JSON document is only replaced by JSON, see jsonLua
+var setIfScript = redis.NewScript(sizeLua + jsonLua + `
+local kind = redis.call('TYPE', KEYS[1]).ok
+local existed = 1
+local old = ''
+if kind == 'none' then
+	existed = 0
+elseif kind == 'string' then
+	old = redis.call('GET', KEYS[1])
+end
+local mode = ARGV[3]
+if (mode == 'nx' and existed == 1) or (mode == 'xx' and existed == 0) or
+	(mode == 'cas' and (kind ~= 'string' or old ~= ARGV[4])) or
+	(mode == 'ver' and (existed == 0 or redis.call('HGET', KEYS[4], KEYS[1]) ~= ARGV[4])) then
+	return {0, existed, old, 0}
+end
+local contentType = guard(KEYS[5], KEYS[1], ARGV[1], ARGV[5])
+if not contentType then
+	return redis.error_reply('INVALIDJSON value is not a JSON document')
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+resize(KEYS[6], KEYS[1], size(KEYS[1], tonumber(ARGV[6])))
+local version = redis.call('INCR', KEYS[3])
+redis.call('HSET', KEYS[4], KEYS[1], version)
+if contentType ~= '' then
+	redis.call('HSET', KEYS[5], KEYS[1], contentType)
+else
+	redis.call('HDEL', KEYS[5], KEYS[1])
+end
+redis.call('LREM', KEYS[2], 0, KEYS[1])
+redis.call('LPUSH', KEYS[2], KEYS[1])
+return {1, existed, old, version}
+`)
+
+// SetNX stores the key-value pair only if the key does not exist
+// The boolean reports whether the value was stored; the version is that of the stored value
+func (c *LRUCache) SetNX(ctx context.Context, key, value string, maxLength, ttl int) (uint64, bool, error) {
+	stored, _, _, version, err := c.setIf(ctx, key, value, "", maxLength, ttl, modeNX, "")
+	return version, stored, err
+}
+
+// SetXX stores the key-value pair only if the key already exists
+// The boolean reports whether the value was stored; the version is that of the stored value
+func (c *LRUCache) SetXX(ctx context.Context, key, value string, maxLength, ttl int) (uint64, bool, error) {
+	stored, _, _, version, err := c.setIf(ctx, key, value, "", maxLength, ttl, modeXX, "")
+	return version, stored, err
+}
+
+// GetSet stores the key-value pair and returns the previous value and the new version
+// The boolean reports whether the key existed before
+func (c *LRUCache) GetSet(ctx context.Context, key, value string, maxLength, ttl int) (string, uint64, bool, error) {
+	_, existed, old, version, err := c.setIf(ctx, key, value, "", maxLength, ttl, modeGetSet, "")
+	return old, version, existed, err
+}
+
+// CompareAndSwap stores newValue only if the key exists and currently holds oldValue
+// The boolean reports whether the value was swapped; the version is that of the stored value
+func (c *LRUCache) CompareAndSwap(ctx context.Context, key, oldValue, newValue string, maxLength, ttl int) (uint64, bool, error) {
+	stored, _, _, version, err := c.setIf(ctx, key, newValue, "", maxLength, ttl, modeCAS, oldValue)
+	return version, stored, err
+}
+
+// CompareVersionAndSwap stores the value only if the key exists and its version equals version
+// It returns the new version and whether the value was stored
+func (c *LRUCache) CompareVersionAndSwap(ctx context.Context, key string, version uint64, value string, maxLength, ttl int) (uint64, bool, error) {
+	stored, _, _, newVersion, err := c.setIf(ctx, key, value, "", maxLength, ttl, modeVer, strconv.FormatUint(version, 10))
+	return newVersion, stored, err
+}
+
+// Versions returns the versions of several keys with a single HMGET, 0 for keys that do not exist or
+// were stored without a version
+func (c *LRUCache) Versions(ctx context.Context, keys []string) ([]uint64, error) {
+	versions := make([]uint64, len(keys))
+	if len(keys) == 0 {
+		return versions, nil
+	}
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var res []interface{}
+	err := c.retry(ctx, "versions", func(ctx context.Context) (err error) {
+		res, err = c.client.HMGet(ctx, c.versions, c.redisKeys(keys)...).Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error getting the versions of %d keys: %v", len(keys), err)
+		return nil, err
+	}
+	for i, version := range res {
+		if s, ok := version.(string); ok {
+			versions[i], _ = strconv.ParseUint(s, 10, 64)
+		}
+	}
+	return versions, nil
+}
+
+// setIf runs setIfScript and evicts items if the value was stored
+// A TTL of zero or less stores the value without expiration; an empty content type removes the stored one, unless
+// the key holds a JSON document, which the value must then be
+// The only error returned is jsondoc.ErrInvalidJSON, failures of Redis are logged
+func (c *LRUCache) setIf(ctx context.Context, key, value, contentType string, maxLength, ttl int, mode, expected string) (stored, existed bool, old string, version uint64, err error) {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	ttlMillis := 0
+	if ttl > 0 {
+		ttlMillis = ttl * 1000
+	}
+	keys := []string{c.key(key), c.list, versionKey, c.versions, c.contentTypes, c.sizes}
+	res, err := setIfScript.Run(ctx, c.client, keys, value, ttlMillis, mode, expected, contentType, c.offset()).Slice()
+	if err = scriptError(err); err == jsondoc.ErrInvalidJSON {
+		return false, false, "", 0, err
+	} else if err != nil {
+		log.Printf("Error setting key %s (%s): %v", key, mode, err)
+		return false, false, "", 0, nil
+	}
+	stored = res[0].(int64) == 1
+	existed = res[1].(int64) == 1
+	old = res[2].(string)
+	version = uint64(res[3].(int64))
+	if stored {
+		// Ensure cache size does not exceed maxLength
+		c.evictItems(ctx, maxLength)
+		c.counters.sets.Add(1)
+	}
+	return stored, existed, old, version, nil
+}
@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// entriesBatchSize is the number of keys fetched per round trip by Entries
+const entriesBatchSize = 100
+
+// Entry is a single cache entry as reported by Entries
+type Entry struct {
+	Key   string
+	Value string        // Value of a string, empty for hashes, lists and sets
+	Type  string        // Type of the value as reported by the TYPE command
+	TTL   time.Duration // Remaining time to live, -1 if the entry never expires
+	Rank  int           // Position in the list, 0 for the most recently used entry
+}
+
+// Entries calls fn for every entry from most to least recently used, starting at rank offset of the list and
+// stopping early if fn returns false
+// The list is read in batches, fetching the types, values and TTLs of each batch in a single pipeline;
+// keys that expired are skipped but keep their rank. Iterating does not change the recency of any entry
+// Each batch is given the read timeout, so a slow fn does not cut the iteration short
+func (c *LRUCache) Entries(ctx context.Context, offset int, fn func(Entry) bool) {
+	for start := int64(offset); ; start += entriesBatchSize {
+		keys, typeCmds, valueCmds, ttlCmds, err := c.entriesBatch(ctx, start)
+		if err != nil {
+			log.Printf("Error getting cache entries: %v", err)
+			return
+		}
+		if len(keys) == 0 {
+			return
+		}
+		for i, key := range keys {
+			kind := typeCmds[i].Val()
+			if kind == "none" {
+				continue // Key expired, evictItems removes it from the list
+			}
+			value := valueCmds[i].Val() // Empty for hashes, lists and sets
+			ttl := ttlCmds[i].Val()
+			if ttl < 0 {
+				ttl = -1 // No expiration
+			}
+			if !fn(Entry{Key: c.userKey(key), Value: value, Type: kind, TTL: ttl, Rank: int(start) + i}) {
+				return
+			}
+		}
+		if len(keys) < entriesBatchSize {
+			return
+		}
+	}
+}
+
+// entriesBatch reads the keys of the list from start on, up to entriesBatchSize of them, along with their
+// types, values and TTLs
+func (c *LRUCache) entriesBatch(ctx context.Context, start int64) (keys []string, typeCmds []*redis.StatusCmd, valueCmds []*redis.StringCmd, ttlCmds []*redis.DurationCmd, err error) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	err = c.retry(ctx, "entries", func(ctx context.Context) error {
+		var err error
+		keys, err = c.client.LRange(ctx, c.list, start, start+entriesBatchSize-1).Result()
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		pipe := c.client.Pipeline()
+		typeCmds = make([]*redis.StatusCmd, len(keys))
+		valueCmds = make([]*redis.StringCmd, len(keys))
+		ttlCmds = make([]*redis.DurationCmd, len(keys))
+		for i, key := range keys {
+			typeCmds[i] = pipe.Type(ctx, key)
+			valueCmds[i] = pipe.Get(ctx, key)
+			ttlCmds[i] = pipe.PTTL(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil && !isWrongType(err) {
+			return err
+		}
+		return nil
+	})
+	return keys, typeCmds, valueCmds, ttlCmds, err
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"log"
+)
+
+// scanBatchSize is the COUNT hint used when a scan has no limit
+const scanBatchSize = 1000
+
+// Keys returns keys matching the glob pattern with SCAN MATCH, starting at cursor (0 for the first page)
+// It returns the next cursor, which is 0 once the scan is complete; like SCAN, a page may hold slightly more
+// than limit keys and a key may be returned twice if the keyspace changes between pages
+// A limit of zero or less scans every key; only the keys of values are scanned, so neither the cache's own
+// bookkeeping nor, in the default namespace, the keys of other namespaces are ever returned
+func (c *LRUCache) Keys(ctx context.Context, pattern string, cursor uint64, limit int) ([]string, uint64) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	count := int64(limit)
+	if limit <= 0 {
+		count = scanBatchSize
+	}
+	keys := []string{}
+	for {
+		var page []string
+		var next uint64
+		err := c.retry(ctx, "keys", func(ctx context.Context) (err error) {
+			page, next, err = c.client.Scan(ctx, cursor, c.key(pattern), count).Result()
+			return err
+		})
+		if err != nil {
+			log.Printf("Error scanning keys matching %s: %v", pattern, err)
+			return keys, 0
+		}
+		for _, key := range page {
+			keys = append(keys, c.userKey(key))
+		}
+		cursor = next
+		if cursor == 0 || (limit > 0 && len(keys) >= limit) {
+			return keys, cursor
+		}
+	}
+}
+
+// DeletePattern deletes every key matching the glob pattern and returns the keys that were deleted
+// Keys are deleted in batches as they are scanned, so the whole keyspace is never held at once
+func (c *LRUCache) DeletePattern(ctx context.Context, pattern string) []string {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	deleted := []string{}
+	var cursor uint64
+	for {
+		var keys []string
+		keys, cursor = c.Keys(ctx, pattern, cursor, scanBatchSize)
+		if len(keys) > 0 {
+			deleted = append(deleted, c.mdel(ctx, keys)...)
+		}
+		if cursor == 0 {
+			return deleted
+		}
+	}
+}
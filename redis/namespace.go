@@ -0,0 +1,140 @@
+package redis
+
+import (
+	"context"
+	"log"
+	"math"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// namespacePrefix starts the keys of every namespace other than the default one
+const namespacePrefix = "ns:"
+
+// Namespace returns a cache sharing this cache's connection whose keys, list, versions and tags
+// all live under "ns:<name>:", so it has its own capacity and never evicts keys of other namespaces
+// The name must not contain glob characters, since it becomes part of the patterns used by Keys
+func (c *LRUCache) Namespace(name string) *LRUCache {
+	return newLRUCache(c.client, namespacePrefix+name+":", c.hook, c.policy)
+}
+
+// Len returns the number of keys in the list of the cache
+func (c *LRUCache) Len(ctx context.Context) int {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var length int64
+	err := c.retry(ctx, "len", func(ctx context.Context) (err error) {
+		length, err = c.client.LLen(ctx, c.list).Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error getting cache length: %v", err)
+	}
+	return int(length)
+}
+
+// Resize evicts the least recently used keys until at most maxLength remain
+func (c *LRUCache) Resize(ctx context.Context, maxLength int) {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	c.evictTo(ctx, maxLength, EvictResize)
+}
+
+// Evictions returns how many keys this cache evicted to stay within its maximum length
+func (c *LRUCache) Evictions() uint64 {
+	return c.evictions.Load()
+}
+
+// deleteNamespaceKeys deletes every Redis key of the namespace, including its bookkeeping
+func (c *LRUCache) deleteNamespaceKeys(ctx context.Context) {
+	for _, pattern := range []string{c.prefix + "*", keyTagsPrefix + c.prefix + "*"} {
+		var cursor uint64
+		for {
+			keys, next, err := c.client.Scan(ctx, cursor, pattern, scanBatchSize).Result()
+			if err != nil {
+				log.Printf("Error scanning keys matching %s: %v", pattern, err)
+				return
+			}
+			if len(keys) > 0 {
+				if err := c.client.Del(ctx, keys...).Err(); err != nil {
+					log.Printf("Error deleting %d keys: %v", len(keys), err)
+					return
+				}
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+}
+
+// QuotaWrite describes a write checked by Exceeds
+type QuotaWrite struct {
+	Key     string
+	Size    int64 // Size of the key and value after the write if Replace is set, otherwise the bytes it adds to the value
+	Replace bool  // Whether the write replaces the value, like SET, rather than adding to it, like HSET
+}
+
+// Exceeds reports whether the writes would leave the cache holding more than maxEntries keys or more than maxBytes
+// bytes as counted by Bytes; zero limits are not checked
+// Expired keys still in the list are removed before a limit is reported exceeded; if Redis fails to answer, no limit
+// is, so the writes go through rather than being rejected for an unknown usage
+func (c *LRUCache) Exceeds(ctx context.Context, writes []QuotaWrite, maxEntries int, maxBytes int64) (entries, bytes bool) {
+	entries, bytes, err := c.exceeds(ctx, writes, maxEntries, maxBytes)
+	if err == nil && (entries || bytes) {
+		cleanupCtx, cancel := c.policy.write(ctx)
+		c.evictTo(cleanupCtx, math.MaxInt, EvictCapacity) // Evicts nothing
+		cancel()
+		entries, bytes, err = c.exceeds(ctx, writes, maxEntries, maxBytes)
+	}
+	if err != nil {
+		log.Printf("Error checking the quota of %d keys: %v", len(writes), err)
+		return false, false
+	}
+	return entries, bytes
+}
+
+// exceeds implements Exceeds with a single round trip
+func (c *LRUCache) exceeds(ctx context.Context, writes []QuotaWrite, maxEntries int, maxBytes int64) (bool, bool, error) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var lengthCmd *redis.IntCmd
+	var totalCmd *redis.StringCmd
+	existsCmds := make([]*redis.IntCmd, len(writes))
+	sizeCmds := make([]*redis.StringCmd, len(writes))
+	err := c.retry(ctx, "quota", func(ctx context.Context) error {
+		pipe := c.client.Pipeline()
+		lengthCmd = pipe.LLen(ctx, c.list)
+		totalCmd = pipe.HGet(ctx, c.sizes, "")
+		for i, w := range writes {
+			existsCmds[i] = pipe.Exists(ctx, c.key(w.Key))
+			sizeCmds[i] = pipe.HGet(ctx, c.sizes, c.key(w.Key))
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil && err != redis.Nil {
+		return false, false, err
+	}
+	entries := lengthCmd.Val()
+	bytes, _ := totalCmd.Int64()
+	added := map[string]bool{}
+	for i, w := range writes {
+		size, _ := sizeCmds[i].Int64()
+		exists := existsCmds[i].Val() > 0 || added[w.Key]
+		if !exists {
+			size = 0
+			entries++
+			added[w.Key] = true
+		}
+		switch {
+		case w.Replace:
+			bytes += w.Size - size
+		case exists:
+			bytes += w.Size
+		default:
+			bytes += int64(len(w.Key)) + w.Size
+		}
+	}
+	return maxEntries > 0 && entries > int64(maxEntries), maxBytes > 0 && bytes > maxBytes, nil
+}
@@ -2,89 +2,460 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/devisettymahidhar315/zin1/metrics"
 	"github.com/go-redis/redis/v8"
 )
 
-// Create a background context for Redis operations
-var ctx = context.Background()
+// ErrInvalidTTL is returned by Put and PutWithContentType for a TTL that is neither -1 nor greater than 0
+var ErrInvalidTTL = errors.New("invalid TTL: must be -1 (no expiration) or greater than 0")
 
 // LRUCache represents a Redis-based LRU cache
+// Every Redis key it uses starts with prefix, so several caches, one per namespace, can share a server
+// Its methods take the context of the caller first and give up on Redis once it is done or the timeout of the operation ends
 type LRUCache struct {
-	client *redis.Client
+	client   *redis.Client
+	prefix   string // Prefix of every key of this cache, empty for the default namespace
+	list     string // List of the keys in recency order, most recently used first
+	versions string // Hash mapping each key to the version of its value
+	sizes    string // Hash mapping each key to its size, see sizesKey
+
+	contentTypes string // Hash mapping keys stored with a content type to that content type
+
+	evictions atomic.Uint64 // Number of keys evicted to stay within the maximum length
+	counters  counters
+	hook      *commandHook // Times the commands sent over client and counts those that failed
+	policy    *policy      // Timeouts and retries of the operations
+}
+
+// Options configures the connection of an LRUCache to Redis
+type Options struct {
+	Addr     string // Redis server address, localhost:6379 if empty
+	Password string // Password of the Redis server, none if empty
+	DB       int    // Database of the cache, so caches in different databases never see each other's keys
+	PoolSize int    // Connection pool size, 10 if zero
+
+	// Every operation, such as Get or MSet, is given at most ReadTimeout or WriteTimeout, on top of the
+	// deadline of the context it is called with. Reads and writes that may safely run twice are retried
+	// up to MaxRetries times when Redis fails to answer, after a jittered backoff starting at RetryBackoff;
+	// writes that assign versions, increment or push are never retried
+	ReadTimeout  time.Duration // DefaultReadTimeout if zero
+	WriteTimeout time.Duration // DefaultWriteTimeout if zero
+	MaxRetries   int           // DefaultMaxRetries if zero, no retries if negative
+	RetryBackoff time.Duration // DefaultRetryBackoff if zero
 }
 
 // NewLRUCache initializes and returns a new LRUCache instance connected to Redis
 func NewLRUCache() *LRUCache {
-	opts := &redis.Options{
-		Addr:     "localhost:6379", // Redis server address
-		PoolSize: 10,               // Connection pool size
+	return NewLRUCacheWithOptions(Options{})
+}
+
+// NewLRUCacheWithOptions initializes and returns a new LRUCache instance connected to Redis as configured by opts
+func NewLRUCacheWithOptions(opts Options) *LRUCache {
+	if opts.Addr == "" {
+		opts.Addr = "localhost:6379"
+	}
+	if opts.PoolSize == 0 {
+		opts.PoolSize = 10
 	}
 	// Create a new Redis client
-	rdb := redis.NewClient(opts)
-	// Clear the cache on initialization
-	rdb.Del(ctx, "cache")
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Password: opts.Password,
+		DB:       opts.DB,
+		PoolSize: opts.PoolSize,
+
+		MaxRetries: -1, // Retries are left to the operations that may safely run twice
+	})
+	hook := &commandHook{latency: metrics.NewHistogramVec(metrics.LatencyBuckets)}
+	rdb.AddHook(hook)
+	return newLRUCache(rdb, "", hook, newPolicy(opts))
+}
 
+// Close closes the connections to Redis
+// Namespaces share the connections of the cache they were created from, so only close that cache, once
+func (c *LRUCache) Close() error {
+	return c.client.Close()
+}
+
+// Ping checks that Redis answers a PING before ctx is done
+func (c *LRUCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// newLRUCache returns a cache using client whose keys all start with prefix
+// hook is the hook of client and policy the timeouts and retries, both shared by every cache using client
+func newLRUCache(client *redis.Client, prefix string, hook *commandHook, policy *policy) *LRUCache {
 	return &LRUCache{
-		client: rdb,
+		client:   client,
+		prefix:   prefix,
+		list:     prefix + "cache",
+		versions: prefix + versionsKey,
+		sizes:    prefix + sizesKey,
+
+		contentTypes: prefix + contentTypesKey,
+		hook:         hook,
+		policy:       policy,
+	}
+}
+
+// dataPrefix follows the namespace prefix in the Redis key of every value, so that no key a user writes can
+// collide with the cache's own bookkeeping, such as the list, or with the keys of another namespace
+const dataPrefix = "k:"
+
+// key returns the Redis key holding the value of key
+func (c *LRUCache) key(key string) string {
+	return c.prefix + dataPrefix + key
+}
+
+// redisKeys returns the Redis keys holding the values of keys
+func (c *LRUCache) redisKeys(keys []string) []string {
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = c.key(key)
 	}
+	return redisKeys
+}
+
+// userKey is the inverse of key
+func (c *LRUCache) userKey(redisKey string) string {
+	return strings.TrimPrefix(redisKey, c.prefix+dataPrefix)
 }
 
-// Put adds or updates a key-value pair in the cache
+// Put adds or updates a key-value pair in the cache and returns the version assigned to the value
 // If the cache exceeds maxLength, the least recently used item is removed
-func (c *LRUCache) Put(key, value string, maxLength, ttl int) {
-	// Check if the key already exists
-	exists, err := c.client.Exists(ctx, key).Result()
-	if err != nil {
-		log.Fatalf("Error checking if key %s exists: %v", key, err)
+// A key holding a JSON document keeps it unless value is JSON too, see PutWithContentType
+// A TTL that is neither -1 nor greater than 0 stores nothing and returns ErrInvalidTTL
+func (c *LRUCache) Put(ctx context.Context, key, value string, maxLength, ttl int) (uint64, error) {
+	if ttl != -1 && ttl <= 0 {
+		return 0, ErrInvalidTTL
 	}
-	if exists > 0 {
-		// Remove the key from the list to update its position
-		c.client.LRem(ctx, "cache", 0, key)
+	// Store the value, bump its version and move it to the front of the list atomically
+	_, _, _, version, err := c.setIf(ctx, key, value, "", maxLength, ttl, modeSet, "")
+	return version, err
+}
+
+// PutWithContentType stores a key-value pair like Put along with the content type of the value
+// and also reports whether the key existed before
+// Put and the other string writes remove the content type, so it always describes the current value, except that
+// of a JSON document: writes without a content type keep it if their value is JSON and fail with
+// jsondoc.ErrInvalidJSON otherwise, so a document cannot silently turn into a value that is not JSON
+func (c *LRUCache) PutWithContentType(ctx context.Context, key, value, contentType string, maxLength, ttl int) (uint64, bool, error) {
+	if ttl != -1 && ttl <= 0 {
+		return 0, false, ErrInvalidTTL
 	}
-	// Add the key to the front of the list
-	c.client.LPush(ctx, "cache", key)
+	_, existed, _, version, err := c.setIf(ctx, key, value, contentType, maxLength, ttl, modeSet, "")
+	return version, existed, err
+}
+
+// incrScript increments a key, assigns it a new version and moves it to the front of the list atomically
+// KEYS are the key, the list, the version counter, the version hash, the content type hash and the sizes hash;
+// ARGV[1] is the increment and ARGV[2] the offset of the user key in the key; a key it creates has no content type
+// It returns {value, version, remaining TTL in milliseconds or -1}
+var incrScript = redis.NewScript(sizeLua + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('HDEL', KEYS[5], KEYS[1])
+end
+local ok, value = pcall(redis.call, 'INCRBY', KEYS[1], ARGV[1])
+if not ok then
+	return redis.error_reply(type(value) == 'table' and value.err or tostring(value))
+end
+resize(KEYS[6], KEYS[1], size(KEYS[1], tonumber(ARGV[2])))
+local version = redis.call('INCR', KEYS[3])
+redis.call('HSET', KEYS[4], KEYS[1], version)
+redis.call('LREM', KEYS[2], 0, KEYS[1])
+redis.call('LPUSH', KEYS[2], KEYS[1])
+return {value, version, redis.call('PTTL', KEYS[1])}
+`)
 
-	if ttl == -1 {
-		// No expiration
-		c.client.Set(ctx, key, value, 0)
-	} else if ttl > 0 {
-		// Set key with expiration time
-		c.client.Set(ctx, key, value, time.Duration(ttl)*time.Second)
-	} else {
-		log.Fatalf("Invalid TTL value: %d. TTL should be -1 (no expiration) or greater than 0", ttl)
+// IncrBy atomically adds delta to the integer value of key with INCRBY and returns the new value, its version
+// and the remaining time to live of the key, -1 if it never expires, so other tiers can mirror it
+// Redis errors such as a non-integer value are returned; the key is moved to the front of the list
+func (c *LRUCache) IncrBy(ctx context.Context, key string, delta int64, maxLength int) (int64, uint64, time.Duration, error) {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	keys := []string{c.key(key), c.list, versionKey, c.versions, c.contentTypes, c.sizes}
+	res, err := incrScript.Run(ctx, c.client, keys, delta, c.offset()).Slice()
+	if _, ok := err.(redis.Error); ok {
+		return 0, 0, 0, err
+	} else if err != nil {
+		log.Printf("Error incrementing key %s: %v", key, err)
+		return 0, 0, 0, err
 	}
 	// Ensure cache size does not exceed maxLength
-	c.evictItems(maxLength)
+	c.evictItems(ctx, maxLength)
+	c.counters.sets.Add(1)
+	ttl := time.Duration(-1)
+	if pttl := res[2].(int64); pttl > 0 {
+		ttl = time.Duration(pttl) * time.Millisecond
+	}
+	return res[0].(int64), uint64(res[1].(int64)), ttl, nil
 }
 
 // Get retrieves the value associated with the given key
 // If the key is found, it is moved to the front of the list
-func (c *LRUCache) Get(key string) string {
+func (c *LRUCache) Get(ctx context.Context, key string) string {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
 	// Get the value associated with the key
-	value, err := c.client.Get(ctx, key).Result()
-	if err == redis.Nil {
-		return "" // Key does not exist
+	var value string
+	err := c.retry(ctx, "get", func(ctx context.Context) (err error) {
+		value, err = c.client.Get(ctx, c.key(key)).Result()
+		return err
+	})
+	if err == redis.Nil || isWrongType(err) {
+		c.countRead(false)
+		return "" // Key does not exist or does not hold a string
 	} else if err != nil {
-		log.Fatalf("Error getting key %s: %v", key, err)
+		log.Printf("Error getting key %s: %v", key, err)
+		return ""
+	}
+	c.countRead(true)
+	// Move the key to the front of the list
+	c.moveToFront(ctx, c.key(key))
+
+	return value
+}
+
+// GetWithVersion retrieves the value and version associated with the given key like Get
+// The version is 0 if the key does not exist or was stored without a version
+func (c *LRUCache) GetWithVersion(ctx context.Context, key string) (string, uint64) {
+	value, version, _ := c.get(ctx, key, false)
+	return value, version
+}
+
+// GetWithContentType retrieves the value and version associated with the given key like GetWithVersion,
+// along with the content type the value was stored with, or "" if there is none
+func (c *LRUCache) GetWithContentType(ctx context.Context, key string) (string, uint64, string) {
+	return c.get(ctx, key, true)
+}
+
+// get fetches the value of key, its version and, if withContentType is set, its content type in a single
+// round trip and moves the key to the front of the list
+func (c *LRUCache) get(ctx context.Context, key string, withContentType bool) (string, uint64, string) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var valueCmd, versionCmd, contentTypeCmd *redis.StringCmd
+	err := c.retry(ctx, "get_with_version", func(ctx context.Context) error {
+		pipe := c.client.Pipeline()
+		valueCmd = pipe.Get(ctx, c.key(key))
+		versionCmd = pipe.HGet(ctx, c.versions, c.key(key))
+		if withContentType {
+			contentTypeCmd = pipe.HGet(ctx, c.contentTypes, c.key(key))
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil && err != redis.Nil && !isWrongType(err) {
+		log.Printf("Error getting key %s: %v", key, err)
+		return "", 0, ""
+	}
+	value, err := valueCmd.Result()
+	if err == redis.Nil || isWrongType(err) {
+		c.countRead(false)
+		return "", 0, "" // Key does not exist or does not hold a string
+	}
+	c.countRead(true)
+	version, _ := versionCmd.Uint64()
+	var contentType string
+	if withContentType {
+		contentType = contentTypeCmd.Val()
 	}
 	// Move the key to the front of the list
-	c.client.LRem(ctx, "cache", 0, key)
-	c.client.LPush(ctx, "cache", key)
+	c.moveToFront(ctx, c.key(key))
 
+	return value, version, contentType
+}
+
+// EntryInfo holds the metadata Redis keeps about a cache entry.
+type EntryInfo struct {
+	TTL     time.Duration // Remaining time to live, -1 if the key never expires
+	Size    int           // Size of the key and value in bytes
+	Version uint64        // Version of the value, 0 if unknown
+}
+
+// Peek retrieves the value associated with the given key without changing its position in the list
+func (c *LRUCache) Peek(ctx context.Context, key string) string {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var value string
+	err := c.retry(ctx, "peek", func(ctx context.Context) (err error) {
+		value, err = c.client.Get(ctx, c.key(key)).Result()
+		return err
+	})
+	if err == redis.Nil || isWrongType(err) {
+		return "" // Key does not exist or does not hold a string
+	} else if err != nil {
+		log.Printf("Error getting key %s: %v", key, err)
+		return ""
+	}
 	return value
 }
 
+// Inspect returns the remaining TTL and size of the given key without changing its position in the list
+// The size of hashes, lists and sets only counts the key
+// The boolean is false if the key does not exist
+func (c *LRUCache) Inspect(ctx context.Context, key string) (EntryInfo, bool) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	// Fetch both values in a single round trip
+	var ttlCmd *redis.DurationCmd
+	var sizeCmd *redis.IntCmd
+	var versionCmd *redis.StringCmd
+	err := c.retry(ctx, "inspect", func(ctx context.Context) error {
+		pipe := c.client.Pipeline()
+		ttlCmd = pipe.PTTL(ctx, c.key(key))
+		sizeCmd = pipe.StrLen(ctx, c.key(key))
+		versionCmd = pipe.HGet(ctx, c.versions, c.key(key))
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil && err != redis.Nil && !isWrongType(err) {
+		log.Printf("Error inspecting key %s: %v", key, err)
+		return EntryInfo{}, false
+	}
+	ttl := ttlCmd.Val()
+	if ttl == -2 {
+		return EntryInfo{}, false // Key does not exist
+	}
+	if ttl < 0 {
+		ttl = -1 // No expiration
+	}
+	version, _ := versionCmd.Uint64()
+	return EntryInfo{TTL: ttl, Size: len(key) + int(sizeCmd.Val()), Version: version}, true
+}
+
+// Expire sets the time to live of an existing key with PEXPIRE
+// A non-positive duration deletes the key; the boolean reports whether the key was found
+func (c *LRUCache) Expire(ctx context.Context, key string, d time.Duration) bool {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	if d <= 0 {
+		// PEXPIRE with a non-positive value deletes the key, keep the list in sync
+		existed, err := c.delete(ctx, c.key(key))
+		if err != nil {
+			log.Printf("Error deleting key %s: %v", key, err)
+			return false
+		}
+		return existed[0]
+	}
+	var ok bool
+	err := c.retry(ctx, "expire", func(ctx context.Context) (err error) {
+		ok, err = c.client.PExpire(ctx, c.key(key), d).Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error setting expiration of key %s: %v", key, err)
+	}
+	return ok
+}
+
+// Persist removes the expiration of an existing key with PERSIST
+// The boolean reports whether the key was found
+func (c *LRUCache) Persist(ctx context.Context, key string) bool {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	var exists int64
+	err := c.retry(ctx, "persist", func(ctx context.Context) error {
+		if err := c.client.Persist(ctx, c.key(key)).Err(); err != nil {
+			return err
+		}
+		// PERSIST returns false for keys without a TTL too, so check existence separately
+		var err error
+		exists, err = c.client.Exists(ctx, c.key(key)).Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error persisting key %s: %v", key, err)
+		return false
+	}
+	return exists > 0
+}
+
+// Touch moves an existing key to the front of the list without reading it
+// The boolean reports whether the key was found
+func (c *LRUCache) Touch(ctx context.Context, key string) bool {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var exists int64
+	err := c.retry(ctx, "touch", func(ctx context.Context) (err error) {
+		exists, err = c.client.Exists(ctx, c.key(key)).Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error checking if key %s exists: %v", key, err)
+	}
+	if exists == 0 {
+		return false
+	}
+	c.moveToFront(ctx, c.key(key))
+	return true
+}
+
+// promoteScript moves keys to the front of the list in order, so the last one ends up first, skipping keys
+// no longer in the list; KEYS are the list and then the keys
+var promoteScript = redis.NewScript(`
+for i = 2, #KEYS do
+	if redis.call('LREM', KEYS[1], 0, KEYS[i]) > 0 then
+		redis.call('LPUSH', KEYS[1], KEYS[i])
+	end
+end
+return 0
+`)
+
+// Promote moves keys read elsewhere, such as from a faster tier, to the front of the list in a single round trip
+// Keys are given from the least to the most recently read; keys that were deleted or evicted are skipped
+func (c *LRUCache) Promote(ctx context.Context, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	err := c.retry(ctx, "promote", func(ctx context.Context) error {
+		return promoteScript.Run(ctx, c.client, append([]string{c.list}, c.redisKeys(keys)...)).Err()
+	})
+	if err != nil && err != redis.Nil {
+		log.Printf("Error promoting %d keys: %v", len(keys), err)
+	}
+}
+
+// TTL returns the remaining time to live of the given key with PTTL
+// It returns -1 if the key never expires and -2 if it does not exist
+func (c *LRUCache) TTL(ctx context.Context, key string) time.Duration {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var ttl time.Duration
+	err := c.retry(ctx, "ttl", func(ctx context.Context) (err error) {
+		ttl, err = c.client.PTTL(ctx, c.key(key)).Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error getting TTL of key %s: %v", key, err)
+		return -2
+	}
+	return ttl // go-redis reports the -1 and -2 replies unscaled
+}
+
 // Print returns a string representation of the cache contents
-func (c *LRUCache) Print() string {
+// The format is ambiguous for keys or values containing ":" or ", "; use Entries to read entries reliably
+func (c *LRUCache) Print(ctx context.Context) string {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
 	// Get all keys from the cache list
-	keys, err := c.client.LRange(ctx, "cache", 0, -1).Result()
+	var keys []string
+	err := c.retry(ctx, "print", func(ctx context.Context) (err error) {
+		keys, err = c.client.LRange(ctx, c.list, 0, -1).Result()
+		return err
+	})
 	if err != nil {
-		log.Fatalf("Error getting cache keys: %v", err)
+		log.Printf("Error getting cache keys: %v", err)
+		return ""
 	}
 	orderedItems := []string{}
 
@@ -93,62 +464,116 @@ func (c *LRUCache) Print() string {
 		value, err := c.client.Get(ctx, key).Result()
 		if err == redis.Nil {
 			// Key does not exist, remove it from the list
-			c.client.LRem(ctx, "cache", 0, key)
+			c.forget(ctx, key)
 			continue
+		} else if isWrongType(err) {
+			value = "" // Hashes, lists and sets have no string value
 		} else if err != nil {
-			log.Fatalf("Error getting key %s: %v", key, err)
+			log.Printf("Error getting key %s: %v", key, err)
+			return ""
 		}
-		orderedItems = append(orderedItems, fmt.Sprintf("%s:%s", key, value))
+		orderedItems = append(orderedItems, fmt.Sprintf("%s:%s", c.userKey(key), value))
 	}
 	// Concatenate the ordered items into a single string
 	return strings.Join(orderedItems, ", ")
 }
 
 // Del deletes the key-value pair associated with the given key from the cache
-func (c *LRUCache) Del(key string) {
-	// Check if the key exists
-	exists, err := c.client.Exists(ctx, key).Result()
+func (c *LRUCache) Del(ctx context.Context, key string) {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	existed, err := c.delete(ctx, c.key(key))
 	if err != nil {
-		log.Fatalf("Error checking if key %s exists: %v", key, err)
+		log.Printf("Error deleting key %s: %v", key, err)
+		return
 	}
+	if existed[0] {
+		c.counters.deletes.Add(1)
+	}
+}
 
-	if exists > 0 {
-		// Remove the key from the cache list
-		if _, err := c.client.LRem(ctx, "cache", 0, key).Result(); err != nil {
-			log.Fatalf("Error removing key %s from cache: %v", key, err)
-		}
-		// Delete the key-value pair from Redis
-		if _, err := c.client.Del(ctx, key).Result(); err != nil {
-			log.Fatalf("Error deleting key %s: %v", key, err)
+// flushScript flushes the database but keeps the version counter, KEYS[1], so versions handed out after
+// the flush never repeat one a client may still hold in an ETag
+var flushScript = redis.NewScript(`
+local version = redis.call('GET', KEYS[1])
+redis.call('FLUSHDB')
+if version then
+	redis.call('SET', KEYS[1], version)
+end
+return 1
+`)
+
+// DEL_ALL clears the entire cache
+// In the default namespace this flushes the whole database, namespaces included, keeping only the version
+// counter; a namespace only deletes its own keys
+func (c *LRUCache) DEL_ALL(ctx context.Context) {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	if c.prefix == "" {
+		err := c.retry(ctx, "del_all", func(ctx context.Context) error {
+			return flushScript.Run(ctx, c.client, []string{versionKey}).Err()
+		})
+		if err != nil {
+			log.Printf("Error flushing the cache: %v", err)
 		}
+		return
 	}
+	c.deleteNamespaceKeys(ctx)
 }
 
-// DEL_ALL clears the entire cache
-func (c *LRUCache) DEL_ALL() {
-	c.client.FlushAll(ctx)
+// isWrongType reports whether err is a WRONGTYPE reply, which Redis returns for a command
+// used on a key holding another type of value
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// moveToFront moves the Redis key to the front of the list in a single transaction,
+// so concurrent calls cannot leave duplicate entries behind
+func (c *LRUCache) moveToFront(ctx context.Context, key string) {
+	err := c.retry(ctx, "move_to_front", func(ctx context.Context) error {
+		_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LRem(ctx, c.list, 0, key)
+			pipe.LPush(ctx, c.list, key)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("Error moving key %s to the front of the cache: %v", key, err)
+	}
 }
 
 // evictItems ensures the cache size does not exceed maxLength
-func (c *LRUCache) evictItems(maxLength int) {
+func (c *LRUCache) evictItems(ctx context.Context, maxLength int) {
+	c.evictTo(ctx, maxLength, EvictCapacity)
+}
+
+// evictTo removes expired keys from the list, then evicts the least recently used keys until at most
+// maxLength remain, counting the evictions under reason
+func (c *LRUCache) evictTo(ctx context.Context, maxLength int, reason string) {
 	// Get current length of the cache
-	length, err := c.client.LLen(ctx, "cache").Result()
+	length, err := c.client.LLen(ctx, c.list).Result()
 	if err != nil {
-		log.Fatalf("Error getting cache length: %v", err)
+		log.Printf("Error getting cache length: %v", err)
+		return
 	}
 
 	// Check for expired keys and remove them
 	for i := int64(0); i < length; i++ {
-		keyToCheck, err := c.client.LIndex(ctx, "cache", i).Result()
-		if err != nil {
-			log.Fatalf("Error getting key at index %d: %v", i, err)
+		keyToCheck, err := c.client.LIndex(ctx, c.list, i).Result()
+		if err == redis.Nil {
+			break // The list was shortened concurrently
+		} else if err != nil {
+			log.Printf("Error getting key at index %d: %v", i, err)
+			return
 		}
 		exists, err := c.client.Exists(ctx, keyToCheck).Result()
 		if err != nil {
-			log.Fatalf("Error checking if key %s exists: %v", keyToCheck, err)
+			log.Printf("Error checking if key %s exists: %v", keyToCheck, err)
+			return
 		}
-		if exists == 0 {
-			c.client.LRem(ctx, "cache", 0, keyToCheck)
+		if exists == 0 && c.forget(ctx, keyToCheck) {
+			c.counters.expirations.Add(1)
 			i--
 			length--
 		}
@@ -156,14 +581,23 @@ func (c *LRUCache) evictItems(maxLength int) {
 
 	// Evict excess items if cache size exceeds maxLength
 	for length > int64(maxLength) {
-		oldest, err := c.client.RPop(ctx, "cache").Result()
+		oldest, err := c.client.RPop(ctx, c.list).Result()
 		if err != nil {
-			log.Fatalf("Error popping oldest key: %v", err)
+			log.Printf("Error popping oldest key: %v", err)
+			return
+		}
+		if _, err := c.delete(ctx, oldest); err != nil {
+			log.Printf("Error evicting key %s: %v", oldest, err)
+			return
+		}
+		c.evictions.Add(1)
+		if reason == EvictResize {
+			c.counters.resized.Add(1)
 		}
-		c.client.Del(ctx, oldest)
-		length, err = c.client.LLen(ctx, "cache").Result()
+		length, err = c.client.LLen(ctx, c.list).Result()
 		if err != nil {
-			log.Fatalf("Error getting cache length: %v", err)
+			log.Printf("Error getting cache length: %v", err)
+			return
 		}
 	}
 }
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/metrics"
+)
+
+// Defaults of the timeouts and retries of the operations of a cache
+const (
+	DefaultReadTimeout  = 1 * time.Second       // How long a read may take, retries included
+	DefaultWriteTimeout = 5 * time.Second       // How long a write may take, evictions included
+	DefaultMaxRetries   = 2                     // Retries of an idempotent operation after Redis failed to answer
+	DefaultRetryBackoff = 10 * time.Millisecond // Backoff before the first retry
+)
+
+// policy holds the timeouts and retries of the operations of a cache, shared by its namespaces
+type policy struct {
+	readTimeout, writeTimeout time.Duration
+	maxRetries                int
+	backoff                   time.Duration
+	retries                   metrics.CounterVec // Retries by operation name
+}
+
+// newPolicy returns the policy configured by opts, using the defaults for zero values
+func newPolicy(opts Options) *policy {
+	p := &policy{
+		readTimeout:  opts.ReadTimeout,
+		writeTimeout: opts.WriteTimeout,
+		maxRetries:   opts.MaxRetries,
+		backoff:      opts.RetryBackoff,
+	}
+	if p.readTimeout <= 0 {
+		p.readTimeout = DefaultReadTimeout
+	}
+	if p.writeTimeout <= 0 {
+		p.writeTimeout = DefaultWriteTimeout
+	}
+	if p.maxRetries == 0 {
+		p.maxRetries = DefaultMaxRetries
+	} else if p.maxRetries < 0 {
+		p.maxRetries = 0
+	}
+	if p.backoff <= 0 {
+		p.backoff = DefaultRetryBackoff
+	}
+	return p
+}
+
+// read returns ctx limited to the read timeout
+func (p *policy) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.readTimeout)
+}
+
+// write returns ctx limited to the write timeout
+func (p *policy) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.writeTimeout)
+}
+
+// retryingKey is the context key marking commands sent by retry, whose failures it counts itself
+type retryingKey struct{}
+
+// retry runs op, which must only send idempotent commands and return the error of the first one that fails,
+// and runs it again while Redis fails to answer, up to the maximum number of retries and as long as ctx is not
+// done. The backoff doubles before each retry and is jittered between half and all of its value, so clients
+// retrying together spread out. Only the failure of the last attempt counts towards Failures
+func (c *LRUCache) retry(ctx context.Context, operation string, op func(ctx context.Context) error) error {
+	ctx = context.WithValue(ctx, retryingKey{}, true)
+	err := op(ctx)
+	for attempt := 0; attempt < c.policy.maxRetries && isFailure(err); attempt++ {
+		backoff := c.policy.backoff << attempt
+		timer := time.NewTimer(backoff/2 + rand.N(backoff/2+1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.hook.fail(ctx)
+			return err
+		case <-timer.C:
+		}
+		c.policy.retries.With(operation).Inc()
+		err = op(ctx)
+	}
+	if isFailure(err) {
+		c.hook.fail(ctx)
+	}
+	return err
+}
+
+// Retries calls fn with the number of retries of every operation that was retried, by operation name
+// such as "get" or "mget"
+// Namespaces share the counts of the cache they were created from
+func (c *LRUCache) Retries(fn func(operation string, n uint64)) {
+	c.policy.retries.Each(func(values []string, n uint64) {
+		fn(values[0], n)
+	})
+}
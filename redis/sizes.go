@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"context"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sizesKey is the hash mapping every key holding a value to the size of its user key and content, counted like the
+// in-memory tier counts them, with the field "" holding their total
+const sizesKey = "cache:sizes"
+
+// sizeLua defines the functions the scripts writing or deleting values use to keep the sizes hash
+// size(key, offset) measures key, whose user key starts after offset bytes: the value of a string, every field
+// and value of a hash, every item of a list and every member of a set; resize(sizes, key, n) records n as the size
+// of key, 0 removing it, and adjusts the total
+const sizeLua = `
+local function size(key, offset)
+	local kind = redis.call('TYPE', key).ok
+	local n = #key - offset
+	local items
+	if kind == 'string' then
+		return n + redis.call('STRLEN', key)
+	elseif kind == 'hash' then
+		items = redis.call('HGETALL', key)
+	elseif kind == 'list' then
+		items = redis.call('LRANGE', key, 0, -1)
+	elseif kind == 'set' then
+		items = redis.call('SMEMBERS', key)
+	else
+		return 0
+	end
+	for _, item in ipairs(items) do
+		n = n + #item
+	end
+	return n
+end
+local function resize(sizes, key, n)
+	local old = tonumber(redis.call('HGET', sizes, key) or 0)
+	if n > 0 then
+		redis.call('HSET', sizes, key, n)
+	else
+		redis.call('HDEL', sizes, key)
+	end
+	if n ~= old then
+		redis.call('HINCRBY', sizes, '', n - old)
+	end
+end
+`
+
+// deleteScript deletes keys along with their list entries, versions, content types and sizes
+// KEYS are the list, the version hash, the content type hash, the sizes hash and then the keys to delete
+// It returns 1 for each key that existed and 0 for the others
+var deleteScript = redis.NewScript(sizeLua + `
+local deleted = {}
+for i = 5, #KEYS do
+	deleted[i - 4] = redis.call('DEL', KEYS[i])
+	redis.call('LREM', KEYS[1], 0, KEYS[i])
+	redis.call('HDEL', KEYS[2], KEYS[i])
+	redis.call('HDEL', KEYS[3], KEYS[i])
+	resize(KEYS[4], KEYS[i], 0)
+end
+return deleted
+`)
+
+// forgetScript removes the list entry, version, content type and size of a key that expired
+// KEYS are the list, the version hash, the content type hash, the sizes hash and the key
+// It returns 1 if the key no longer exists and 0, leaving it alone, if it was written again in the meantime
+var forgetScript = redis.NewScript(sizeLua + `
+if redis.call('EXISTS', KEYS[5]) == 1 then
+	return 0
+end
+redis.call('LREM', KEYS[1], 0, KEYS[5])
+redis.call('HDEL', KEYS[2], KEYS[5])
+redis.call('HDEL', KEYS[3], KEYS[5])
+resize(KEYS[4], KEYS[5], 0)
+return 1
+`)
+
+// offset is the length of the part of every Redis key of a value that precedes the user key, passed to the scripts
+// measuring sizes
+func (c *LRUCache) offset() int {
+	return len(c.prefix) + len(dataPrefix)
+}
+
+// delete deletes Redis keys with deleteScript and removes them from the tag index
+// It reports for each key whether it existed
+func (c *LRUCache) delete(ctx context.Context, keys ...string) ([]bool, error) {
+	var res []interface{}
+	err := c.retry(ctx, "delete", func(ctx context.Context) (err error) {
+		scriptKeys := append([]string{c.list, c.versions, c.contentTypes, c.sizes}, keys...)
+		res, err = deleteScript.Run(ctx, c.client, scriptKeys).Slice()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.untag(ctx, keys...)
+	existed := make([]bool, len(res))
+	for i, n := range res {
+		existed[i] = n.(int64) == 1
+	}
+	return existed, nil
+}
+
+// forget removes the bookkeeping of a Redis key found missing with forgetScript and removes it from the tag index
+// It reports whether the key was still missing
+func (c *LRUCache) forget(ctx context.Context, key string) bool {
+	var forgotten int
+	err := c.retry(ctx, "forget", func(ctx context.Context) (err error) {
+		forgotten, err = forgetScript.Run(ctx, c.client, []string{c.list, c.versions, c.contentTypes, c.sizes, key}).Int()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error removing expired key %s: %v", key, err)
+		return false
+	}
+	if forgotten == 1 {
+		c.untag(ctx, key)
+	}
+	return forgotten == 1
+}
+
+// Bytes returns the size of all keys and values held by Redis, counted like the in-memory tier counts them
+// Values stored before Redis kept sizes are not counted
+func (c *LRUCache) Bytes(ctx context.Context) int64 {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var bytes int64
+	err := c.retry(ctx, "bytes", func(ctx context.Context) (err error) {
+		bytes, err = c.client.HGet(ctx, c.sizes, "").Int64()
+		return err
+	})
+	if err != nil && err != redis.Nil {
+		log.Printf("Error getting cache size: %v", err)
+	}
+	return bytes
+}
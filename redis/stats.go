@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// Reasons for evicting keys, as reported by Stats
+const (
+	EvictCapacity = "capacity" // A new key did not fit within the maximum length
+	EvictResize   = "resize"   // Resize shrank the cache
+)
+
+// counters holds the counts of operations of a cache, updated atomically
+type counters struct {
+	hits, misses, sets, deletes, expirations atomic.Uint64
+	resized                                  atomic.Uint64 // Evictions made by Resize
+}
+
+// Stats counts what happened in a cache since it was created
+// Redis expires keys on its own, so the cache only learns of an expiration when it finds a key of the list
+// missing while cleaning the list up, before evicting or when printing; Expirations counts only those keys
+type Stats struct {
+	Hits        uint64            // Reads of a string value that found it
+	Misses      uint64            // Reads of a string value that did not find it
+	Sets        uint64            // Writes that stored a value, including hashes, lists and sets
+	Deletes     uint64            // Keys deleted on request, not counting expirations and evictions
+	Expirations uint64            // Keys found missing, having expired, while cleaning up the list
+	Evictions   map[string]uint64 // Keys evicted to stay within the maximum length, by reason such as EvictCapacity
+	Entries     int               // Keys currently in the list
+	Bytes       int64             // Size of the keys and values held, see Bytes
+	Memory      int64             // Memory used by the whole Redis server as reported by INFO memory, 0 if unknown
+}
+
+// Stats returns the counts of operations of the cache and its current number of keys
+func (c *LRUCache) Stats(ctx context.Context) Stats {
+	evictions, resized := c.evictions.Load(), c.counters.resized.Load()
+	return Stats{
+		Hits:        c.counters.hits.Load(),
+		Misses:      c.counters.misses.Load(),
+		Sets:        c.counters.sets.Load(),
+		Deletes:     c.counters.deletes.Load(),
+		Expirations: c.counters.expirations.Load(),
+		Evictions:   map[string]uint64{EvictCapacity: evictions - resized, EvictResize: resized},
+		Entries:     c.Len(ctx),
+		Bytes:       c.Bytes(ctx),
+		Memory:      c.UsedMemory(ctx),
+	}
+}
+
+// UsedMemory returns the memory used by the Redis server, the used_memory field of INFO memory
+// It returns 0 if Redis cannot be reached
+func (c *LRUCache) UsedMemory(ctx context.Context) int64 {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var info string
+	err := c.retry(ctx, "info", func(ctx context.Context) (err error) {
+		info, err = c.client.Info(ctx, "memory").Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error getting the memory used by Redis: %v", err)
+		return 0
+	}
+	for _, line := range strings.Split(info, "\r\n") {
+		if value, found := strings.CutPrefix(line, "used_memory:"); found {
+			memory, _ := strconv.ParseInt(value, 10, 64)
+			return memory
+		}
+	}
+	return 0
+}
+
+// countRead counts a read of a string value as a hit or a miss
+func (c *LRUCache) countRead(found bool) {
+	if found {
+		c.counters.hits.Add(1)
+	} else {
+		c.counters.misses.Add(1)
+	}
+}
+
+// Latencies calls fn with the latency histogram of every command sent over the connection of the cache,
+// by command name such as "get" or "evalsha", with "pipeline" for pipelines and transactions
+// Namespaces share the connection, and so the histograms, of the cache they were created from
+func (c *LRUCache) Latencies(fn func(command string, latency metrics.HistogramSnapshot)) {
+	c.hook.latency.Each(func(values []string, latency metrics.HistogramSnapshot) {
+		fn(values[0], latency)
+	})
+}
+
+// Failures returns how many commands, or pipelines, did not reach Redis or got no answer in time, such as when
+// Redis is down or the connection broke; replies such as a missing key or WRONGTYPE are not failures, and
+// neither are commands cancelled by their caller or failures followed by a successful retry
+// Namespaces share the count of the cache they were created from
+func (c *LRUCache) Failures() uint64 {
+	return c.hook.failures.Load()
+}
+
+// failuresKey is the context key of the failure count of an operation, see TrackFailures
+type failuresKey struct{}
+
+// TrackFailures returns a context counting the failures, as counted by Failures, of the commands sent with it
+// or a context derived from it, so that concurrent operations can tell whether their own commands failed
+// A context derived from the returned one and passed to TrackFailures again counts separately
+func TrackFailures(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failuresKey{}, new(atomic.Uint64))
+}
+
+// Failed reports whether a command sent with ctx, returned by TrackFailures, failed since it was created
+func Failed(ctx context.Context) bool {
+	n, ok := ctx.Value(failuresKey{}).(*atomic.Uint64)
+	return ok && n.Load() > 0
+}
+
+// startKey is the context key of the time a command was sent
+type startKey struct{}
+
+// commandHook records the duration of every command in a histogram by command name and counts failed commands
+type commandHook struct {
+	latency  *metrics.HistogramVec
+	failures atomic.Uint64
+}
+
+// BeforeProcess records the time a command is sent
+func (h *commandHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+// AfterProcess records the latency of a command and whether it failed
+func (h *commandHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.observe(ctx, cmd.Name())
+	if isFailure(cmd.Err()) && ctx.Value(retryingKey{}) == nil {
+		h.fail(ctx)
+	}
+	return nil
+}
+
+// BeforeProcessPipeline records the time a pipeline is sent
+func (h *commandHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+// AfterProcessPipeline records the latency of a pipeline and whether it failed
+func (h *commandHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	h.observe(ctx, "pipeline")
+	if ctx.Value(retryingKey{}) != nil {
+		return nil // Counted by retry
+	}
+	for _, cmd := range cmds {
+		if isFailure(cmd.Err()) {
+			h.fail(ctx)
+			break
+		}
+	}
+	return nil
+}
+
+// fail counts a failed command, both in the count of the connection and in that of the operation tracked by ctx
+func (h *commandHook) fail(ctx context.Context) {
+	h.failures.Add(1)
+	if n, ok := ctx.Value(failuresKey{}).(*atomic.Uint64); ok {
+		n.Add(1)
+	}
+}
+
+// isFailure reports whether err means Redis could not be reached or did not answer, rather than a reply
+// such as redis.Nil, a WRONGTYPE error or an aborted transaction, or the caller cancelling the command
+func isFailure(err error) bool {
+	if err == nil || err == redis.Nil || err == redis.TxFailedErr || errors.Is(err, context.Canceled) {
+		return false
+	}
+	_, isReply := err.(redis.Error)
+	return !isReply
+}
+
+// observe records the time since the command was sent
+func (h *commandHook) observe(ctx context.Context, command string) {
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		h.latency.With(command).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Prefixes of the sets used to index tags
+const (
+	tagPrefix     = "cache:tag:"  // Set of the keys carrying a tag, after the namespace prefix
+	keyTagsPrefix = "cache:tags:" // Set of the tags attached to a key, followed by the Redis key
+)
+
+// The scripts below are given every key they can name up front in KEYS; the sets they only find while running,
+// such as the tag sets of a key being deleted, are built from prefixes passed in ARGV, so each namespace has
+// its own tags. The sets hold Redis keys, which already carry the namespace prefix
+
+// tagScript attaches tags to an existing key
+// KEYS are the key, the set of its tags and the set of each tag; ARGV holds the tags in the same order
+// It returns 1 if the key exists and 0 otherwise
+var tagScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+for i = 1, #ARGV do
+	redis.call('SADD', KEYS[i + 2], KEYS[1])
+	redis.call('SADD', KEYS[2], ARGV[i])
+end
+return 1
+`)
+
+// untagScript removes keys from the tag index
+// KEYS hold each key to untag followed by the set of its tags; ARGV[1] is the tag prefix
+var untagScript = redis.NewScript(`
+for i = 1, #KEYS, 2 do
+	for _, tag in ipairs(redis.call('SMEMBERS', KEYS[i + 1])) do
+		redis.call('SREM', ARGV[1] .. tag, KEYS[i])
+	end
+	redis.call('DEL', KEYS[i + 1])
+end
+return 0
+`)
+
+// invalidateTagScript deletes every key carrying a tag along with its list entry, version, content type, size and tags
+// KEYS are the list, the version hash, the content type hash, the set of the tag and the sizes hash;
+// ARGV holds the tag prefix and the prefix of the sets of the tags of a key
+// It returns the keys that existed
+var invalidateTagScript = redis.NewScript(sizeLua + `
+local deleted = {}
+for _, key in ipairs(redis.call('SMEMBERS', KEYS[4])) do
+	if redis.call('DEL', key) == 1 then
+		deleted[#deleted + 1] = key
+	end
+	redis.call('LREM', KEYS[1], 0, key)
+	redis.call('HDEL', KEYS[2], key)
+	redis.call('HDEL', KEYS[3], key)
+	resize(KEYS[5], key, 0)
+	for _, tag in ipairs(redis.call('SMEMBERS', ARGV[2] .. key)) do
+		redis.call('SREM', ARGV[1] .. tag, key)
+	end
+	redis.call('DEL', ARGV[2] .. key)
+end
+return deleted
+`)
+
+// Tag attaches tags to an existing key so it can be invalidated together with other keys carrying them
+// The boolean reports whether the key was found
+func (c *LRUCache) Tag(ctx context.Context, key string, tags ...string) bool {
+	keys := []string{c.key(key), keyTagsPrefix + c.key(key)}
+	args := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		keys = append(keys, c.prefix+tagPrefix+tag)
+		args[i] = tag
+	}
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	var found int
+	err := c.retry(ctx, "tag", func(ctx context.Context) (err error) {
+		found, err = tagScript.Run(ctx, c.client, keys, args...).Int()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error tagging key %s: %v", key, err)
+		return false
+	}
+	return found == 1
+}
+
+// KeysByTag returns the existing keys carrying the given tag in sorted order
+func (c *LRUCache) KeysByTag(ctx context.Context, tag string) []string {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	keys := []string{}
+	err := c.retry(ctx, "keys_by_tag", func(ctx context.Context) error {
+		members, err := c.client.SMembers(ctx, c.prefix+tagPrefix+tag).Result()
+		if err != nil {
+			return err
+		}
+		keys = keys[:0]
+		for _, key := range members {
+			exists, err := c.client.Exists(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if exists > 0 {
+				keys = append(keys, c.userKey(key))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error getting keys tagged %s: %v", tag, err)
+		return []string{}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InvalidateTag deletes every key carrying the given tag in one atomic step and returns the deleted keys
+func (c *LRUCache) InvalidateTag(ctx context.Context, tag string) []string {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	keys := []string{c.list, c.versions, c.contentTypes, c.prefix + tagPrefix + tag, c.sizes}
+	res, err := invalidateTagScript.Run(ctx, c.client, keys, c.prefix+tagPrefix, keyTagsPrefix).StringSlice()
+	if err != nil && err != redis.Nil {
+		log.Printf("Error invalidating tag %s: %v", tag, err)
+		return []string{}
+	}
+	for i, key := range res {
+		res[i] = c.userKey(key)
+	}
+	c.counters.deletes.Add(uint64(len(res)))
+	return res
+}
+
+// untag removes deleted Redis keys from the tag index
+func (c *LRUCache) untag(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	scriptKeys := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		scriptKeys = append(scriptKeys, key, keyTagsPrefix+key)
+	}
+	if err := untagScript.Run(ctx, c.client, scriptKeys, c.prefix+tagPrefix).Err(); err != nil && err != redis.Nil {
+		log.Printf("Error untagging %d keys: %v", len(keys), err)
+	}
+}
@@ -0,0 +1,204 @@
+package redis
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// typedWriteScript runs a write command on a hash, list or set, assigns the key a new version and moves it
+// to the front of the list in one atomic step; if the command left the key empty, and so deleted,
+// its list entry, version and tags are removed instead
+// KEYS are the key, the list, the version counter, the version hash, the set of the tags of the key and the sizes
+// hash; ARGV holds the command, the tag prefix, the offset of the user key in the key and the arguments of the command
+// It returns {reply of the command, whether the key existed before, version}
+var typedWriteScript = redis.NewScript(sizeLua + `
+local existed = redis.call('EXISTS', KEYS[1])
+local ok, reply = pcall(redis.call, ARGV[1], KEYS[1], unpack(ARGV, 4))
+if not ok then
+	return redis.error_reply(type(reply) == 'table' and reply.err or tostring(reply))
+end
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('LREM', KEYS[2], 0, KEYS[1])
+	redis.call('HDEL', KEYS[4], KEYS[1])
+	for _, tag in ipairs(redis.call('SMEMBERS', KEYS[5])) do
+		redis.call('SREM', ARGV[2] .. tag, KEYS[1])
+	end
+	redis.call('DEL', KEYS[5])
+	resize(KEYS[6], KEYS[1], 0)
+	return {reply, existed, 0}
+end
+resize(KEYS[6], KEYS[1], size(KEYS[1], tonumber(ARGV[3])))
+local version = redis.call('INCR', KEYS[3])
+redis.call('HSET', KEYS[4], KEYS[1], version)
+redis.call('LREM', KEYS[2], 0, KEYS[1])
+redis.call('LPUSH', KEYS[2], KEYS[1])
+return {reply, existed, version}
+`)
+
+// Type returns the type of the value stored at key as reported by the TYPE command, "none" if it does not exist
+func (c *LRUCache) Type(ctx context.Context, key string) string {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var kind string
+	err := c.retry(ctx, "type", func(ctx context.Context) (err error) {
+		kind, err = c.client.Type(ctx, c.key(key)).Result()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error getting type of key %s: %v", key, err)
+		return "none"
+	}
+	return kind
+}
+
+// HSet sets fields of the hash stored at key with HSET and returns the number of new fields and the new version
+// The boolean reports whether the key existed before; a WRONGTYPE error is returned if it holds another type
+func (c *LRUCache) HSet(ctx context.Context, key string, fields map[string]string, maxLength int) (int, bool, uint64, error) {
+	args := make([]interface{}, 0, 2*len(fields))
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	return c.typedWrite(ctx, key, maxLength, "HSET", args...)
+}
+
+// HGet returns the value of a field of the hash stored at key; the boolean reports whether the field exists
+// The key is moved to the front of the list if the field exists
+func (c *LRUCache) HGet(ctx context.Context, key, field string) (string, bool, error) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var value string
+	err := c.retry(ctx, "hget", func(ctx context.Context) (err error) {
+		value, err = c.client.HGet(ctx, c.key(key), field).Result()
+		return err
+	})
+	if err == redis.Nil {
+		return "", false, nil
+	} else if isWrongType(err) {
+		return "", false, err
+	} else if err != nil {
+		log.Printf("Error getting field %s of key %s: %v", field, key, err)
+		return "", false, err
+	}
+	c.moveToFront(ctx, c.key(key))
+	return value, true, nil
+}
+
+// HGetAll returns the hash stored at key, or an empty map if the key does not exist
+func (c *LRUCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var fields map[string]string
+	err := c.retry(ctx, "hgetall", func(ctx context.Context) (err error) {
+		fields, err = c.client.HGetAll(ctx, c.key(key)).Result()
+		return err
+	})
+	if isWrongType(err) {
+		return map[string]string{}, err
+	} else if err != nil {
+		log.Printf("Error getting key %s: %v", key, err)
+		return map[string]string{}, err
+	}
+	if len(fields) > 0 {
+		c.moveToFront(ctx, c.key(key))
+	}
+	return fields, nil
+}
+
+// HDel removes fields from the hash stored at key with HDEL and returns how many were removed and the new version
+// Redis deletes the key once its last field is removed, in which case the version is 0
+func (c *LRUCache) HDel(ctx context.Context, key string, fields ...string) (int, uint64, error) {
+	args := make([]interface{}, len(fields))
+	for i, field := range fields {
+		args[i] = field
+	}
+	removed, _, version, err := c.typedWrite(ctx, key, 0, "HDEL", args...)
+	return removed, version, err
+}
+
+// LPush inserts values at the head of the list stored at key with LPUSH and returns the new length of the list
+// and the new version; the boolean reports whether the key existed before
+func (c *LRUCache) LPush(ctx context.Context, key string, values []string, maxLength int) (int, bool, uint64, error) {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return c.typedWrite(ctx, key, maxLength, "LPUSH", args...)
+}
+
+// LRange returns the items of the list stored at key between start and stop with LRANGE
+func (c *LRUCache) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var items []string
+	err := c.retry(ctx, "lrange", func(ctx context.Context) (err error) {
+		items, err = c.client.LRange(ctx, c.key(key), int64(start), int64(stop)).Result()
+		return err
+	})
+	if isWrongType(err) {
+		return []string{}, err
+	} else if err != nil {
+		log.Printf("Error getting range of key %s: %v", key, err)
+		return []string{}, err
+	}
+	if len(items) > 0 {
+		c.moveToFront(ctx, c.key(key))
+	}
+	return items, nil
+}
+
+// SAdd adds members to the set stored at key with SADD and returns the number of new members and the new version
+// The boolean reports whether the key existed before
+func (c *LRUCache) SAdd(ctx context.Context, key string, members []string, maxLength int) (int, bool, uint64, error) {
+	args := make([]interface{}, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	return c.typedWrite(ctx, key, maxLength, "SADD", args...)
+}
+
+// SMembers returns the members of the set stored at key in sorted order
+func (c *LRUCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	ctx, cancel := c.policy.read(ctx)
+	defer cancel()
+	var members []string
+	err := c.retry(ctx, "smembers", func(ctx context.Context) (err error) {
+		members, err = c.client.SMembers(ctx, c.key(key)).Result()
+		return err
+	})
+	if isWrongType(err) {
+		return []string{}, err
+	} else if err != nil {
+		log.Printf("Error getting members of key %s: %v", key, err)
+		return []string{}, err
+	}
+	if len(members) > 0 {
+		c.moveToFront(ctx, c.key(key))
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// typedWrite runs command on key with typedWriteScript and evicts items if the key may have been added
+// A maxLength of zero or less skips eviction, for commands that never add keys
+// It returns the reply of the command, whether the key existed and the new version, 0 if the key was deleted
+func (c *LRUCache) typedWrite(ctx context.Context, key string, maxLength int, command string, args ...interface{}) (int, bool, uint64, error) {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	keys := []string{c.key(key), c.list, versionKey, c.versions, keyTagsPrefix + c.key(key), c.sizes}
+	res, err := typedWriteScript.Run(ctx, c.client, keys, append([]interface{}{command, c.prefix + tagPrefix, c.offset()}, args...)...).Slice()
+	if _, ok := err.(redis.Error); ok {
+		return 0, false, 0, err
+	} else if err != nil {
+		log.Printf("Error running %s on key %s: %v", command, key, err)
+		return 0, false, 0, err
+	}
+	if maxLength > 0 {
+		// Ensure cache size does not exceed maxLength
+		c.evictItems(ctx, maxLength)
+		c.counters.sets.Add(1)
+	}
+	return int(res[0].(int64)), res[1].(int64) == 1, uint64(res[2].(int64)), nil
+}
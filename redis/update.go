@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// updateRetries is how many times Update retries when the key changes between its read and its write
+const updateRetries = 10
+
+var (
+	// ErrNotFound is returned by Update when the key does not exist
+	ErrNotFound = errors.New("key not found")
+	// ErrConflict is returned by Update when the key kept changing on every attempt
+	ErrConflict = errors.New("key was modified concurrently, try again")
+)
+
+// Update replaces the string value of key with the result of fn, using WATCH so the write only succeeds
+// if nobody changed the key since fn read it; otherwise fn is called again with the new value
+// The key keeps its TTL, gets a new version and is moved to the front of the list
+// It returns the new value, its version and the remaining TTL, like IncrBy; errors of fn and a WRONGTYPE error
+// are returned as they are
+func (c *LRUCache) Update(ctx context.Context, key string, maxLength int, fn func(value string) (string, error)) (string, uint64, time.Duration, error) {
+	ctx, cancel := c.policy.write(ctx)
+	defer cancel()
+	k := c.key(key)
+	for attempt := 0; attempt < updateRetries; attempt++ {
+		var value string
+		var version uint64
+		var pttl *redis.DurationCmd
+		var fnErr error
+		err := c.client.Watch(ctx, func(tx *redis.Tx) error {
+			old, err := tx.Get(ctx, k).Result()
+			if err != nil {
+				return err
+			}
+			if value, fnErr = fn(old); fnErr != nil {
+				return fnErr
+			}
+			// Taking the version before the transaction keeps versions increasing: any write that
+			// takes a later one and lands first makes the transaction fail
+			n, err := tx.Incr(ctx, versionKey).Result()
+			if err != nil {
+				return err
+			}
+			version = uint64(n)
+			// Only writes that also change k change its size, so the WATCH covers it
+			oldSize, err := tx.HGet(ctx, c.sizes, k).Int64()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			size := int64(len(key) + len(value))
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, k, value, redis.KeepTTL)
+				pipe.HSet(ctx, c.sizes, k, size)
+				pipe.HIncrBy(ctx, c.sizes, "", size-oldSize)
+				pipe.HSet(ctx, c.versions, k, version)
+				pipe.LRem(ctx, c.list, 0, k)
+				pipe.LPush(ctx, c.list, k)
+				pttl = pipe.PTTL(ctx, k)
+				return nil
+			})
+			return err
+		}, k)
+		switch {
+		case err == redis.TxFailedErr:
+			continue // The key changed after it was read
+		case fnErr != nil:
+			return "", 0, 0, fnErr
+		case err == redis.Nil:
+			return "", 0, 0, ErrNotFound
+		case isWrongType(err):
+			return "", 0, 0, err
+		case err != nil:
+			log.Printf("Error updating key %s: %v", key, err)
+			return "", 0, 0, err
+		}
+		// Ensure cache size does not exceed maxLength
+		c.evictItems(ctx, maxLength)
+		c.counters.sets.Add(1)
+		ttl := time.Duration(-1)
+		if d := pttl.Val(); d > 0 {
+			ttl = d
+		}
+		return value, version, ttl, nil
+	}
+	return "", 0, 0, ErrConflict
+}
@@ -0,0 +1,101 @@
+package zin1
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/devisettymahidhar315/zin1/config"
+)
+
+// configPollInterval is how often WatchConfig checks whether the configuration file changed
+const configPollInterval = 2 * time.Second
+
+// errNoConfig is returned by Reload for a Server built from Options rather than a configuration
+var errNoConfig = errors.New("zin1: the server was not built from a configuration, use NewServerFromConfig")
+
+// Reload applies the settings of cfg that can change while serving: the capacity, evicting the least
+// recently used entries if it shrinks, the default TTL, the cleanup interval, the write rate limit, the
+// log level, the value size limit, the print format, the probe timeout, the shutdown timeout and the
+// snapshot path. If a setting that needs a restart differs, such as the Redis address, nothing is applied
+// and the error names every such setting.
+func (s *Server) Reload(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config == nil {
+		return errNoConfig
+	}
+	if err := s.config.CheckReload(cfg); err != nil {
+		return err
+	}
+	level, _ := cfg.Level()
+	s.level.Set(level)
+	s.cache.SetCleanupInterval(time.Duration(cfg.CleanupInterval))
+	s.handler.SetOptions(apiOptions(cfg)) // Before resizing, so later writes already use the new capacity
+	if cfg.Capacity < s.config.Capacity {
+		s.cache.Resize(context.Background(), cfg.Capacity) // Bounded by the write timeout of Redis
+	}
+	s.shutdownTimeout = time.Duration(cfg.ShutdownTimeout)
+	s.snapshotPath = cfg.SnapshotPath
+	s.config = cfg
+	return nil
+}
+
+// WatchConfig reloads the configuration file at path, with the ZIN1_* environment variables on top,
+// whenever the process receives SIGHUP or the file is modified, until ctx is done. Configurations that are
+// invalid or change settings needing a restart are logged and leave the Server unchanged.
+// It also returns once the Server is closed.
+func (s *Server) WatchConfig(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	modified := modTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.closed.Done():
+			return
+		case <-hup:
+			modified = modTime(path)
+		case <-ticker.C:
+			m := modTime(path)
+			if m.Equal(modified) {
+				continue
+			}
+			modified = m
+		}
+		s.reloadFile(path)
+	}
+}
+
+// reloadFile loads the configuration file at path and applies it, logging the outcome
+func (s *Server) reloadFile(path string) {
+	cfg, err := config.Load(path)
+	if err == nil {
+		err = s.Reload(cfg)
+	}
+	if err != nil {
+		s.logger.Error("configuration not reloaded", "path", path, "error", err)
+		return
+	}
+	s.logger.Info("configuration reloaded", "path", path)
+}
+
+// modTime returns the modification time of the file at path, or the zero time if it cannot be read
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,77 @@
+package zin1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Serve serves a Server built by NewServerFromEnv with Server.Serve, reloading the configuration file named in
+// ZIN1_CONFIG while serving. It returns once the server stopped and its backends are closed.
+func Serve(ctx context.Context) error {
+	s, err := NewServerFromEnv()
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx)
+}
+
+// Serve listens on the address of the Server and serves its routes until ctx is done or the process
+// receives SIGINT or SIGTERM. It then stops accepting connections, waits up to the shutdown timeout for
+// requests in flight, saves the in-memory tier to the snapshot path, if any, and closes the Server.
+// The snapshot is loaded before listening. A second signal while stopping exits the process at once.
+func (s *Server) Serve(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.mu.Lock()
+	snapshotPath := s.snapshotPath
+	s.mu.Unlock()
+	if snapshotPath != "" {
+		if err := s.cache.LoadSnapshot(ctx, snapshotPath); err != nil {
+			s.Close()
+			return fmt.Errorf("zin1: loading snapshot %s: %w", snapshotPath, err)
+		}
+	}
+
+	srv := &http.Server{Addr: s.addr, Handler: s.Engine()}
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- srv.ListenAndServe() }()
+	s.logger.Info("listening", "addr", s.addr)
+
+	select {
+	case err := <-listenErr:
+		s.Close()
+		return fmt.Errorf("zin1: %w", err)
+	case <-ctx.Done():
+	}
+	stop() // Restore the default behavior, so a second signal exits at once
+
+	s.mu.Lock()
+	shutdownTimeout, snapshotPath := s.shutdownTimeout, s.snapshotPath
+	s.mu.Unlock()
+	s.logger.Info("shutting down", "timeout", shutdownTimeout)
+
+	errs := []error{}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("zin1: requests still in flight after %s: %w", shutdownTimeout, err))
+		srv.Close()
+	}
+	if snapshotPath != "" {
+		if err := s.cache.SaveSnapshot(snapshotPath); err != nil {
+			errs = append(errs, fmt.Errorf("zin1: saving snapshot %s: %w", snapshotPath, err))
+		}
+	}
+	errs = append(errs, s.Close())
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	s.logger.Info("stopped")
+	return nil
+}
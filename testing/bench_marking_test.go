@@ -15,7 +15,7 @@ func BenchmarkSet(b *testing.B) {
 	// Create a new multi-cache instance
 	cache := multi_cache.NewMultiCache()
 	for i := 0; i < b.N; i++ {
-		cache.Set("a", "1", len, -1)
+		cache.Set(ctx, "a", "1", len, -1)
 	}
 }
 
@@ -25,7 +25,7 @@ func BenchmarkGet(b *testing.B) {
 	// Create a new multi-cache instance
 	cache := multi_cache.NewMultiCache()
 	for i := 0; i < b.N; i++ {
-		cache.Get("a")
+		cache.Get(ctx, "a")
 
 	}
 }
@@ -36,9 +36,9 @@ func BenchmarkDel(b *testing.B) {
 	// Create a new multi-cache instance
 
 	cache := multi_cache.NewMultiCache()
-	cache.Set("a", "1", len, -1)
+	cache.Set(ctx, "a", "1", len, -1)
 	for i := 0; i < b.N; i++ {
-		cache.Del("a")
+		cache.Del(ctx, "a")
 
 	}
 }
@@ -49,9 +49,9 @@ func BenchmarkPrintRedis(b *testing.B) {
 	// Create a new multi-cache instance
 
 	cache := multi_cache.NewMultiCache()
-	cache.Set("a", "1", len, -1)
+	cache.Set(ctx, "a", "1", len, -1)
 	for i := 0; i < b.N; i++ {
-		cache.Print_redis()
+		cache.Print_redis(ctx)
 
 	}
 }
@@ -62,7 +62,7 @@ func BenchmarkPrintinmemory(b *testing.B) {
 	// Create a new multi-cache instance
 
 	cache := multi_cache.NewMultiCache()
-	cache.Set("a", "1", len, -1)
+	cache.Set(ctx, "a", "1", len, -1)
 	for i := 0; i < b.N; i++ {
 		cache.Print_in_mem()
 	}
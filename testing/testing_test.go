@@ -1,10 +1,29 @@
 package testing
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/devisettymahidhar315/zin1"
+	"github.com/devisettymahidhar315/zin1/config"
+	"github.com/devisettymahidhar315/zin1/disk"
 	"github.com/devisettymahidhar315/zin1/in_memory"
+	"github.com/devisettymahidhar315/zin1/jsondoc"
 	"github.com/devisettymahidhar315/zin1/multi_cache"
 	"github.com/devisettymahidhar315/zin1/redis"
 )
@@ -13,6 +32,9 @@ import (
 // in memory
 const len1 = 2
 
+// Context of the cache operations in tests
+var ctx = context.Background()
+
 // TestPut_inmemory tests the Put method of the inmemory cache
 func TestPut_inmemory(t *testing.T) {
 	// Initialize a new inmemory cache
@@ -146,192 +168,2306 @@ func TestDelAll_inmemory(t *testing.T) {
 
 }
 
-// redis
-// TestPut_redis tests the Put method of the Redis cache
-func TestPut_redis(t *testing.T) {
-	// Initialize a new Redis cache
-	cache := redis.NewLRUCache()
-
-	// Insert key-value pairs into the cache
+// TestPeek_inmemory tests that Peek does not change the recency of a key
+func TestPeek_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
 	cache.Put("a1", "1", len1, -1)
 	cache.Put("b1", "2", len1, -1)
 
-	// Retrieve the value for key "a1"
-	result := cache.Get("a1")
-
-	// Check if the value is as expected
+	// Peek at the least recently used key
+	result := cache.Peek("a1")
 	if result != "1" {
 		t.Error("Expected value '1', got", result)
 	}
+
+	// a1 is still the least recently used key, so it is evicted
+	cache.Put("c1", "3", len1, -1)
+	result = cache.Print()
+	expected_result := "c1:3, b1:2"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
 }
 
-// TestGet_redis tests the Get method of the Redis cache
-func TestGet_redis(t *testing.T) {
-	// Initialize a new Redis cache
-	cache := redis.NewLRUCache()
+// TestInspect_inmemory tests the Inspect method of the inmemory cache
+func TestInspect_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
+	cache.Put("a1", "1", len1, -1)
+	cache.Put("b1", "22", len1, 60)
+	cache.Get("b1")
+	cache.Get("b1")
 
-	// Insert key-value pairs into the cache
+	info, found := cache.Inspect("b1")
+	if !found {
+		t.Fatal("Expected key 'b1' to be found")
+	}
+	if info.AccessCount != 2 {
+		t.Error("Expected access count 2, got", info.AccessCount)
+	}
+	if info.Size != 4 {
+		t.Error("Expected size 4, got", info.Size)
+	}
+	if info.TTL <= 0 || info.TTL > 60*time.Second {
+		t.Error("Expected TTL within 60s, got", info.TTL)
+	}
+
+	info, _ = cache.Inspect("a1")
+	if info.TTL != in_memory.NoExpiration {
+		t.Error("Expected no expiration, got", info.TTL)
+	}
+	if _, found := cache.Inspect("v"); found {
+		t.Error("Expected non-existent key not to be found")
+	}
+}
+
+// TestExpire_inmemory tests the Expire, Persist and TTL methods of the inmemory cache
+func TestExpire_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
 	cache.Put("a1", "1", len1, -1)
-	cache.Put("b1", "2", len1, -1)
 
-	// Retrieve the value for key "a1"
-	result := cache.Get("a1")
-	if result != "1" {
+	if ttl := cache.TTL("a1"); ttl != in_memory.NoExpiration {
+		t.Error("Expected no expiration, got", ttl)
+	}
+	if !cache.Expire("a1", time.Minute) {
+		t.Error("Expected key 'a1' to be found")
+	}
+	if ttl := cache.TTL("a1"); ttl <= 0 || ttl > time.Minute {
+		t.Error("Expected TTL within a minute, got", ttl)
+	}
+	if result := cache.Get("a1"); result != "1" {
 		t.Error("Expected value '1', got", result)
 	}
+	if !cache.Persist("a1") {
+		t.Error("Expected key 'a1' to be found")
+	}
+	if ttl := cache.TTL("a1"); ttl != in_memory.NoExpiration {
+		t.Error("Expected no expiration, got", ttl)
+	}
 
-	// Attempt to retrieve a value for a non-existent key "v"
-	result = cache.Get("v")
-	if result != "" {
-		t.Error("Expected empty string for non-existent key, got", result)
+	// A short expiration removes the key
+	cache.Expire("a1", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if ttl := cache.TTL("a1"); ttl != in_memory.KeyNotFound {
+		t.Error("Expected key not found, got", ttl)
+	}
+	if cache.Expire("v", time.Minute) || cache.Persist("v") || cache.Touch("v") {
+		t.Error("Expected non-existent key not to be found")
 	}
 }
 
-// TestPrint_redis tests the Print method of the Redis cache
-func TestPrint_redis(t *testing.T) {
-	// Initialize a new Redis cache
-	cache := redis.NewLRUCache()
-
-	// Insert key-value pairs into the cache
+// TestTouch_inmemory tests that Touch marks a key as recently used
+func TestTouch_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
 	cache.Put("a1", "1", len1, -1)
 	cache.Put("b1", "2", len1, -1)
+	cache.Touch("a1")
 
-	// Print the current state of the cache
+	// b1 is now the least recently used key, so it is evicted
+	cache.Put("c1", "3", len1, -1)
 	result := cache.Print()
+	expected_result := "c1:3, a1:1"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+}
 
-	expected_result := "b1:2, a1:1"
+// TestIncrBy_inmemory tests the IncrBy method of the inmemory cache
+func TestIncrBy_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
 
-	// Check if the printed result matches the expected result
+	// Increment concurrently, every increment must be counted
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.IncrBy("a1", 2, len1)
+		}()
+	}
+	wg.Wait()
+	if result := cache.Get("a1"); result != "200" {
+		t.Error("Expected value '200', got", result)
+	}
+
+	// Incrementing a non-integer value fails and leaves it unchanged
+	cache.Put("b1", "x", len1, -1)
+	if _, err := cache.IncrBy("b1", 1, len1); err != in_memory.ErrNotInteger {
+		t.Error("Expected ErrNotInteger, got", err)
+	}
+	if result := cache.Get("b1"); result != "x" {
+		t.Error("Expected value 'x', got", result)
+	}
+}
+
+// TestConditional_inmemory tests the conditional write methods of the inmemory cache
+func TestConditional_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
+
+	if cache.SetXX("a1", "1", len1, -1) {
+		t.Error("Expected SetXX to fail for a missing key")
+	}
+	if !cache.SetNX("a1", "1", len1, -1) {
+		t.Error("Expected SetNX to succeed for a missing key")
+	}
+	if cache.SetNX("a1", "2", len1, -1) {
+		t.Error("Expected SetNX to fail for an existing key")
+	}
+	if !cache.SetXX("a1", "2", len1, -1) {
+		t.Error("Expected SetXX to succeed for an existing key")
+	}
+	if old, existed := cache.GetSet("a1", "3", len1, -1); !existed || old != "2" {
+		t.Error("Expected previous value '2', got", old, existed)
+	}
+	if cache.CompareAndSwap("a1", "2", "4", len1, -1) {
+		t.Error("Expected CompareAndSwap to fail for a stale value")
+	}
+	if !cache.CompareAndSwap("a1", "3", "4", len1, -1) {
+		t.Error("Expected CompareAndSwap to succeed for the current value")
+	}
+	if result := cache.Get("a1"); result != "4" {
+		t.Error("Expected value '4', got", result)
+	}
+}
+
+// TestVersion_inmemory tests that versions only move forward in the inmemory cache
+func TestVersion_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
+	cache.PutWithVersion("a1", "1", len1, -1, 10)
+
+	// A mirrored write with an older version is ignored
+	cache.PutWithVersion("a1", "0", len1, -1, 5)
+	value, version := cache.GetWithVersion("a1")
+	if value != "1" || version != 10 {
+		t.Error("Expected value '1' with version 10, got", value, version)
+	}
+
+	// Local writes continue above the highest version seen
+	cache.Put("b1", "2", len1, -1)
+	if _, version := cache.GetWithVersion("b1"); version != 11 {
+		t.Error("Expected version 11, got", version)
+	}
+	if _, stored := cache.CompareVersionAndSwap("b1", 10, "3", len1, -1); stored {
+		t.Error("Expected a stale version to be rejected")
+	}
+	if _, stored := cache.CompareVersionAndSwap("b1", 11, "3", len1, -1); !stored {
+		t.Error("Expected the current version to be accepted")
+	}
+}
+
+// TestBulk_inmemory tests the MGet, MSet and MDel methods of the inmemory cache
+func TestBulk_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
+	cache.MSet([]in_memory.Item{{Key: "a1", Value: "1"}, {Key: "b1", Value: "2"}, {Key: "c1", Value: "3"}}, 3, -1)
+
+	values := cache.MGet([]string{"a1", "v", "c1"})
+	if strings.Join(values, ",") != "1,,3" {
+		t.Error("Expected values 1,,3 got", values)
+	}
+	// MGet marked c1 as the most recently used key
+	result := cache.Print()
+	expected_result := "c1:3, a1:1, b1:2"
 	if result != expected_result {
 		t.Error("Expected", expected_result, "got", result)
 	}
 
-	// Insert another key-value pair to exceed the cache length
-	cache.Put("c1", "3", len1, -1)
-
-	// Print the current state of the cache
+	if deleted := cache.MDel([]string{"a1", "v", "b1"}); deleted != 2 {
+		t.Error("Expected 2 deleted keys, got", deleted)
+	}
 	result = cache.Print()
-	expected_result = "c1:3, b1:2"
-
-	// Check if the printed result matches the expected result
+	expected_result = "c1:3"
 	if result != expected_result {
 		t.Error("Expected", expected_result, "got", result)
 	}
 }
 
-// TestDel_redis tests the Del method of the Redis cache
-func TestDel_redis(t *testing.T) {
-	// Initialize a new Redis cache
-	cache := redis.NewLRUCache()
+// TestTags_inmemory tests tagging, eviction and tag invalidation
+func TestTags_inmemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	opts := in_memory.AOFOptions{Path: path, Fsync: in_memory.FsyncAlways}
+	cache, err := in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put("a1", "1", 3, -1)
+	cache.Put("b1", "2", 3, -1)
+	cache.Put("c1", "3", 3, -1)
+	cache.Tag("a1", "user:1")
+	cache.Tag("b1", "user:1", "views")
+	cache.Tag("c1", "views")
+	if cache.Tag("v", "user:1") {
+		t.Error("Expected tagging a missing key to fail")
+	}
 
-	// Insert a key-value pair into the cache
-	cache.Put("a1", "1", len1, -1)
+	// Evicting a1 removes it from the tag index
+	cache.Put("d1", "4", 3, -1)
+	result := strings.Join(cache.KeysByTag("user:1"), ",")
+	if result != "b1" {
+		t.Error("Expected b1 tagged user:1, got", result)
+	}
 
-	// Delete the key "a1"
-	cache.Del("a1")
+	// Tags survive a restart
+	cache.CloseAOF()
+	cache, err = in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.CloseAOF()
+	if deleted := cache.InvalidateTag("views"); deleted != 2 {
+		t.Error("Expected 2 deleted keys, got", deleted)
+	}
+	result = cache.Print()
+	expected_result := "d1:4"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+	if keys := cache.KeysByTag("user:1"); strings.Join(keys, ",") != "" {
+		t.Error("Expected no keys tagged user:1, got", keys)
+	}
+}
 
-	// Print the current state of the cache
-	result := cache.Print()
-	expected_result := ""
+// TestKeys_inmemory tests glob matching, cursor pagination and DeletePattern
+func TestKeys_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
+	for _, key := range []string{"user:3", "user:1", "user:2", "users", "post:1"} {
+		cache.Put(key, "v", 5, -1)
+	}
 
-	// Check if the printed result matches the expected result
+	// Pages are returned in sorted order until the cursor is empty
+	pages := []string{}
+	keys, cursor := cache.Keys("user:*", "", 2)
+	pages = append(pages, strings.Join(keys, ","))
+	for cursor != "" {
+		keys, cursor = cache.Keys("user:*", cursor, 2)
+		pages = append(pages, strings.Join(keys, ","))
+	}
+	result := strings.Join(pages, "|")
+	expected_result := "user:1,user:2|user:3"
 	if result != expected_result {
 		t.Error("Expected", expected_result, "got", result)
 	}
 
+	// Redis glob syntax
+	for pattern, expected := range map[string]string{
+		"user?":        "users",
+		"user:[12]":    "user:1,user:2",
+		"user:[^1]":    "user:2,user:3",
+		"*:[2-3]":      "user:2,user:3",
+		"post\\:1":     "post:1",
+		"*":            "post:1,user:1,user:2,user:3,users",
+		"nothing*here": "",
+	} {
+		keys, _ := cache.Keys(pattern, "", 0)
+		if result := strings.Join(keys, ","); result != expected {
+			t.Error("Expected", expected, "for pattern", pattern, "got", result)
+		}
+	}
+
+	if deleted := cache.DeletePattern("user:*"); deleted != 3 {
+		t.Error("Expected 3 deleted keys, got", deleted)
+	}
+	result = cache.Print()
+	expected_result = "post:1:v, users:v"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
 }
 
-// TestDelAll_redis tests the Del_All method of the Redis cache
-func TestDelAll_redis(t *testing.T) {
-	// Initialize a new redis  cache
-	cache := redis.NewLRUCache()
-	// Insert a key-value pair into the cache
+// TestEntries_inmemory tests that Entries reports typed entries in recency order
+func TestEntries_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
+	cache.Put("a:1", "x, y", len1, -1)
+	cache.Put("b1", "2", len1, 10)
+
+	entries := []in_memory.Entry{}
+	cache.Entries(0, func(e in_memory.Entry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	if entries[0].Key != "b1" || entries[0].Rank != 0 || entries[0].TTL <= 0 {
+		t.Error("Expected b1 first with a TTL, got", entries[0])
+	}
+	if entries[1].Key != "a:1" || entries[1].Value != "x, y" || entries[1].Rank != 1 || entries[1].TTL != in_memory.NoExpiration {
+		t.Error("Expected a:1 second without a TTL, got", entries[1])
+	}
 
-	cache.Put("a", "1", len1, -1)
-	cache.Put("b", "2", len1, -1)
+	// Returning false stops the iteration
+	visited := 0
+	cache.Entries(0, func(e in_memory.Entry) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Error("Expected 1 visited entry, got", visited)
+	}
 
-	// Delete all key
-	cache.DEL_ALL()
+	// Iteration starts at the offset and continues across batches
+	for i := 0; i < 250; i++ {
+		cache.Put(strconv.Itoa(i), "v", 1000, -1)
+	}
+	ranks := 0
+	cache.Entries(10, func(e in_memory.Entry) bool {
+		if e.Rank != 10+ranks {
+			t.Error("Expected rank", 10+ranks, "got", e.Rank)
+		}
+		ranks++
+		return true
+	})
+	if ranks != 242 {
+		t.Error("Expected 242 entries from offset 10, got", ranks)
+	}
+}
 
-	// Attempt to retrieve the value for the deleted key "a1"
-	result := cache.Get("a1")
-	expected_result := ""
+// TestQuota_inmemory tests byte accounting and quota checks
+func TestQuota_inmemory(t *testing.T) {
+	// Initialize a new inmemory cache
+	cache := in_memory.NewLRUCache(1 * time.Second)
+	cache.Put("a1", "12", 5, -1)
+	cache.Put("b1", "3", 5, -1)
+	cache.Put("a1", "1", 5, -1)
+	if bytes := cache.Bytes(); bytes != 6 {
+		t.Error("Expected 6 bytes, got", bytes)
+	}
 
-	// Check if the result matches the expected result
-	if result != expected_result {
-		t.Error("Expected empty string for deleted key, got", result)
+	quota := in_memory.Quota{MaxEntries: 2, MaxBytes: 8}
+	if err := cache.CheckQuota("c1", "4", quota); err != in_memory.ErrEntriesQuota {
+		t.Error("Expected ErrEntriesQuota, got", err)
+	}
+	// Replacing a key counts the size difference only
+	if err := cache.CheckQuota("a1", "123", quota); err != nil {
+		t.Error("Expected the replacement to fit, got", err)
+	}
+	if err := cache.CheckQuota("a1", "1234", quota); err != in_memory.ErrBytesQuota {
+		t.Error("Expected ErrBytesQuota, got", err)
 	}
 
+	cache.Del("b1")
+	if bytes := cache.Bytes(); bytes != 3 {
+		t.Error("Expected 3 bytes, got", bytes)
+	}
 }
 
-// integration testing
-// testing related to multi_cache folder
-func TestGET(t *testing.T) {
-	// Create a new multi-cache instance
-	cache := multi_cache.NewMultiCache()
-	// Set key-value pairs in the cache
-	cache.Set("a", "1", len1, -1)
-	cache.Set("b", "2", len1, -1)
+// TestTypes_inmemory tests the hash, list and set types of the inmemory cache
+func TestTypes_inmemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	opts := in_memory.AOFOptions{Path: path, Fsync: in_memory.FsyncAlways}
+	cache, err := in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.HSet("h1", map[string]string{"a": "1", "b": "2"}, 5)
+	cache.HDel("h1", "a")
+	cache.LPush("l1", []string{"x", "y", "z"}, 5)
+	cache.SAdd("s1", []string{"m", "n", "m"}, 5)
+	cache.Put("a1", "1", 5, -1)
+
+	// Operations on another type fail without changing the value
+	if _, err := cache.SAdd("h1", []string{"q"}, 5); err != in_memory.ErrWrongType {
+		t.Error("Expected ErrWrongType, got", err)
+	}
+	if _, _, err := cache.HGet("a1", "a"); err != in_memory.ErrWrongType {
+		t.Error("Expected ErrWrongType, got", err)
+	}
+	if cache.Get("h1") != "" {
+		t.Error("Expected Get on a hash to return an empty string")
+	}
 
-	// Test case 1: Get a non-existent key
-	res1 := cache.Get("c")
-	if res1 != "" {
-		t.Error("case 1 error: expected empty string for non-existent key")
+	// Versions assigned by another tier are kept, an older one never replacing a newer one
+	cache.SAddWithVersion("s2", []string{"o"}, 5, 100)
+	cache.SAddWithVersion("s2", []string{"p"}, 5, 90)
+	if info, _ := cache.Inspect("s2"); info.Version != 100 {
+		t.Error("Expected version 100, got", info.Version)
+	}
+	if err := cache.CloseAOF(); err != nil {
+		t.Fatal(err)
 	}
 
-	// Test case 2: Get an existing key
-	res2 := cache.Get("a")
-	if res2 != "1" {
-		t.Error("case 2 error: expected '1' for key 'a'")
+	// The values survive a restart
+	cache, err = in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.CloseAOF()
+	if fields, _ := cache.HGetAll("h1"); !reflect.DeepEqual(fields, map[string]string{"b": "2"}) {
+		t.Error("Expected map[b:2], got", fields)
+	}
+	if items, _ := cache.LRange("l1", 0, -1); strings.Join(items, ",") != "z,y,x" {
+		t.Error("Expected z,y,x, got", items)
+	}
+	if items, _ := cache.LRange("l1", -2, -1); strings.Join(items, ",") != "y,x" {
+		t.Error("Expected y,x, got", items)
+	}
+	if members, _ := cache.SMembers("s1"); strings.Join(members, ",") != "m,n" {
+		t.Error("Expected m,n, got", members)
+	}
+	if kind := cache.Type("l1"); kind != "list" {
+		t.Error("Expected list, got", kind)
+	}
+	if info, _ := cache.Inspect("s2"); info.Version != 100 {
+		t.Error("Expected version 100 after a restart, got", info.Version)
+	}
+
+	// Removing the last field deletes the key
+	cache.HDel("h1", "b")
+	if kind := cache.Type("h1"); kind != "none" {
+		t.Error("Expected none, got", kind)
 	}
 }
 
-// TestPrint tests the Print methods of the multi_cache
-func TestPrint(t *testing.T) {
-	// Create a new multi-cache instance
-	cache := multi_cache.NewMultiCache()
-	// Set key-value pairs in the cache
-	cache.Set("a", "1", len1, -1)
-	cache.Set("b", "2", len1, -1)
+// TestAOF_inmemory tests that the append-only file restores the cache after a restart
+func TestAOF_inmemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	opts := in_memory.AOFOptions{Path: path, Fsync: in_memory.FsyncAlways}
 
-	// Get the printed results from both in-memory and Redis caches
-	inmemory_result := cache.Print_in_mem()
-	redis_result := cache.Print_redis()
-	// Check if the data is the same in both backends
-	if inmemory_result != redis_result {
-		t.Error("data is not the same in both backends")
+	// Write some data and close the file
+	cache, err := in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put("a1", "1", len1, -1)
+	cache.Put("b1", "2", len1, -1)
+	cache.Put("c1", "3", len1, -1)
+	cache.Del("b1")
+	cache.Put("d1", "4", len1, 1)
+	if err := cache.CloseAOF(); err != nil {
+		t.Fatal(err)
 	}
 
-	// Set another key-value pair to exceed the cache capacity
-	cache.Set("c", "3", len1, -1)
-	inmemory_result = cache.Print_in_mem()
-	redis_result = cache.Print_redis()
+	// Simulate a crash in the middle of a write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"put","key":"e1"`)
+	f.Close()
+
+	// Wait for d1 to expire before replaying
+	time.Sleep(1100 * time.Millisecond)
+	cache, err = in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.CloseAOF()
 
-	// Check if the data is the same in both backends
-	if inmemory_result != redis_result {
-		t.Error("data is not the same in both backends")
+	result := cache.Print()
+	expected_result := "c1:3"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+
+	// Values that are not valid UTF-8 survive snapshots byte for byte
+	cache.Put("b1", "\xff\xfe", len1, -1)
+	cache.HSet("h1", map[string]string{"f": "\x80"}, len1)
+	snapshot := filepath.Join(t.TempDir(), "cache.snapshot")
+	if err := cache.Snapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	restored := in_memory.NewLRUCache(1 * time.Second)
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if value := restored.Get("b1"); value != "\xff\xfe" {
+		t.Errorf("Expected %q got %q", "\xff\xfe", value)
+	}
+	if value, _, _ := restored.HGet("h1", "f"); value != "\x80" {
+		t.Errorf("Expected %q got %q", "\x80", value)
 	}
 
+	// Records written before values were base64-encoded are still read
+	legacy := filepath.Join(t.TempDir(), "legacy.aof")
+	os.WriteFile(legacy, []byte(`{"op":"put","key":"a1","value":"1","length":2}`+"\n"+
+		`{"op":"lpush","key":"l1","length":2,"members":["x","y"]}`+"\n"), 0o644)
+	restored = in_memory.NewLRUCache(1 * time.Second)
+	if err := restored.Restore(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := restored.LRange("l1", 0, -1); restored.Get("a1") != "1" || !reflect.DeepEqual(items, []string{"y", "x"}) {
+		t.Error("Expected a1:1 and l1:[y x] got", restored.Get("a1"), items)
+	}
 }
 
-// TestDel tests the Del method of the cache
-func TestDel(t *testing.T) {
-	// Create a new multi-cache instance
-	cache := multi_cache.NewMultiCache()
-	// Set key-value pairs in the cache
-	cache.Set("a", "1", len1, -1)
-	cache.Set("b", "2", len1, -1)
+// TestAOFVersions_inmemory tests that a write older than the stored value is neither counted nor replayed
+func TestAOFVersions_inmemory(t *testing.T) {
+	opts := in_memory.AOFOptions{Path: filepath.Join(t.TempDir(), "cache.aof"), Fsync: in_memory.FsyncAlways}
+	cache, err := in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.PutWithVersion("a1", "new", len1, -1, 5)
+	if version := cache.PutWithVersion("a1", "old", len1, -1, 3); version != 5 {
+		t.Error("Expected version 5 got", version)
+	}
+	if sets := cache.Stats().Sets; sets != 1 {
+		t.Error("Expected 1 set got", sets)
+	}
+	if err := cache.CloseAOF(); err != nil {
+		t.Fatal(err)
+	}
 
-	// Delete a key from the cache
-	cache.Del("a")
-	// Check if the deleted key returns an empty string
-	result := cache.Get("a")
-	if result != "" {
-		t.Error("expected empty string for deleted key 'a'")
+	cache, err = in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
 	}
-	// Check if an existing key returns the correct value
-	result = cache.Get("b")
-	if result != "2" {
-		t.Error("expected '2' for key 'b'")
+	defer cache.CloseAOF()
+	if value := cache.Get("a1"); value != "new" {
+		t.Error("Expected new got", value)
+	}
+}
+
+// TestAOFError_inmemory tests that a file that cannot be replayed leaves no cleanup goroutine behind
+func TestAOFError_inmemory(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	if _, err := in_memory.NewLRUCacheWithAOF(1*time.Second, in_memory.AOFOptions{Path: t.TempDir()}); err == nil {
+		t.Fatal("expected an error replaying a directory")
+	}
+	time.Sleep(10 * time.Millisecond) // Let the stopped goroutine return
+	if n := runtime.NumGoroutine(); n != goroutines {
+		t.Error("expected", goroutines, "goroutines got", n)
+	}
+}
+
+// TestAOFRewrite_inmemory tests that compaction keeps the cache contents intact
+func TestAOFRewrite_inmemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	opts := in_memory.AOFOptions{Path: path, Fsync: in_memory.FsyncNo, RewriteSize: 512}
+
+	cache, err := in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Overwrite the same keys in bursts so the file is rewritten several times
+	for i := 0; i < 200; i++ {
+		cache.Put("a1", strconv.Itoa(i), len1, -1)
+		cache.Put("b1", strconv.Itoa(i), len1, -1)
+		if i%10 == 9 {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if err := cache.CloseAOF(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= 2048 {
+		t.Error("expected the append-only file to be compacted, size is", info.Size())
+	}
+
+	cache, err = in_memory.NewLRUCacheWithAOF(1*time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.CloseAOF()
+	result := cache.Print()
+	expected_result := "b1:199, a1:199"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+}
+
+// TestResize_inmemory tests that shrinking the cache evicts the least recently used entries, also on replay
+func TestResize_inmemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	cache, err := in_memory.NewLRUCacheWithAOF(1*time.Second, in_memory.AOFOptions{Path: path, Fsync: in_memory.FsyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put("a1", "1", 3, -1)
+	cache.Put("b1", "2", 3, -1)
+	cache.Put("c1", "3", 3, -1)
+	if evicted := cache.Resize(1); evicted != 2 {
+		t.Error("expected 2 evictions got", evicted)
+	}
+	if result := cache.Print(); result != "c1:3" {
+		t.Error("Expected c1:3 got", result)
+	}
+	cache.Close()
+
+	cache, err = in_memory.NewLRUCacheWithAOF(1*time.Second, in_memory.AOFOptions{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if result := cache.Print(); result != "c1:3" {
+		t.Error("Expected c1:3 after replay got", result)
+	}
+}
+
+// TestCleanupInterval_inmemory tests changing the cleanup interval without starting another goroutine
+func TestCleanupInterval_inmemory(t *testing.T) {
+	cache := in_memory.NewLRUCache(1 * time.Hour)
+	defer cache.Close()
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		cache.SetCleanupInterval(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n != goroutines {
+		t.Error("expected", goroutines, "goroutines got", n)
+	}
+	if d := cache.CleanupInterval(); d != 10*time.Millisecond {
+		t.Error("expected 10ms got", d)
+	}
+
+	// Expired entries are removed at the new interval, without being accessed
+	cache.Put("a1", "1", len1, 1)
+	time.Sleep(1100 * time.Millisecond)
+	if n := cache.Len(); n != 0 {
+		t.Error("expected the expired entry to be removed, got", n, "entries")
+	}
+}
+
+// disk
+// TestPutGet_disk tests the Put and Get methods of the disk cache
+func TestPutGet_disk(t *testing.T) {
+	cache, err := disk.NewLRUCache(t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	// Insert key-value pairs into the cache
+	cache.Put("a1", "1", len1, -1)
+	cache.Put("b1", "2", len1, -1)
+	cache.Get("a1")
+
+	// Insert another key-value pair to exceed the cache length
+	cache.Put("c1", "3", len1, -1)
+
+	result := cache.Print()
+	expected_result := "c1:3, a1:1"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+	if result := cache.Get("b1"); result != "" {
+		t.Error("Expected empty string for evicted key, got", result)
+	}
+	if !cache.Has("a1") || cache.Has("b1") {
+		t.Error("Expected only key a1 of the two to be present")
+	}
+
+	// Writes carrying a version older than the stored one are ignored
+	cache.PutWithVersion("a1", "new", len1, -1, 5)
+	cache.PutWithVersion("a1", "old", len1, -1, 4)
+	if result := cache.Get("a1"); result != "new" {
+		t.Error("Expected 'new' after an older write, got", result)
+	}
+
+	// Stats count every operation, expirations and evictions by reason
+	cache.Del("a1")
+	cache.Put("d1", "4", len1, -1)
+	cache.Expire("c1", time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	cache.Get("c1")
+	cache.Resize(0)
+	expected := disk.Stats{Hits: 2, Misses: 2, Sets: 5, Deletes: 1, Expirations: 1,
+		Evictions: map[string]uint64{disk.EvictCapacity: 1, disk.EvictResize: 1}}
+	if stats := cache.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Error("Expected", expected, "got", stats)
+	}
+}
+
+// TestBudget_disk tests that the disk cache stays within its byte budget
+func TestBudget_disk(t *testing.T) {
+	cache, err := disk.NewLRUCache(t.TempDir(), 200, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	// Each entry takes roughly 80 bytes on disk, so only two fit
+	value := strings.Repeat("x", 50)
+	cache.Put("a1", value, 10, -1)
+	cache.Put("b1", value, 10, -1)
+	cache.Put("c1", value, 10, -1)
+
+	if result := cache.Get("a1"); result != "" {
+		t.Error("Expected least recently used key to be evicted, got", result)
+	}
+	if result := cache.Get("c1"); result != value {
+		t.Error("Expected", value, "got", result)
+	}
+
+	// The budget applies down to the last entry, whose header grows with an expiration
+	single, err := disk.NewLRUCache(t.TempDir(), 100, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.Close()
+	single.Put("a1", value, 10, -1)
+	single.Expire("a1", time.Hour)
+	if result := single.Get("a1"); result != "" {
+		t.Error("Expected the only key to be evicted over the budget, got", result)
+	}
+}
+
+// TestRecovery_disk tests that entries survive a crash before the index is flushed
+func TestRecovery_disk(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := disk.NewLRUCache(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put("a1", "1", len1, -1)
+	cache.Close()
+	if err := cache.Close(); err != nil { // Closing twice is harmless
+		t.Fatal(err)
+	}
+
+	// Reopen and write without closing, as if the process crashed
+	cache, err = disk.NewLRUCache(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond) // Make sure the new file has a later modification time
+	cache.Put("b1", "2", len1, -1)
+
+	recovered, err := disk.NewLRUCache(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	result := recovered.Print()
+	expected_result := "b1:2, a1:1"
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+}
+
+// jsondoc
+// TestJSONDoc tests the JSON document helpers against tables of documents and their expected results
+func TestJSONDoc(t *testing.T) {
+	compact := []struct {
+		value, expected string
+		err             error
+	}{
+		{` { "a" : [1, 2] } `, `{"a":[1,2]}`, nil},
+		{`"text"`, `"text"`, nil},
+		{`{"a":`, "", jsondoc.ErrInvalidJSON},
+		{`{} {}`, "", jsondoc.ErrInvalidJSON},
+		{``, "", jsondoc.ErrInvalidJSON},
+	}
+	for _, test := range compact {
+		if result, err := jsondoc.Compact(test.value); result != test.expected || err != test.err {
+			t.Errorf("Compact(%s): expected %q, %v got %q, %v", test.value, test.expected, test.err, result, err)
+		}
+	}
+
+	doc := `{"user": {"name": "a", "tags": ["x", "y"]}, "a.b": 1.50}`
+	query := []struct {
+		doc, path, expected string
+		err                 error
+	}{
+		{doc, "$", `{"a.b":1.50,"user":{"name":"a","tags":["x","y"]}}`, nil},
+		{doc, "$.user.name", `"a"`, nil},
+		{doc, "$['user']['tags'][1]", `"y"`, nil},
+		{doc, "$.user.tags[-2]", `"x"`, nil},
+		{doc, `$["a.b"]`, `1.50`, nil},
+		{doc, "$.user.age", "", jsondoc.ErrPathNotFound},
+		{doc, "$.user.tags[2]", "", jsondoc.ErrPathNotFound},
+		{doc, "$.user[0]", "", jsondoc.ErrPathNotFound},
+		{doc, "$.user.name.first", "", jsondoc.ErrPathNotFound},
+		{doc, "user", "", jsondoc.ErrInvalidPath},
+		{doc, "$..user", "", jsondoc.ErrInvalidPath},
+		{doc, "$[x]", "", jsondoc.ErrInvalidPath},
+		{"{nope", "$", "", jsondoc.ErrInvalidJSON},
+	}
+	for _, test := range query {
+		if result, err := jsondoc.Query(test.doc, test.path); result != test.expected || err != test.err {
+			t.Errorf("Query(%s): expected %q, %v got %q, %v", test.path, test.expected, test.err, result, err)
+		}
+	}
+
+	mergePatch := []struct {
+		doc, patch, expected string
+		err                  error
+	}{
+		{`{"a":1,"b":{"c":2,"d":3}}`, `{"b":{"c":null,"e":4}}`, `{"a":1,"b":{"d":3,"e":4}}`, nil},
+		{`{"a":1}`, `{"a":null}`, `{}`, nil},
+		{`{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`, nil},
+		{`{"a":1}`, `[1]`, `[1]`, nil},
+		{`[1]`, `{"a":{"b":null}}`, `{"a":{}}`, nil},
+		{`{"a":1}`, `{"a":`, "", jsondoc.ErrInvalidPatch},
+		{`{"a":`, `{}`, "", jsondoc.ErrInvalidJSON},
+	}
+	for _, test := range mergePatch {
+		if result, err := jsondoc.MergePatch(test.doc, test.patch); result != test.expected || !errors.Is(err, test.err) {
+			t.Errorf("MergePatch(%s, %s): expected %q, %v got %q, %v", test.doc, test.patch, test.expected, test.err, result, err)
+		}
+	}
+
+	patch := []struct {
+		doc, patch, expected string
+		err                  error
+	}{
+		{`{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2},{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1,2]}`, nil},
+		{`{"a":1,"b":2}`, `[{"op":"remove","path":"/a"},{"op":"replace","path":"/b","value":null}]`, `{"b":null}`, nil},
+		{`{"a":{"b":1}}`, `[{"op":"move","from":"/a/b","path":"/c"},{"op":"copy","from":"/c","path":"/d"}]`, `{"a":{},"c":1,"d":1}`, nil},
+		{`{"a~b":{"c/d":1}}`, `[{"op":"test","path":"/a~0b/c~1d","value":1}]`, `{"a~b":{"c/d":1}}`, nil},
+		{`{"a":1}`, `[{"op":"remove","path":"/a"},{"op":"test","path":"/a","value":1}]`, "", jsondoc.ErrPathNotFound},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, "", jsondoc.ErrTestFailed},
+		{`{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", jsondoc.ErrPathNotFound},
+		{`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, "", jsondoc.ErrInvalidPatch},
+		{`{"a":1}`, `[{"op":"add","path":"/b"}]`, "", jsondoc.ErrInvalidPatch},
+		{`{"a":1}`, `[{"op":"inc","path":"/a"}]`, "", jsondoc.ErrInvalidPatch},
+		{`{"a":1}`, `{"op":"add"}`, "", jsondoc.ErrInvalidPatch},
+		{`{"a":`, `[]`, "", jsondoc.ErrInvalidJSON},
+	}
+	for _, test := range patch {
+		if result, err := jsondoc.Patch(test.doc, test.patch); result != test.expected || !errors.Is(err, test.err) {
+			t.Errorf("Patch(%s, %s): expected %q, %v got %q, %v", test.doc, test.patch, test.expected, test.err, result, err)
+		}
+	}
+}
+
+// redis
+// TestPut_redis tests the Put method of the Redis cache
+func TestPut_redis(t *testing.T) {
+	// Initialize a new Redis cache
+	cache := redis.NewLRUCache()
+
+	// Insert key-value pairs into the cache
+	cache.Put(ctx, "a1", "1", len1, -1)
+	cache.Put(ctx, "b1", "2", len1, -1)
+
+	// Retrieve the value for key "a1"
+	result := cache.Get(ctx, "a1")
+
+	// Check if the value is as expected
+	if result != "1" {
+		t.Error("Expected value '1', got", result)
+	}
+}
+
+// TestGet_redis tests the Get method of the Redis cache
+func TestGet_redis(t *testing.T) {
+	// Initialize a new Redis cache
+	cache := redis.NewLRUCache()
+
+	// Insert key-value pairs into the cache
+	cache.Put(ctx, "a1", "1", len1, -1)
+	cache.Put(ctx, "b1", "2", len1, -1)
+
+	// Retrieve the value for key "a1"
+	result := cache.Get(ctx, "a1")
+	if result != "1" {
+		t.Error("Expected value '1', got", result)
+	}
+
+	// Attempt to retrieve a value for a non-existent key "v"
+	result = cache.Get(ctx, "v")
+	if result != "" {
+		t.Error("Expected empty string for non-existent key, got", result)
+	}
+}
+
+// TestPrint_redis tests the Print method of the Redis cache
+func TestPrint_redis(t *testing.T) {
+	// Initialize a new Redis cache
+	cache := redis.NewLRUCache()
+
+	// Insert key-value pairs into the cache
+	cache.Put(ctx, "a1", "1", len1, -1)
+	cache.Put(ctx, "b1", "2", len1, -1)
+
+	// Print the current state of the cache
+	result := cache.Print(ctx)
+
+	expected_result := "b1:2, a1:1"
+
+	// Check if the printed result matches the expected result
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+
+	// Insert another key-value pair to exceed the cache length
+	cache.Put(ctx, "c1", "3", len1, -1)
+
+	// Print the current state of the cache
+	result = cache.Print(ctx)
+	expected_result = "c1:3, b1:2"
+
+	// Check if the printed result matches the expected result
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+}
+
+// TestDel_redis tests the Del method of the Redis cache
+func TestDel_redis(t *testing.T) {
+	// Initialize a new Redis cache
+	cache := redis.NewLRUCache()
+
+	// Insert a key-value pair into the cache
+	cache.Put(ctx, "a1", "1", len1, -1)
+
+	// Delete the key "a1"
+	cache.Del(ctx, "a1")
+
+	// Print the current state of the cache
+	result := cache.Print(ctx)
+	expected_result := ""
+
+	// Check if the printed result matches the expected result
+	if result != expected_result {
+		t.Error("Expected", expected_result, "got", result)
+	}
+
+}
+
+// TestDelAll_redis tests the Del_All method of the Redis cache
+func TestDelAll_redis(t *testing.T) {
+	// Initialize a new redis  cache
+	cache := redis.NewLRUCache()
+	// Insert a key-value pair into the cache
+
+	cache.Put(ctx, "a", "1", len1, -1)
+	cache.Put(ctx, "b", "2", len1, -1)
+
+	// Delete all key
+	cache.DEL_ALL(ctx)
+
+	// Attempt to retrieve the value for the deleted key "a1"
+	result := cache.Get(ctx, "a1")
+	expected_result := ""
+
+	// Check if the result matches the expected result
+	if result != expected_result {
+		t.Error("Expected empty string for deleted key, got", result)
+	}
+
+}
+
+// integration testing
+// testing related to multi_cache folder
+func TestGET(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	// Set key-value pairs in the cache
+	cache.Set(ctx, "a", "1", len1, -1)
+	cache.Set(ctx, "b", "2", len1, -1)
+
+	// Test case 1: Get a non-existent key
+	res1 := cache.Get(ctx, "c")
+	if res1 != "" {
+		t.Error("case 1 error: expected empty string for non-existent key")
+	}
+
+	// Test case 2: Get an existing key
+	res2 := cache.Get(ctx, "a")
+	if res2 != "1" {
+		t.Error("case 2 error: expected '1' for key 'a'")
+	}
+}
+
+// TestPrint tests the Print methods of the multi_cache
+func TestPrint(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	// Set key-value pairs in the cache
+	cache.Set(ctx, "a", "1", len1, -1)
+	cache.Set(ctx, "b", "2", len1, -1)
+
+	// Get the printed results from both in-memory and Redis caches
+	inmemory_result := cache.Print_in_mem()
+	redis_result := cache.Print_redis(ctx)
+	// Check if the data is the same in both backends
+	if inmemory_result != redis_result {
+		t.Error("data is not the same in both backends")
+	}
+
+	// Set another key-value pair to exceed the cache capacity
+	cache.Set(ctx, "c", "3", len1, -1)
+	inmemory_result = cache.Print_in_mem()
+	redis_result = cache.Print_redis(ctx)
+
+	// Check if the data is the same in both backends
+	if inmemory_result != redis_result {
+		t.Error("data is not the same in both backends")
+	}
+
+}
+
+// TestDel tests the Del method of the cache
+func TestDel(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	// Set key-value pairs in the cache
+	cache.Set(ctx, "a", "1", len1, -1)
+	cache.Set(ctx, "b", "2", len1, -1)
+
+	// Delete a key from the cache
+	cache.Del(ctx, "a")
+	// Check if the deleted key returns an empty string
+	result := cache.Get(ctx, "a")
+	if result != "" {
+		t.Error("expected empty string for deleted key 'a'")
+	}
+	// Check if an existing key returns the correct value
+	result = cache.Get(ctx, "b")
+	if result != "2" {
+		t.Error("expected '2' for key 'b'")
+	}
+}
+
+// TestInspect tests the Peek and Inspect methods of the multi_cache
+func TestInspect(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Set(ctx, "a", "1", len1, -1)
+
+	if result := cache.Peek(ctx, "a"); result != "1" {
+		t.Error("expected '1' for key 'a', got", result)
+	}
+	info, found := cache.Inspect(ctx, "a")
+	if !found {
+		t.Fatal("expected key 'a' to be found")
+	}
+	if strings.Join(info.Tiers, ",") != "inmemory,redis" {
+		t.Error("expected key 'a' in both tiers, got", info.Tiers)
+	}
+	if _, found := cache.Inspect(ctx, "missing"); found {
+		t.Error("expected non-existent key not to be found")
+	}
+}
+
+// TestExpire tests that TTL changes are applied to every tier of the multi_cache
+func TestExpire(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Set(ctx, "a", "1", len1, -1)
+
+	if !cache.Expire(ctx, "a", time.Minute) {
+		t.Fatal("expected key 'a' to be found")
+	}
+	redis_cache := redis.NewLRUCache()
+	if ttl := redis_cache.TTL(ctx, "a"); ttl <= 0 || ttl > time.Minute {
+		t.Error("expected Redis TTL within a minute, got", ttl)
+	}
+	if !cache.Persist(ctx, "a") {
+		t.Fatal("expected key 'a' to be found")
+	}
+	if ttl := cache.TTL(ctx, "a"); ttl != -1 {
+		t.Error("expected no expiration, got", ttl)
+	}
+	if ttl := redis_cache.TTL(ctx, "a"); ttl != -1 {
+		t.Error("expected no expiration in Redis, got", ttl)
+	}
+	if ttl := cache.TTL(ctx, "missing"); ttl != -2 {
+		t.Error("expected key not found, got", ttl)
+	}
+}
+
+// TestIncrBy tests that counters stay consistent across both tiers of the multi_cache
+func TestIncrBy(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Del(ctx, "counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Incr(ctx, "counter", len1)
+		}()
+	}
+	wg.Wait()
+	value, err := cache.IncrBy(ctx, "counter", -10, len1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 40 {
+		t.Error("expected 40, got", value)
+	}
+	// Get only returns a value when both tiers agree
+	if result := cache.Get(ctx, "counter"); result != "40" {
+		t.Error("expected '40' for key 'counter', got", result)
+	}
+
+	// A counter that Redis expires keeps its expiration when mirrored into memory
+	cache.Del(ctx, "counter")
+	redis.NewLRUCache().Put(ctx, "counter", "1", len1, 60)
+	cache.Incr(ctx, "counter", len1)
+	if info, _ := cache.Inspect(ctx, "counter"); info.TTL <= 0 || !strings.Contains(strings.Join(info.Tiers, ","), "inmemory") {
+		t.Error("expected key 'counter' in memory with a TTL, got", info)
+	}
+
+	cache.Set(ctx, "a", "x", len1, -1)
+	if _, err := cache.Incr(ctx, "a", len1); err == nil {
+		t.Error("expected an error when incrementing a non-integer value")
+	}
+}
+
+// TestSetNX tests that only one concurrent SetNX wins across the multi_cache
+func TestSetNX(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Del(ctx, "leader")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, stored, _ := cache.SetNX(ctx, "leader", strconv.Itoa(i), len1, -1); stored {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if winners != 1 {
+		t.Error("expected exactly one winner, got", winners)
+	}
+	// Both tiers hold the winning value
+	if result := cache.Get(ctx, "leader"); result == "" {
+		t.Error("expected the tiers to agree on the leader")
+	}
+
+	old := cache.Get(ctx, "leader")
+	if _, swapped, _ := cache.CompareAndSwap(ctx, "leader", "stale", "x", len1, -1); swapped {
+		t.Error("expected CompareAndSwap to fail for a stale value")
+	}
+	if _, swapped, _ := cache.CompareAndSwap(ctx, "leader", old, "x", len1, -1); !swapped {
+		t.Error("expected CompareAndSwap to succeed for the current value")
+	}
+	if previous, _, existed, _ := cache.GetSet(ctx, "leader", "y", len1, -1); !existed || previous != "x" {
+		t.Error("expected previous value 'x', got", previous, existed)
+	}
+	if result := cache.Get(ctx, "leader"); result != "y" {
+		t.Error("expected 'y' for key 'leader', got", result)
+	}
+}
+
+// TestVersions tests that both tiers agree on versions and that stale versions are rejected
+func TestVersions(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	v1, _ := cache.Set(ctx, "a", "1", len1, -1)
+	v2, _ := cache.Set(ctx, "a", "2", len1, -1)
+	if v2 <= v1 {
+		t.Error("expected versions to increase, got", v1, v2)
+	}
+	value, version := cache.GetWithVersion(ctx, "a")
+	if value != "2" || version != v2 {
+		t.Error("expected '2' with version", v2, "got", value, version)
+	}
+	info, _ := cache.Inspect(ctx, "a")
+	if info.Version != v2 {
+		t.Error("expected in-memory version", v2, "got", info.Version)
+	}
+
+	// A writer holding the old version loses
+	if _, stored, _ := cache.CompareVersionAndSwap(ctx, "a", v1, "3", len1, -1); stored {
+		t.Error("expected a stale version to be rejected")
+	}
+	v3, stored, _ := cache.CompareVersionAndSwap(ctx, "a", v2, "3", len1, -1)
+	if !stored || v3 <= v2 {
+		t.Error("expected the current version to be accepted, got", v3, stored)
+	}
+	if result := cache.Get(ctx, "a"); result != "3" {
+		t.Error("expected '3' for key 'a', got", result)
+	}
+
+	// Versions keep increasing across a flush, so old ETags never match again
+	cache.Del_ALL(ctx)
+	if v4, _ := cache.Set(ctx, "a", "4", len1, -1); v4 <= v3 {
+		t.Error("expected versions to increase across Del_ALL, got", v3, v4)
+	}
+}
+
+// TestBulk tests the MGet, MSet and MDel methods of the multi_cache
+func TestBulk(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	versions, _ := cache.MSet(ctx, []multi_cache.Item{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}, len1, -1)
+	if versions[1] <= versions[0] {
+		t.Error("expected increasing versions, got", versions)
+	}
+
+	// Both tiers agree on the values
+	values := cache.MGet(ctx, []string{"a", "missing", "b"})
+	if strings.Join(values, ",") != "1,,2" {
+		t.Error("expected values 1,,2 got", values)
+	}
+	if cache.Print_in_mem() != cache.Print_redis(ctx) {
+		t.Error("data is not the same in both backends")
+	}
+
+	if deleted := cache.MDel(ctx, []string{"a", "missing"}); deleted != 1 {
+		t.Error("expected 1 deleted key, got", deleted)
+	}
+	if result := cache.Get(ctx, "a"); result != "" {
+		t.Error("expected empty string for deleted key 'a'")
+	}
+}
+
+// TestDiskTier tests that the multi_cache falls back to the disk tier
+func TestDiskTier(t *testing.T) {
+	// Create a new multi-cache instance with a disk tier larger than the other tiers
+	cache, err := multi_cache.NewMultiCacheWithDisk(t.TempDir(), 10, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	cache.Set(ctx, "a", "1", len1, -1)
+	cache.Set(ctx, "b", "2", len1, -1)
+	cache.Set(ctx, "c", "3", len1, -1)
+
+	// "a" was evicted from Redis and memory but is still on disk
+	result := cache.Get(ctx, "a")
+	if result != "1" {
+		t.Error("expected '1' for key 'a' from the disk tier, got", result)
+	}
+	// The disk hit is promoted back into Redis and memory
+	if info, _ := cache.Inspect(ctx, "a"); strings.Join(info.Tiers, ",") != "inmemory,redis,disk" {
+		t.Error("expected key 'a' in every tier after the disk hit, got", info.Tiers)
+	}
+
+	cache.Del(ctx, "a")
+	result = cache.Get(ctx, "a")
+	if result != "" {
+		t.Error("expected empty string for deleted key 'a'")
+	}
+
+	// Resizing caps the disk tier too, for later writes as well
+	cache.Resize(ctx, 1)
+	if info, _ := cache.Inspect(ctx, "b"); strings.Join(info.Tiers, ",") != "" {
+		t.Error("expected key 'b' to be evicted from every tier, got", info.Tiers)
+	}
+	cache.Set(ctx, "d", "4", 1, -1)
+	if info, _ := cache.Inspect(ctx, "c"); strings.Join(info.Tiers, ",") != "" {
+		t.Error("expected key 'c' to be evicted from every tier, got", info.Tiers)
+	}
+}
+
+// TestTags tests that invalidating a tag removes the keys from both tiers
+func TestTags(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Set(ctx, "a", "1", len1, -1, "user:1")
+	cache.Set(ctx, "b", "2", len1, -1, "user:1", "user:2")
+	if !cache.Tag(ctx, "b", "views") {
+		t.Error("expected tagging key 'b' to succeed")
+	}
+	result := strings.Join(cache.KeysByTag(ctx, "user:1"), ",")
+	if result != "a,b" {
+		t.Error("expected a,b tagged user:1, got", result)
+	}
+
+	// Evicting "a" removes it from the tag index
+	cache.Set(ctx, "c", "3", len1, -1)
+	result = strings.Join(cache.KeysByTag(ctx, "user:1"), ",")
+	if result != "b" {
+		t.Error("expected b tagged user:1, got", result)
+	}
+
+	if deleted := cache.InvalidateTag(ctx, "user:2"); deleted != 1 {
+		t.Error("expected 1 deleted key, got", deleted)
+	}
+	if cache.Get(ctx, "b") != "" {
+		t.Error("expected empty string for invalidated key 'b'")
+	}
+	if cache.Print_in_mem() != cache.Print_redis(ctx) {
+		t.Error("data is not the same in both backends")
+	}
+	if keys := cache.KeysByTag(ctx, "views"); strings.Join(keys, ",") != "" {
+		t.Error("expected no keys tagged views, got", keys)
+	}
+}
+
+// TestKeys tests listing keys page by page and deleting them by pattern from both tiers
+func TestKeys(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Del_ALL(ctx)
+	cache.Set(ctx, "user:1", "a", len1, -1, "keys")
+	cache.Set(ctx, "user:2", "b", len1, -1)
+
+	// Walk every page; internal keys such as the list and the tag index are never listed
+	found := []string{}
+	keys, cursor := cache.Keys(ctx, "*", 0, 1)
+	found = append(found, keys...)
+	for cursor != 0 {
+		keys, cursor = cache.Keys(ctx, "*", cursor, 1)
+		found = append(found, keys...)
+	}
+	sort.Strings(found)
+	if result := strings.Join(found, ","); result != "user:1,user:2" {
+		t.Error("expected user:1,user:2 got", result)
+	}
+
+	if deleted := cache.DeletePattern(ctx, "user:[1]"); deleted != 1 {
+		t.Error("expected 1 deleted key, got", deleted)
+	}
+	if cache.Get(ctx, "user:1") != "" || cache.Get(ctx, "user:2") != "b" {
+		t.Error("expected only user:1 to be deleted")
+	}
+	if cache.Print_in_mem() != cache.Print_redis(ctx) {
+		t.Error("data is not the same in both backends")
+	}
+
+	// A key named like the cache's own bookkeeping is an ordinary key
+	cache.Set(ctx, "cache", "c", len1, -1)
+	if keys, _ := cache.Keys(ctx, "cache*", 0, 0); strings.Join(keys, ",") != "cache" || cache.Get(ctx, "cache") != "c" {
+		t.Error("expected key 'cache' to be listed and read, got", keys)
+	}
+}
+
+// TestEntries tests that both tiers report the same entries in the same order
+func TestEntries(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Set(ctx, "a:1", "x, y", len1, -1)
+	cache.Set(ctx, "b", "2", len1, 10)
+
+	collect := func(entries func(int, func(multi_cache.Entry) bool)) string {
+		result := []string{}
+		entries(0, func(e multi_cache.Entry) bool {
+			result = append(result, strconv.Itoa(e.Rank)+"="+e.Key+"="+e.Value)
+			return true
+		})
+		return strings.Join(result, "|")
+	}
+	expected_result := "0=b=2|1=a:1=x, y"
+	if result := collect(func(offset int, fn func(multi_cache.Entry) bool) { cache.RedisEntries(ctx, offset, fn) }); result != expected_result {
+		t.Error("expected", expected_result, "got", result)
+	}
+	if result := collect(cache.InMemoryEntries); result != expected_result {
+		t.Error("expected", expected_result, "got", result)
+	}
+}
+
+// TestNamespaces tests that namespaces have their own keys and capacity
+func TestNamespaces(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Del_ALL(ctx)
+	small, err := cache.CreateNamespace(ctx, "small", multi_cache.NamespaceOptions{Capacity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.CreateNamespace(ctx, "small", multi_cache.NamespaceOptions{Capacity: 1}); err != multi_cache.ErrNamespaceExists {
+		t.Error("expected ErrNamespaceExists, got", err)
+	}
+	if _, err := cache.CreateNamespace(ctx, "bad*name", multi_cache.NamespaceOptions{Capacity: 1}); err != multi_cache.ErrInvalidNamespace {
+		t.Error("expected ErrInvalidNamespace, got", err)
+	}
+
+	// Filling the namespace evicts only its own entries, whatever length the writes are given
+	cache.Set(ctx, "a", "root", len1, -1)
+	small.Set(ctx, "a", "small", 10, -1)
+	small.Set(ctx, "b", "small", 10, -1)
+	if cache.Get(ctx, "a") != "root" {
+		t.Error("expected the root key 'a' to survive evictions in the namespace")
+	}
+	if small.Get(ctx, "a") != "" || small.Get(ctx, "b") != "small" {
+		t.Error("expected only key 'b' in the namespace")
+	}
+	info := small.Info(ctx)
+	if info.Entries != 1 || info.Evictions != 1 || info.InMemoryEvictions != 1 {
+		t.Error("expected 1 entry and 1 eviction in each tier, got", info)
+	}
+
+	// Root keys that look like namespaced keys are ordinary keys
+	cache.Set(ctx, "ns:small:b", "root", len1, -1)
+	if small.Get(ctx, "b") != "small" {
+		t.Error("expected the root key 'ns:small:b' not to change key 'b' in the namespace")
+	}
+	keys, _ := cache.Keys(ctx, "*", 0, 0)
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,ns:small:b" {
+		t.Error("expected only the root keys 'a' and 'ns:small:b' to be listed, got", keys)
+	}
+
+	// Another replica creating the same namespace keeps its entries
+	replica := multi_cache.NewMultiCache()
+	if _, err := replica.CreateNamespace(ctx, "small", multi_cache.NamespaceOptions{Capacity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if small.Get(ctx, "b") != "small" {
+		t.Error("expected key 'b' to survive the namespace being created on another replica")
+	}
+
+	// Resizing the cache caps the namespaces whose capacity is larger
+	large, err := cache.CreateNamespace(ctx, "large", multi_cache.NamespaceOptions{Capacity: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.DropNamespace(ctx, "large")
+	large.Set(ctx, "a", "1", 10, -1)
+	large.Set(ctx, "b", "2", 10, -1)
+	large.Set(ctx, "c", "3", 10, -1)
+	cache.Resize(ctx, 2)
+	if info := large.Info(ctx); info.Capacity != 2 || info.Entries != 2 || large.Get(ctx, "a") != "" {
+		t.Error("expected the capacity and entries of namespace 'large' to be 2, got", info)
+	}
+	if info := small.Info(ctx); info.Capacity != 1 {
+		t.Error("expected the capacity of namespace 'small' to stay 1, got", info.Capacity)
+	}
+
+	// Dropping the namespace removes its entries from Redis
+	if !cache.DropNamespace(ctx, "small") {
+		t.Error("expected namespace 'small' to be dropped")
+	}
+	if redis.NewLRUCache().Namespace("small").Peek(ctx, "b") != "" {
+		t.Error("expected key 'b' to be deleted from Redis")
+	}
+	if cache.DropNamespace(ctx, "small") {
+		t.Error("expected namespace 'small' to be gone")
+	}
+}
+
+// TestQuotas tests that namespace writes beyond the quota are rejected
+func TestQuotas(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	ns, err := cache.CreateNamespace(ctx, "quota", multi_cache.NamespaceOptions{
+		Capacity: 10,
+		Quota:    multi_cache.Quota{MaxEntries: 2, MaxWritesPerSecond: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.DropNamespace(ctx, "quota")
+
+	ns.Put(ctx, "a", "1", 0)
+	ns.Put(ctx, "b", "2", 0)
+	if _, err := ns.Put(ctx, "c", "3", 0); err != multi_cache.ErrEntriesQuota {
+		t.Error("expected ErrEntriesQuota, got", err)
+	}
+	// The bucket allows bursts of 3 writes, all used above
+	if _, err := ns.Put(ctx, "a", "4", 0); err != multi_cache.ErrRateLimited {
+		t.Error("expected ErrRateLimited, got", err)
+	}
+
+	ns.SetQuota(multi_cache.Quota{MaxBytes: 5})
+	if _, err := ns.Put(ctx, "a", "4", 0); err != nil {
+		t.Error("expected the write to succeed, got", err)
+	}
+	if _, err := ns.Put(ctx, "a", "1234", 0); err != multi_cache.ErrBytesQuota {
+		t.Error("expected ErrBytesQuota, got", err)
+	}
+	info := ns.Info(ctx)
+	if info.Entries != 2 || info.Bytes != 4 || info.Rejected != 3 {
+		t.Error("expected 2 entries, 4 bytes and 3 rejected writes, got", info)
+	}
+
+	// Every write to the namespace is checked, not only Put
+	ns.SetQuota(multi_cache.Quota{MaxEntries: 2})
+	if _, err := ns.Set(ctx, "c", "3", 10, -1); err != multi_cache.ErrEntriesQuota {
+		t.Error("expected Set to fail with ErrEntriesQuota, got", err)
+	}
+	if _, _, err := ns.SetNX(ctx, "c", "3", 10, -1); err != multi_cache.ErrEntriesQuota {
+		t.Error("expected SetNX to fail with ErrEntriesQuota, got", err)
+	}
+	if _, err := ns.MSet(ctx, []multi_cache.Item{{Key: "a", Value: "5"}, {Key: "c", Value: "3"}}, 10, -1); err != multi_cache.ErrEntriesQuota {
+		t.Error("expected MSet to fail with ErrEntriesQuota, got", err)
+	}
+	if _, err := ns.IncrBy(ctx, "n", 1, 10); err != multi_cache.ErrEntriesQuota {
+		t.Error("expected IncrBy to fail with ErrEntriesQuota, got", err)
+	}
+	if _, err := ns.HSet(ctx, "h", map[string]string{"f": "v"}, 10); err != multi_cache.ErrEntriesQuota {
+		t.Error("expected HSet to fail with ErrEntriesQuota, got", err)
+	}
+	if _, err := ns.SAdd(ctx, "s", []string{"m"}, 10); err != multi_cache.ErrEntriesQuota {
+		t.Error("expected SAdd to fail with ErrEntriesQuota, got", err)
+	}
+	ns.SetQuota(multi_cache.Quota{MaxBytes: 6})
+	if _, err := ns.LPush(ctx, "l", []string{"xyz"}, 10); err != multi_cache.ErrBytesQuota {
+		t.Error("expected LPush to fail with ErrBytesQuota, got", err)
+	}
+	if _, err := ns.SetJSON(ctx, "a", `"123"`, 10, -1); err != multi_cache.ErrBytesQuota {
+		t.Error("expected SetJSON to fail with ErrBytesQuota, got", err)
+	}
+	if info := ns.Info(ctx); info.Entries != 2 || info.Bytes != 4 || ns.Get(ctx, "a") != "4" {
+		t.Error("expected rejected writes to leave the namespace unchanged, got", info)
+	}
+}
+
+// TestTypes tests that hashes, lists and sets are consistent across both tiers
+func TestTypes(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Del_ALL(ctx)
+	cache.HSet(ctx, "user", map[string]string{"name": "a", "age": "1"}, len1)
+	cache.HSet(ctx, "user", map[string]string{"age": "2"}, len1)
+	if added, _ := cache.SAdd(ctx, "seen", []string{"x", "y"}, len1); added != 2 {
+		t.Error("expected 2 added members, got", added)
+	}
+
+	if value, found, _ := cache.HGet(ctx, "user", "age"); !found || value != "2" {
+		t.Error("expected age 2, got", value)
+	}
+	if fields, _ := cache.HGetAll(ctx, "user"); !reflect.DeepEqual(fields, map[string]string{"name": "a", "age": "2"}) {
+		t.Error("expected map[age:2 name:a], got", fields)
+	}
+	if cache.Get(ctx, "user") != "" {
+		t.Error("expected Get on a hash to return an empty string")
+	}
+	if _, err := cache.LPush(ctx, "seen", []string{"z"}, len1); err == nil {
+		t.Error("expected an error pushing to a set")
+	}
+
+	// Reads promote the hash, so pushing a new key evicts the set from both tiers
+	cache.LPush(ctx, "log", []string{"1", "2"}, len1)
+	if cache.Type(ctx, "seen") != "none" {
+		t.Error("expected key 'seen' to be evicted")
+	}
+	if items, _ := cache.LRange(ctx, "log", 0, -1); strings.Join(items, ",") != "2,1" {
+		t.Error("expected 2,1 got", items)
+	}
+	if cache.Print_in_mem() != cache.Print_redis(ctx) {
+		t.Error("data is not the same in both backends")
+	}
+}
+
+// TestJSON tests path lookups and atomic patches of JSON documents
+func TestJSON(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Del_ALL(ctx)
+	if _, err := cache.SetJSON(ctx, "doc", "{nope", len1, -1); err != jsondoc.ErrInvalidJSON {
+		t.Error("expected ErrInvalidJSON, got", err)
+	}
+	cache.SetJSON(ctx, "doc", `{"user": {"name": "a"}, "items": []}`, len1, -1)
+	if value, _, _ := cache.GetJSON(ctx, "doc", "$.user.name"); value != `"a"` {
+		t.Error(`expected "a" got`, value)
+	}
+	if _, _, err := cache.GetJSON(ctx, "doc", "$.user.age"); err != jsondoc.ErrPathNotFound {
+		t.Error("expected ErrPathNotFound, got", err)
+	}
+
+	// Concurrent patches are all applied
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			patch := `[{"op": "add", "path": "/items/-", "value": ` + strconv.Itoa(i) + `}]`
+			if _, _, err := cache.PatchJSON(ctx, "doc", patch, len1); err != nil {
+				t.Error("expected the patch to apply, got", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if value, _, _ := cache.GetJSON(ctx, "doc", "$.items[4]"); value == "" {
+		t.Error("expected 5 items")
+	}
+
+	// A failing operation leaves the document unchanged
+	patch := `[{"op": "remove", "path": "/user"}, {"op": "test", "path": "/items", "value": []}]`
+	if _, _, err := cache.PatchJSON(ctx, "doc", patch, len1); !errors.Is(err, jsondoc.ErrTestFailed) {
+		t.Error("expected ErrTestFailed, got", err)
+	}
+	doc, _, err := cache.MergePatchJSON(ctx, "doc", `{"user": {"name": null, "age": 2}, "items": null}`, len1)
+	if err != nil || doc != `{"user":{"age":2}}` {
+		t.Error(`expected {"user":{"age":2}} got`, doc, err)
+	}
+	if _, _, err := cache.MergePatchJSON(ctx, "missing", `{}`, len1); err != multi_cache.ErrNotFound {
+		t.Error("expected ErrNotFound, got", err)
+	}
+
+	// Plain writes only replace the document with JSON, which keeps its content type
+	if _, err := cache.Set(ctx, "doc", "{nope", len1, -1); err != jsondoc.ErrInvalidJSON {
+		t.Error("expected ErrInvalidJSON, got", err)
+	}
+	if _, err := cache.MSet(ctx, []multi_cache.Item{{Key: "other", Value: "1"}, {Key: "doc", Value: "{nope"}}, len1, -1); err != jsondoc.ErrInvalidJSON {
+		t.Error("expected ErrInvalidJSON, got", err)
+	}
+	if cache.Get(ctx, "other") != "" || cache.Get(ctx, "doc") != doc {
+		t.Error("expected the rejected writes to leave every key alone")
+	}
+	cache.Set(ctx, "doc", `{"user": {}}`, len1, -1)
+	if value, _, contentType := cache.GetWithContentType(ctx, "doc"); value != `{"user": {}}` || contentType != "application/json" {
+		t.Error(`expected {"user": {}} as application/json got`, value, contentType)
+	}
+	if cache.Print_in_mem() != cache.Print_redis(ctx) {
+		t.Error("data is not the same in both backends")
+	}
+}
+
+// TestContentType tests that a content type describes the value it was stored with only
+func TestContentType(t *testing.T) {
+	// Create a new multi-cache instance
+	cache := multi_cache.NewMultiCache()
+	cache.Del_ALL(ctx)
+	cache.SetWithContentType(ctx, "page", "<b>a/b</b>", "text/html", len1, -1)
+	value, _, contentType := cache.GetWithContentType(ctx, "page")
+	if value != "<b>a/b</b>" || contentType != "text/html" {
+		t.Error("expected <b>a/b</b> as text/html got", value, contentType)
+	}
+
+	// Plain writes drop the content type
+	cache.Set(ctx, "page", "b", len1, -1)
+	if _, _, contentType := cache.GetWithContentType(ctx, "page"); contentType != "" {
+		t.Error("expected no content type, got", contentType)
+	}
+	cache.SetWithContentType(ctx, "page", "c", "text/csv", len1, -1)
+	cache.MSet(ctx, []multi_cache.Item{{Key: "page", Value: "d"}}, len1, -1)
+	if _, _, contentType := cache.GetWithContentType(ctx, "page"); contentType != "" {
+		t.Error("expected no content type, got", contentType)
+	}
+	if _, _, contentType := cache.GetWithContentType(ctx, "missing"); contentType != "" {
+		t.Error("expected no content type, got", contentType)
+	}
+}
+
+// TestServers tests that servers on separate Redis databases do not share any state
+func TestServers(t *testing.T) {
+	first := zin1.NewServer(zin1.Options{CacheOptions: multi_cache.Options{Redis: redis.Options{DB: 1}}})
+	defer first.Close()
+	second := zin1.NewServer(zin1.Options{CacheOptions: multi_cache.Options{Redis: redis.Options{DB: 2}}})
+	defer second.Close()
+	first.Cache().Del_ALL(ctx)
+	second.Cache().Del_ALL(ctx)
+	a, b := first.Engine(), second.Engine()
+
+	serve := func(engine http.Handler, method, path, body string) int {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code
+	}
+	if code := serve(a, "PUT", "/v1/keys/server", "1"); code != http.StatusCreated {
+		t.Error("expected 201 got", code)
+	}
+	if code := serve(a, "GET", "/v1/keys/server", ""); code != http.StatusOK {
+		t.Error("expected 200 got", code)
+	}
+	if code := serve(b, "GET", "/v1/keys/server", ""); code != http.StatusNotFound {
+		t.Error("expected 404 got", code)
+	}
+
+	// Legacy routes are only mounted when asked for
+	if code := serve(a, "GET", "/server", ""); code != http.StatusNotFound {
+		t.Error("expected 404 got", code)
+	}
+
+	// Closing a server stops watching its configuration
+	watching := zin1.NewServer(zin1.Options{Cache: first.Cache()})
+	stopped := make(chan struct{})
+	go func() {
+		watching.WatchConfig(context.Background(), filepath.Join(t.TempDir(), "zin1.yaml"))
+		close(stopped)
+	}()
+	watching.Close()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("expected WatchConfig to return once the server is closed")
+	}
+}
+
+// TestConfig tests loading the configuration from files and the environment
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "zin1.yaml")
+	os.WriteFile(yamlFile, []byte("capacity: 5\ncleanup_interval: 500ms\nredis:\n  password: secret\n"), 0o644)
+	tomlFile := filepath.Join(dir, "zin1.toml")
+	os.WriteFile(tomlFile, []byte("capacity = 5\ncleanup_interval = \"500ms\"\n[redis]\npassword = \"secret\"\n"), 0o644)
+
+	// Both formats give the same settings, and settings missing from the file keep their defaults
+	for _, file := range []string{yamlFile, tomlFile} {
+		cfg := config.Default()
+		if err := cfg.LoadFile(file); err != nil {
+			t.Fatal("expected the file to load, got", err)
+		}
+		if cfg.Capacity != 5 || cfg.CleanupInterval != config.Duration(500*time.Millisecond) || cfg.Redis.Password != "secret" {
+			t.Error("unexpected settings from", file, cfg)
+		}
+		if cfg.Redis.Addr != "localhost:6379" || !cfg.LegacyRoutes {
+			t.Error("expected the defaults to be kept, got", cfg)
+		}
+	}
+
+	// The environment overrides the file
+	cfg := config.Default()
+	env := map[string]string{"ZIN1_CAPACITY": "7", "ZIN1_REDIS_DB": "3", "ZIN1_LEGACY_ROUTES": "false"}
+	if err := cfg.LoadEnv(func(name string) string { return env[name] }); err != nil {
+		t.Fatal("expected the environment to load, got", err)
+	}
+	if cfg.Capacity != 7 || cfg.Redis.DB != 3 || cfg.LegacyRoutes {
+		t.Error("unexpected settings from the environment", cfg)
+	}
+	env = map[string]string{"ZIN1_CAPACITY": "seven"}
+	if err := cfg.LoadEnv(func(name string) string { return env[name] }); err == nil || !strings.Contains(err.Error(), "ZIN1_CAPACITY") {
+		t.Error("expected an error naming ZIN1_CAPACITY, got", err)
+	}
+
+	// Unknown settings and invalid values are errors
+	os.WriteFile(yamlFile, []byte("capcity: 5\n"), 0o644)
+	if err := config.Default().LoadFile(yamlFile); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+	cfg = config.Default()
+	cfg.Capacity = 0
+	cfg.Redis.Addr = "localhost"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "capacity") || !strings.Contains(err.Error(), "redis.addr") {
+		t.Error("expected errors for capacity and redis.addr, got", err)
+	}
+
+	// The effective configuration is printed without secrets
+	cfg = config.Default()
+	cfg.Redis.DB = 3
+	cfg.Redis.Password = "secret"
+	server := zin1.NewServerFromConfig(cfg)
+	defer server.Close()
+	w := httptest.NewRecorder()
+	server.Engine().ServeHTTP(w, httptest.NewRequest("GET", "/v1/admin/config", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "secret") || !strings.Contains(w.Body.String(), config.Redacted) {
+		t.Error("expected the redacted configuration, got", w.Code, w.Body.String())
+	}
+}
+
+// TestReload tests applying a new configuration to a running server
+func TestReload(t *testing.T) {
+	cfg := config.Default()
+	cfg.Capacity = 3
+	cfg.Redis.DB = 4
+	server := zin1.NewServerFromConfig(cfg)
+	defer server.Close()
+	server.Cache().Del_ALL(ctx)
+	engine := server.Engine()
+	put := func(key string) int {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest("PUT", "/v1/keys/"+key, strings.NewReader("1")))
+		return w.Code
+	}
+	put("r1")
+	put("r2")
+	put("r3")
+
+	// A smaller capacity evicts the least recently used keys at once, and a write rate limit applies to later writes
+	next := *cfg
+	next.Capacity = 1
+	next.MaxWritesPerSecond = 1
+	next.DefaultTTL = config.Duration(time.Minute)
+	if err := server.Reload(&next); err != nil {
+		t.Fatal("expected the configuration to be applied, got", err)
+	}
+	if result := server.Cache().Print_redis(ctx); result != "r3:1" {
+		t.Error("expected r3:1 got", result)
+	}
+	if code := put("r4"); code != http.StatusCreated {
+		t.Error("expected 201 got", code)
+	}
+	if ttl := server.Cache().TTL(ctx, "r4"); ttl <= 0 || ttl > time.Minute {
+		t.Error("expected the default TTL, got", ttl)
+	}
+	if code := put("r5"); code != http.StatusTooManyRequests {
+		t.Error("expected 429 got", code)
+	}
+
+	// Settings that need a restart reject the whole configuration
+	rejected := next
+	rejected.Capacity = 5
+	rejected.Redis.Addr = "localhost:6380"
+	if err := server.Reload(&rejected); err == nil || !strings.Contains(err.Error(), "redis.addr") {
+		t.Error("expected an error naming redis.addr, got", err)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/v1/admin/config", nil))
+	if !strings.Contains(w.Body.String(), `"capacity":1`) {
+		t.Error("expected the capacity to stay 1, got", w.Body.String())
+	}
+}
+
+// TestServe tests that stopping a server drains it, saves the in-memory tier and closes it
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	snapshot := filepath.Join(t.TempDir(), "snapshot")
+	opts := zin1.Options{
+		CacheOptions: multi_cache.Options{Redis: redis.Options{DB: 5}},
+		Addr:         addr,
+		SnapshotPath: snapshot,
+	}
+	server := zin1.NewServer(opts)
+	server.Cache().Del_ALL(ctx)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Serve(ctx) }()
+
+	// Wait for the server to listen, then store a key
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		request, _ := http.NewRequest("PUT", "http://"+addr+"/v1/keys/served", strings.NewReader("1"))
+		if resp, err = http.DefaultClient.Do(request); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal("expected the server to listen, got", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Error("expected 201 got", resp.StatusCode)
+	}
+	request, _ := http.NewRequest("PUT", "http://"+addr+"/v1/keys/stale", strings.NewReader("1"))
+	if resp, err = http.DefaultClient.Do(request); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Fatal("expected a clean stop, got", err)
+	}
+	if _, err := http.Get("http://" + addr + "/v1/keys/served"); err == nil {
+		t.Error("expected the server to stop listening")
+	}
+
+	// The next server starts with the saved in-memory tier, except the keys Redis changed since
+	redisCache := redis.NewLRUCacheWithOptions(redis.Options{DB: 5})
+	defer redisCache.Close()
+	redisCache.Put(context.Background(), "stale", "2", 10, -1)
+	server = zin1.NewServer(opts)
+	defer server.Close()
+	if err := server.Cache().LoadSnapshot(context.Background(), snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if result := server.Cache().Print_in_mem(); result != "served:1" {
+		t.Error("expected served:1 got", result)
+	}
+}
+
+// TestRoutes tests the status codes and error envelope of /v1, next to the legacy routes and without them
+func TestRoutes(t *testing.T) {
+	server := zin1.NewServer(zin1.Options{CacheOptions: multi_cache.Options{Redis: redis.Options{DB: 8}}, LegacyRoutes: true})
+	defer server.Close()
+	server.Cache().Del_ALL(ctx)
+	engine := server.Engine()
+	serve := func(engine http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	envelope := func(w *httptest.ResponseRecorder) (status int, code, message string) {
+		var body struct {
+			Error struct {
+				Status  int    `json:"status"`
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Error.Status, body.Error.Code, body.Error.Message
+	}
+
+	// Creating a key answers 201, replacing it 200, deleting it 204 and reading a missing key 404
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"PUT", "/v1/keys/a", "1", http.StatusCreated},
+		{"PUT", "/v1/keys/a", "2", http.StatusOK},
+		{"PUT", "/v1/keys/all", "3", http.StatusCreated},
+		{"GET", "/v1/keys/a", "", http.StatusOK},
+		{"DELETE", "/v1/keys/a", "", http.StatusNoContent},
+		{"DELETE", "/v1/keys/a", "", http.StatusNotFound},
+		{"GET", "/v1/keys/a", "", http.StatusNotFound},
+		{"PUT", "/v1/keys/a?ttl=0", "1", http.StatusBadRequest},
+		{"PATCH", "/v1/keys/a", strings.Repeat("x", 1<<20+1), http.StatusRequestEntityTooLarge},
+		{"GET", "/v1/no/such/route", "", http.StatusNotFound},
+	} {
+		w := serve(engine, test.method, test.path, test.body)
+		if w.Code != test.status {
+			t.Error("expected", test.status, "for", test.method, test.path, "got", w.Code)
+		}
+		if w.Code >= 400 {
+			status, code, message := envelope(w)
+			expected := strings.ToLower(strings.ReplaceAll(http.StatusText(test.status), " ", "_"))
+			if status != test.status || code != expected || message == "" {
+				t.Error("unexpected envelope for", test.method, test.path, w.Body.String())
+			}
+		}
+	}
+
+	// Legacy routes keep their plain error
+	for _, path := range []string{"/a/1/soon", "/a/1/0"} {
+		if w := serve(engine, "POST", path, ""); w.Code != http.StatusBadRequest || w.Body.String() != `{"error":"Invalid time parameter"}` {
+			t.Error(`expected 400 and {"error":"Invalid time parameter"} for`, path, "got", w.Code, w.Body.String())
+		}
+	}
+
+	// DELETE /v1/keys/all deletes the key named all, DELETE /v1/admin/cache every key
+	serve(engine, "PUT", "/v1/keys/b", "4")
+	if w := serve(engine, "DELETE", "/v1/keys/all", ""); w.Code != http.StatusNoContent {
+		t.Error("expected 204 got", w.Code)
+	}
+	if w := serve(engine, "GET", "/v1/keys/b", ""); w.Code != http.StatusOK || w.Body.String() != "4" {
+		t.Error("expected 200 and 4 got", w.Code, w.Body.String())
+	}
+	if w := serve(engine, "DELETE", "/v1/admin/cache", ""); w.Code != http.StatusNoContent {
+		t.Error("expected 204 got", w.Code)
+	}
+	if w := serve(engine, "GET", "/v1/keys/b", ""); w.Code != http.StatusNotFound {
+		t.Error("expected 404 got", w.Code)
+	}
+
+	// Without the legacy routes only /v1 is served
+	versioned := zin1.NewServer(zin1.Options{Cache: server.Cache()}).Engine()
+	if w := serve(versioned, "PUT", "/v1/keys/c", "5"); w.Code != http.StatusCreated {
+		t.Error("expected 201 got", w.Code)
+	}
+	for _, route := range [][2]string{{"GET", "/c"}, {"DELETE", "/all"}, {"POST", "/c/5/10"}, {"GET", "/keys/c"}} {
+		if w := serve(versioned, route[0], route[1], ""); w.Code != http.StatusNotFound {
+			t.Error("expected 404 for", route[0], route[1], "got", w.Code)
+		}
+	}
+	if value := server.Cache().Get(ctx, "c"); value != "5" {
+		t.Error("expected the legacy routes to leave c alone, got", value)
+	}
+}
+
+// TestMetrics tests the cache statistics and the metrics endpoint
+func TestMetrics(t *testing.T) {
+	server := zin1.NewServer(zin1.Options{CacheOptions: multi_cache.Options{Redis: redis.Options{DB: 6}}})
+	defer server.Close()
+	server.Cache().Del_ALL(ctx)
+	engine := server.Engine()
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	serve("PUT", "/v1/keys/counted", "1")
+	serve("GET", "/v1/keys/counted", "")
+	serve("GET", "/v1/keys/missing", "")
+	serve("PUT", "/v1/keys/second", "2")
+	serve("PUT", "/v1/keys/third", "3") // Evicts counted from both tiers
+	serve("DELETE", "/v1/keys/second", "")
+
+	stats := server.Cache().Stats(ctx)
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Error("expected 1 hit and 1 miss got", stats.Hits, stats.Misses)
+	}
+	if stats.InMemory.Sets != 3 || stats.InMemory.Deletes != 1 || stats.InMemory.Evictions[in_memory.EvictCapacity] != 1 || stats.InMemory.Entries != 1 {
+		t.Error("unexpected in-memory stats", stats.InMemory)
+	}
+	if stats.Redis.Sets != 3 || stats.Redis.Deletes != 1 || stats.Redis.Evictions[redis.EvictCapacity] != 1 || stats.Redis.Entries != 1 {
+		t.Error("unexpected redis stats", stats.Redis)
+	}
+
+	w := serve("GET", "/v1/metrics", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatal("expected 200 with the text format got", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		`zin1_cache_reads_total{result="hit"} 1`,
+		`zin1_cache_reads_total{result="miss"} 1`,
+		`zin1_tier_sets_total{tier="inmemory"} 3`,
+		`zin1_tier_evictions_total{tier="redis",reason="capacity"} 1`,
+		`zin1_tier_entries{tier="inmemory"} 1`,
+		`zin1_tier_bytes{tier="inmemory"} 6`,
+		`# TYPE zin1_redis_used_memory_bytes gauge`,
+		`zin1_http_requests_total{method="GET",route="/v1/keys/:key",status="404"} 1`,
+		`zin1_http_requests_total{method="PUT",route="/v1/keys/:key",status="201"} 3`,
+		`zin1_http_request_duration_seconds_count{method="DELETE",route="/v1/keys/:key"} 1`,
+		`# TYPE zin1_redis_command_duration_seconds histogram`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Error("expected the metrics to contain", line)
+		}
+	}
+}
+
+// TestHealth tests the liveness and readiness probes with Redis up and down
+func TestHealth(t *testing.T) {
+	probe := func(server *zin1.Server, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Engine().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	server := zin1.NewServer(zin1.Options{CacheOptions: multi_cache.Options{Redis: redis.Options{DB: 7}}})
+	defer server.Close()
+	for _, path := range []string{"/readyz", "/v1/readyz"} {
+		if w := probe(server, path); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"up"`) {
+			t.Error("expected 200 and up for", path, "got", w.Code, w.Body.String())
+		}
+	}
+
+	// The default configuration keeps the legacy routes, whose GET /:key must not shadow the probes
+	legacy := zin1.NewServerFromConfig(config.Default())
+	defer legacy.Close()
+	if !config.Default().LegacyRoutes {
+		t.Error("expected the legacy routes in the default configuration")
+	}
+	for _, path := range []string{"/readyz", "/v1/readyz"} {
+		if w := probe(legacy, path); !strings.Contains(w.Body.String(), `"tiers"`) {
+			t.Error("expected the readiness probe for", path, "got", w.Code, w.Body.String())
+		}
+	}
+	if w := probe(legacy, "/livez"); w.Code != http.StatusOK || w.Body.String() != `{"status":"up"}` {
+		t.Error(`expected 200 and {"status":"up"} got`, w.Code, w.Body.String())
+	}
+
+	// Without Redis only the in-memory tier is up
+	down := zin1.NewServer(zin1.Options{
+		CacheOptions: multi_cache.Options{Redis: redis.Options{Addr: "127.0.0.1:1"}, CleanupInterval: 10 * time.Millisecond},
+	})
+	if w := probe(down, "/healthz"); w.Code != http.StatusOK {
+		t.Error("expected 200 got", w.Code)
+	}
+	w := probe(down, "/readyz")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"degraded"`) {
+		t.Error("expected 200 and degraded got", w.Code, w.Body.String())
+	}
+	if health := down.Cache().Health(context.Background()); health.Tiers[multi_cache.TierRedis].Error == "" || health.Tiers[multi_cache.TierInMemory].Status != multi_cache.StatusUp {
+		t.Error("unexpected tiers", health.Tiers)
+	}
+
+	// Once the cleanup loop stops, the in-memory tier is down too
+	down.Close()
+	time.Sleep(50 * time.Millisecond)
+	if health := down.Cache().Health(context.Background()); health.Status != multi_cache.StatusDown {
+		t.Error("expected down got", health.Status)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	cache := multi_cache.NewMultiCacheWithOptions(multi_cache.Options{
+		Redis:   redis.Options{Addr: "127.0.0.1:1"},
+		Breaker: multi_cache.BreakerOptions{Failures: 2, Cooldown: 500 * time.Millisecond},
+	})
+	defer cache.Close()
+
+	// An invalid TTL is refused before Redis is tried
+	if _, err := cache.Set(ctx, "a", "1", 10, 0); err != redis.ErrInvalidTTL {
+		t.Error("expected ErrInvalidTTL got", err)
+	}
+
+	// Writes and reads fall back to the in-memory tier, and the breaker opens after two failures
+	if version, _ := cache.Set(ctx, "a", "1", 10, -1); version == 0 {
+		t.Error("expected a version got 0")
+	}
+	if value := cache.Get(ctx, "a"); value != "1" {
+		t.Error("expected 1 got", value)
+	}
+	if n, err := cache.Incr(ctx, "n", 10); err != nil || n != 1 {
+		t.Error("expected 1 got", n, err)
+	}
+	if _, err := cache.HSet(ctx, "h", map[string]string{"f": "v"}, 10); err != nil {
+		t.Error("expected no error got", err)
+	}
+	if fields, _ := cache.HGetAll(ctx, "h"); fields["f"] != "v" {
+		t.Error("expected v got", fields)
+	}
+	stats := cache.Stats(ctx).Breaker
+	if stats.State != multi_cache.BreakerOpen || stats.Opens != 1 || stats.Degraded != 4 {
+		t.Error("unexpected breaker stats", stats)
+	}
+	if health := cache.Health(context.Background()); health.Status != multi_cache.StatusDegraded || health.Tiers[multi_cache.TierRedis].Breaker != multi_cache.BreakerOpen {
+		t.Error("unexpected health", health)
+	}
+
+	// After the cooldown a failing probe opens the breaker again
+	time.Sleep(600 * time.Millisecond)
+	if state := cache.Stats(ctx).Breaker.State; state != multi_cache.BreakerHalfOpen {
+		t.Error("expected half-open got", state)
+	}
+	cache.Del(ctx, "a")
+	if value := cache.Get(ctx, "a"); value != "" {
+		t.Error("expected empty got", value)
+	}
+	if stats := cache.Stats(ctx).Breaker; stats.State != multi_cache.BreakerOpen || stats.Opens != 2 {
+		t.Error("unexpected breaker stats", stats)
+	}
+
+	// A snapshot loaded while Redis is unavailable cannot be checked, so none of it is kept
+	snapshot := filepath.Join(t.TempDir(), "snapshot")
+	cache.Set(ctx, "b", "2", 10, -1)
+	if err := cache.SaveSnapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	cache.Del_ALL(ctx)
+	if err := cache.LoadSnapshot(ctx, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if result := cache.Print_in_mem(); result != "" {
+		t.Error("expected an empty in-memory tier got", result)
+	}
+
+	// Concurrent patches of the in-memory tier apply one after the other
+	cache.Set(ctx, "doc", `{"items":[]}`, 10, -1)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := cache.PatchJSON(ctx, "doc", `[{"op":"add","path":"/items/-","value":`+strconv.Itoa(i)+`}]`, 10); err != nil {
+				t.Error("expected no error got", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	var doc struct{ Items []int }
+	expected := []int{}
+	for i := 0; i < 20; i++ {
+		expected = append(expected, i)
+	}
+	err := json.Unmarshal([]byte(cache.Get(ctx, "doc")), &doc)
+	if sort.Ints(doc.Items); err != nil || !reflect.DeepEqual(doc.Items, expected) {
+		t.Error("expected the items 0 to 19 got", doc.Items, err)
+	}
+}
+
+// proxy forwards connections to Redis on localhost:6379 and can be stopped and started again on the same address
+type proxy struct {
+	addr     string
+	mu       sync.Mutex
+	listener net.Listener
+	conns    []net.Conn
+}
+
+// startProxy returns a running proxy on a free port
+func startProxy(t *testing.T) *proxy {
+	p := &proxy{addr: "127.0.0.1:0"}
+	p.start(t)
+	p.addr = p.listener.Addr().String()
+	t.Cleanup(p.stop)
+	return p
+}
+
+// start listens on the address of the proxy and forwards every connection it accepts
+func (p *proxy) start(t *testing.T) {
+	listener, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.listener = listener
+	p.mu.Unlock()
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("tcp", "localhost:6379")
+			if err != nil {
+				client.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, client, server)
+			p.mu.Unlock()
+			go func() { io.Copy(server, client); server.Close() }()
+			go func() { io.Copy(client, server); client.Close() }()
+		}
+	}()
+}
+
+// stop closes the listener and every forwarded connection, as if Redis went down
+func (p *proxy) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listener.Close()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// TestRecovery tests that changes made while Redis was unreachable are replayed once it is back,
+// and that clearing the cache meanwhile only deletes from Redis the keys memory held
+func TestRecovery(t *testing.T) {
+	p := startProxy(t)
+	cache := multi_cache.NewMultiCacheWithOptions(multi_cache.Options{
+		Redis:   redis.Options{Addr: p.addr, DB: 7, PoolSize: 1, MaxRetries: -1}, // One connection, so none is left stale
+		Breaker: multi_cache.BreakerOptions{Failures: 1, Cooldown: 100 * time.Millisecond},
+	})
+	defer cache.Close()
+	redisCache := redis.NewLRUCacheWithOptions(redis.Options{DB: 7})
+	defer redisCache.Close()
+	cache.Del_ALL(ctx)
+	cache.Set(ctx, "kept", "1", 10, -1)
+	cache.Set(ctx, "deleted", "1", 10, -1)
+	if stats := cache.Stats(ctx).Breaker; stats.State != multi_cache.BreakerClosed {
+		t.Fatal("expected closed got", stats.State)
+	}
+
+	// While Redis is down the writes only reach memory
+	p.stop()
+	cache.Set(ctx, "kept", "2", 10, -1)
+	cache.Del(ctx, "deleted")
+	cache.Set(ctx, "new", "3", 10, -1)
+	if stats := cache.Stats(ctx).Breaker; stats.State != multi_cache.BreakerOpen {
+		t.Error("expected open got", stats.State)
+	}
+
+	// Once the cooldown ends, the probe replays them before writing
+	p.start(t)
+	time.Sleep(150 * time.Millisecond)
+	cache.Set(ctx, "probe", "4", 10, -1)
+	if stats := cache.Stats(ctx).Breaker; stats.State != multi_cache.BreakerClosed || stats.Replayed != 3 {
+		t.Error("unexpected breaker stats", stats)
+	}
+	for key, expected := range map[string]string{"kept": "2", "deleted": "", "new": "3", "probe": "4"} {
+		if value := redisCache.Get(ctx, key); value != expected {
+			t.Error("expected", expected, "for", key, "got", value)
+		}
+	}
+
+	// Clearing the cache while Redis is down deletes the keys memory held, but never flushes Redis
+	redisCache.Put(ctx, "outside", "5", 10, -1)
+	p.stop()
+	cache.Del_ALL(ctx)
+	p.start(t)
+	time.Sleep(150 * time.Millisecond)
+	cache.Set(ctx, "probe", "6", 10, -1)
+	for key, expected := range map[string]string{"kept": "", "new": "", "probe": "6", "outside": "5"} {
+		if value := redisCache.Get(ctx, key); value != expected {
+			t.Error("expected", expected, "for", key, "got", value)
+		}
+	}
+}
+
+// TestRetries tests that reads Redis failed to answer are retried and that cancelled operations are not failures
+func TestRetries(t *testing.T) {
+	cache := multi_cache.NewMultiCacheWithOptions(multi_cache.Options{
+		Redis:   redis.Options{Addr: "127.0.0.1:1", MaxRetries: 2, RetryBackoff: time.Millisecond},
+		Breaker: multi_cache.BreakerOptions{Failures: 1},
+	})
+	defer cache.Close()
+
+	// A cancelled operation gives up on Redis without opening the breaker
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if value := cache.Get(cancelled, "a"); value != "" {
+		t.Error("expected empty got", value)
+	}
+	if state := cache.Stats(ctx).Breaker.State; state != multi_cache.BreakerClosed {
+		t.Error("expected closed got", state)
+	}
+
+	// A failing read is retried, and only its last attempt counts towards the breaker
+	cache.Get(ctx, "a")
+	retries := map[string]uint64{}
+	cache.RedisRetries(func(operation string, n uint64) { retries[operation] = n })
+	if retries["get_with_version"] != 2 {
+		t.Error("expected 2 retries of get_with_version got", retries)
+	}
+	if stats := cache.Stats(ctx).Breaker; stats.State != multi_cache.BreakerOpen || stats.Opens != 1 {
+		t.Error("unexpected breaker stats", stats)
 	}
 }